@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/config"
+	"github.com/ireuven89/firefly-itzik/internal/output"
+	"github.com/ireuven89/firefly-itzik/internal/results"
+)
+
+// runCompare reports how word frequencies changed between two result files, e.g. last week's run and this week's
+func runCompare(args []string) error {
+	flags := newFlagSet("compare", "old-result-file new-result-file")
+	topN := flags.Int("top", config.DefaultTopWordsCount, "number of words in each list")
+	minCount := flags.Int("min-count", 5, "ignore words counted fewer times than this across both runs")
+	alpha := flags.Float64("alpha", 0.05, "keep only changes significant at this level (1 keeps everything)")
+	outputFile := flags.String("output", config.DefaultOutputFile, "write the comparison to this path, - for stdout")
+	outputFormat := flags.String("output-format", config.DefaultOutputFormat, "output format: json, csv, ndjson, markdown or html")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errUsage
+	}
+	if *topN < config.MinTopWordsCount || *topN > config.MaxTopWordsCount {
+		return fmt.Errorf("-top must be between %d and %d, got %d", config.MinTopWordsCount, config.MaxTopWordsCount, *topN)
+	}
+	if *alpha <= 0 || *alpha > 1 {
+		return fmt.Errorf("-alpha must be in (0, 1], got %g", *alpha)
+	}
+	format, err := output.ParseFormat(*outputFormat)
+	if err != nil {
+		return err
+	}
+
+	before, err := results.Load(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	after, err := results.Load(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	comparison := results.Compare(before, after, results.CompareOptions{TopN: *topN, MinCount: *minCount, Alpha: *alpha})
+
+	out, err := openOutput(*outputFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err := output.NewWriter(format).WriteComparison(out, comparison); err != nil {
+		return fmt.Errorf("failed to write comparison: %w", err)
+	}
+	return out.Close()
+}
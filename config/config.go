@@ -1,16 +1,30 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"github.com/ireuven89/firefly-itzik/internal/essay"
+	"github.com/ireuven89/firefly-itzik/internal/httpfixture"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/output"
+	"github.com/ireuven89/firefly-itzik/internal/processor"
+	"github.com/ireuven89/firefly-itzik/internal/urlnorm"
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"mime"
+	"net/http"
+	"net/url"
 	"os"
-	"strconv"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 )
 
 type Config struct {
 	// File paths
-	EssaysFile   string
-	WordBankFile string
+	EssaysFile      string
+	WordBankFile    string
+	WordBankBackend string
 
 	// Processing
 	MaxWorkers     int
@@ -27,96 +41,383 @@ type Config struct {
 	// HTTP fetching
 	MaxHTTPWorkers int
 	HTTPRetryDelay time.Duration
+
+	// Response validation: body limit in bytes (0 disables it), accepted media types and redirect policy
+	MaxBodyBytes       int
+	ContentTypes       string
+	MaxRedirects       int
+	CrossHostRedirects bool
+
+	// HTTP client: headers file of "Name: value" lines, cookies as "name=value; ...", proxy URL (empty uses the
+	// environment), timeouts, extra trusted CAs as a PEM file and whether HTTP/2 is negotiated
+	HeadersFile    string
+	Cookies        string
+	Proxy          string
+	HTTPTimeout    time.Duration
+	ConnectTimeout time.Duration
+	CABundle       string
+	HTTP2          bool
+
+	// HTTP fixtures: record every response into FixturesDir, or replay them from it without the network
+	FixturesMode string
+	FixturesDir  string
+
+	// Crawl politeness: the User-Agent sent and matched against robots.txt, whether robots.txt is obeyed
+	// and where the URLs it disallowed are reported (empty disables the report)
+	UserAgent         string
+	Robots            bool
+	SkippedReportFile string
+
+	// Deduplication: URL variants are fetched once and essays sharing a canonical URL or text counted once;
+	// StripParams are the comma-separated query parameters ignored when comparing URLs, name* for a prefix
+	Dedupe      bool
+	StripParams string
+
+	// Snapshots
+	SnapshotInterval time.Duration
+	SnapshotFile     string
+
+	// Full-count result file for merging distributed runs (empty disables it)
+	ResultFile string
+
+	// Runtime reloading (0 / empty disables)
+	WordBankReloadInterval time.Duration
+	AdminAddr              string
+
+	// Named word banks as "name=path,..." composed by WordBankExpr; replaces WordBankFile when set
+	WordBanks         string
+	WordBankExpr      string
+	WordBankBreakdown bool
+
+	// Word bank metadata filters as comma-separated lists (empty counts everything) and weighting
+	POSFilter      string
+	TagFilter      string
+	WeightedCounts bool
+
+	// URLs that failed, one per line so the file can be fed back as essays_file (empty disables it)
+	FailedURLsFile string
+
+	// Out-of-vocabulary report of rejected tokens (empty disables it)
+	OOVReportFile string
+	OOVReportTop  int
+
+	// Fuzzy matching of misspellings to word bank words (0 disables it)
+	FuzzyDistance   int
+	FuzzyReportFile string
+
+	// Near-duplicate essays: off, report, drop or downweight those at least NearDuplicateThreshold similar to an
+	// earlier essay, keeping NearDuplicateWeight of their counts when downweighting
+	NearDuplicates         string
+	NearDuplicateThreshold float64
+	NearDuplicateWeight    float64
+
+	// Output format and destination ("-" is stdout)
+	OutputFormat string
+	OutputFile   string
+
+	// Local store recording every run for the query command (empty disables it)
+	StoreDir string
+
+	// Logging to stderr
+	LogLevel  string
+	LogFormat string
+
+	// Prometheus metrics endpoint (empty disables it)
+	MetricsAddr string
 }
 
-func LoadConfig() *Config {
-	config := &Config{
-		EssaysFile:         getEnv("APP_ESSAYS_FILE", DefaultEssaysFile),
-		WordBankFile:       getEnv("APP_WORDBANK_FILE", DefaultWordBankFile),
-		MaxWorkers:         getEnvAsInt("APP_MAX_WORKERS", MaxConcurrentWorkers),
-		TopWordsCount:      getEnvAsInt("APP_TOP_WORDS_COUNT", DefaultTopWordsCount),
-		ProcessTimeout:     getEnvAsDuration("APP_PROCESS_TIMEOUT", ProcessingTimeout),
-		RateLimit:          getEnvAsInt("APP_RATE_LIMIT", DefaultRateLimit),
-		EssayStreamBuffer:  getEnvAsInt("APP_ESSAY_STREAM_BUFFER", EssayStreamBufferSize),
-		ErrorChannelBuffer: getEnvAsInt("APP_ERROR_CHANNEL_BUFFER", ErrorChannelBufferSize),
-		MaxHTTPWorkers:     getEnvAsInt("APP_MAX_HTTP_WORKERS", MaxHTTPWorkers),
-		HTTPRetryDelay:     getEnvAsDuration("APP_HTTP_RETRY_DELAY", HTTPRetryDelay),
+// Default returns the built-in configuration, before any config file, environment or flag is applied
+func Default() *Config {
+	return &Config{
+		EssaysFile:             DefaultEssaysFile,
+		WordBankFile:           DefaultWordBankFile,
+		WordBankBackend:        DefaultWordBankBackend,
+		MaxWorkers:             MaxConcurrentWorkers,
+		TopWordsCount:          DefaultTopWordsCount,
+		ProcessTimeout:         ProcessingTimeout,
+		RateLimit:              DefaultRateLimit,
+		EssayStreamBuffer:      EssayStreamBufferSize,
+		ErrorChannelBuffer:     ErrorChannelBufferSize,
+		MaxHTTPWorkers:         MaxHTTPWorkers,
+		HTTPRetryDelay:         HTTPRetryDelay,
+		MaxBodyBytes:           essay.DefaultMaxBodyBytes,
+		ContentTypes:           strings.Join(essay.DefaultContentTypes, ","),
+		MaxRedirects:           essay.DefaultMaxRedirects,
+		CrossHostRedirects:     true,
+		HTTPTimeout:            essay.DefaultTimeout,
+		ConnectTimeout:         essay.DefaultConnectTimeout,
+		HTTP2:                  true,
+		FixturesMode:           httpfixture.ModeOff,
+		UserAgent:              essay.DefaultUserAgent,
+		Robots:                 true,
+		Dedupe:                 true,
+		StripParams:            strings.Join(urlnorm.DefaultStripParams, ","),
+		SnapshotInterval:       DefaultSnapshotInterval,
+		SnapshotFile:           DefaultSnapshotFile,
+		OOVReportTop:           DefaultOOVReportTop,
+		NearDuplicates:         processor.NearDuplicatesOff,
+		NearDuplicateThreshold: DefaultNearDuplicateThreshold,
+		NearDuplicateWeight:    DefaultNearDuplicateWeight,
+		OutputFormat:           DefaultOutputFormat,
+		OutputFile:             DefaultOutputFile,
+		LogLevel:               DefaultLogLevel,
+		LogFormat:              DefaultLogFormat,
 	}
+}
 
-	// Validate configuration
-	if err := config.Validate(); err != nil {
-		panic(fmt.Sprintf("Invalid configuration: %v", err))
+// SplitList splits a comma-separated setting, dropping empty items
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-
-	return config
+	return items
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// WordBankPath is the path to reload the word bank from; named word banks reload every member from its own file
+func (c *Config) WordBankPath() string {
+	if c.WordBanks != "" {
+		return ""
 	}
-	return defaultValue
+	return c.WordBankFile
 }
 
-func getEnvAsInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if parsed, err := strconv.Atoi(value); err == nil {
-			return parsed
-		}
+// NearDuplicateOptions is how the processor treats near-duplicate essays
+func (c *Config) NearDuplicateOptions() processor.NearDuplicates {
+	return processor.NearDuplicates{
+		Mode:      c.NearDuplicates,
+		Threshold: c.NearDuplicateThreshold,
+		Weight:    c.NearDuplicateWeight,
 	}
-	return defaultValue
 }
 
-func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
-		if parsed, err := time.ParseDuration(value); err == nil {
-			return parsed
+// FetchOptions is how the fetcher connects, identifies itself, obeys robots.txt, validates responses and deduplicates;
+// it reads the headers file, the CA bundle and the fixtures to replay
+func (c *Config) FetchOptions() (essay.Options, error) {
+	client := essay.ClientOptions{
+		Timeout:        c.HTTPTimeout,
+		ConnectTimeout: c.ConnectTimeout,
+		DisableHTTP2:   !c.HTTP2,
+	}
+
+	var err error
+	if c.HeadersFile != "" {
+		if client.Headers, err = essay.ReadHeaders(c.HeadersFile); err != nil {
+			return essay.Options{}, fmt.Errorf("failed to read headers file: %w", err)
+		}
+	}
+	if client.Cookies, err = essay.ParseCookies(c.Cookies); err != nil {
+		return essay.Options{}, err
+	}
+	if c.Proxy != "" {
+		if client.Proxy, err = url.Parse(c.Proxy); err != nil {
+			return essay.Options{}, fmt.Errorf("invalid proxy: %w", err)
+		}
+	}
+	if c.CABundle != "" {
+		if client.RootCAs, err = essay.LoadCABundle(c.CABundle); err != nil {
+			return essay.Options{}, fmt.Errorf("failed to load CA bundle: %w", err)
 		}
 	}
-	return defaultValue
+	switch c.FixturesMode {
+	case httpfixture.ModeRecord:
+		if err := os.MkdirAll(c.FixturesDir, 0755); err != nil {
+			return essay.Options{}, fmt.Errorf("failed to create fixtures directory: %w", err)
+		}
+		client.Transport = func(base http.RoundTripper) http.RoundTripper {
+			return httpfixture.NewRecorder(c.FixturesDir, base)
+		}
+	case httpfixture.ModeReplay:
+		replayer, err := httpfixture.NewReplayer(c.FixturesDir)
+		if err != nil {
+			return essay.Options{}, err
+		}
+		client.Transport = func(http.RoundTripper) http.RoundTripper { return replayer }
+	}
+
+	return essay.Options{
+		Client: client,
+		Response: essay.ResponsePolicy{
+			MaxBodyBytes:       int64(c.MaxBodyBytes),
+			ContentTypes:       SplitList(c.ContentTypes),
+			MaxRedirects:       c.MaxRedirects,
+			CrossHostRedirects: c.CrossHostRedirects,
+		},
+		UserAgent:   c.UserAgent,
+		Robots:      c.Robots,
+		Dedupe:      c.Dedupe,
+		StripParams: SplitList(c.StripParams),
+	}, nil
 }
 
-// Validate checks if all configuration values are within acceptable ranges
+// Validate checks if all configuration values are within acceptable ranges, reporting every violation at once
 func (c *Config) Validate() error {
+	var errs []error
+
 	// Validate file paths
 	if c.EssaysFile == "" {
-		return fmt.Errorf("essays file path cannot be empty")
+		errs = append(errs, fmt.Errorf("essays file path cannot be empty"))
+	}
+	if c.WordBankFile == "" && c.WordBanks == "" {
+		errs = append(errs, fmt.Errorf("word bank file path cannot be empty"))
 	}
-	if c.WordBankFile == "" {
-		return fmt.Errorf("word bank file path cannot be empty")
+
+	if _, err := wordbank.ParseBackend(c.WordBankBackend); err != nil {
+		errs = append(errs, err)
 	}
 
 	// Validate processing limits
 	if c.MaxWorkers < MinWorkers || c.MaxWorkers > MaxWorkers {
-		return fmt.Errorf("max workers must be between %d and %d, got %d", MinWorkers, MaxWorkers, c.MaxWorkers)
+		errs = append(errs, fmt.Errorf("max workers must be between %d and %d, got %d", MinWorkers, MaxWorkers, c.MaxWorkers))
 	}
 	if c.TopWordsCount < MinTopWordsCount || c.TopWordsCount > MaxTopWordsCount {
-		return fmt.Errorf("top words count must be between %d and %d, got %d", MinTopWordsCount, MaxTopWordsCount, c.TopWordsCount)
+		errs = append(errs, fmt.Errorf("top words count must be between %d and %d, got %d", MinTopWordsCount, MaxTopWordsCount, c.TopWordsCount))
 	}
 	if c.ProcessTimeout < MinTimeout || c.ProcessTimeout > MaxTimeout {
-		return fmt.Errorf("process timeout must be between %v and %v, got %v", MinTimeout, MaxTimeout, c.ProcessTimeout)
+		errs = append(errs, fmt.Errorf("process timeout must be between %v and %v, got %v", MinTimeout, MaxTimeout, c.ProcessTimeout))
 	}
 
 	// Validate rate limiting
 	if c.RateLimit < MinRateLimit || c.RateLimit > MaxRateLimit {
-		return fmt.Errorf("rate limit must be between %d and %d, got %d", MinRateLimit, MaxRateLimit, c.RateLimit)
+		errs = append(errs, fmt.Errorf("rate limit must be between %d and %d, got %d", MinRateLimit, MaxRateLimit, c.RateLimit))
 	}
 
 	// Validate buffer sizes
 	if c.EssayStreamBuffer < MinBufferSize || c.EssayStreamBuffer > MaxBufferSize {
-		return fmt.Errorf("essay stream buffer must be between %d and %d, got %d", MinBufferSize, MaxBufferSize, c.EssayStreamBuffer)
+		errs = append(errs, fmt.Errorf("essay stream buffer must be between %d and %d, got %d", MinBufferSize, MaxBufferSize, c.EssayStreamBuffer))
 	}
 	if c.ErrorChannelBuffer < MinBufferSize || c.ErrorChannelBuffer > MaxBufferSize {
-		return fmt.Errorf("error channel buffer must be between %d and %d, got %d", MinBufferSize, MaxBufferSize, c.ErrorChannelBuffer)
+		errs = append(errs, fmt.Errorf("error channel buffer must be between %d and %d, got %d", MinBufferSize, MaxBufferSize, c.ErrorChannelBuffer))
 	}
 
 	// Validate HTTP settings
 	if c.MaxHTTPWorkers < MinWorkers || c.MaxHTTPWorkers > MaxWorkers {
-		return fmt.Errorf("max HTTP workers must be between %d and %d, got %d", MinWorkers, MaxWorkers, c.MaxHTTPWorkers)
+		errs = append(errs, fmt.Errorf("max HTTP workers must be between %d and %d, got %d", MinWorkers, MaxWorkers, c.MaxHTTPWorkers))
 	}
 	if c.HTTPRetryDelay < 0 || c.HTTPRetryDelay > 5*time.Second {
-		return fmt.Errorf("HTTP retry delay must be between 0 and 5s, got %v", c.HTTPRetryDelay)
+		errs = append(errs, fmt.Errorf("HTTP retry delay must be between 0 and 5s, got %v", c.HTTPRetryDelay))
+	}
+	if c.MaxBodyBytes < 0 || c.MaxBodyBytes > MaxBodyBytes {
+		errs = append(errs, fmt.Errorf("max body bytes must be between 0 and %d, got %d", MaxBodyBytes, c.MaxBodyBytes))
+	}
+	for _, contentType := range SplitList(c.ContentTypes) {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			errs = append(errs, fmt.Errorf("invalid content type %q: %w", contentType, err))
+		}
+	}
+	if c.MaxRedirects < 0 || c.MaxRedirects > MaxRedirects {
+		errs = append(errs, fmt.Errorf("max redirects must be between 0 and %d, got %d", MaxRedirects, c.MaxRedirects))
+	}
+	if c.HTTPTimeout < MinHTTPTimeout || c.HTTPTimeout > MaxHTTPTimeout {
+		errs = append(errs, fmt.Errorf("HTTP timeout must be between %v and %v, got %v", MinHTTPTimeout, MaxHTTPTimeout, c.HTTPTimeout))
+	}
+	if c.ConnectTimeout < MinConnectTimeout || c.ConnectTimeout > c.HTTPTimeout {
+		errs = append(errs, fmt.Errorf("connect timeout must be between %v and the HTTP timeout, got %v", MinConnectTimeout, c.ConnectTimeout))
+	}
+	if _, err := essay.ParseCookies(c.Cookies); err != nil {
+		errs = append(errs, err)
+	}
+	if !slices.Contains(httpfixture.Modes, c.FixturesMode) {
+		errs = append(errs, fmt.Errorf("fixtures mode must be one of %s, got %q", strings.Join(httpfixture.Modes, ", "), c.FixturesMode))
+	}
+	if c.FixturesMode != httpfixture.ModeOff && c.FixturesDir == "" {
+		errs = append(errs, fmt.Errorf("fixtures directory cannot be empty when recording or replaying fixtures"))
+	}
+	if c.Proxy != "" {
+		if u, err := url.Parse(c.Proxy); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			errs = append(errs, fmt.Errorf("proxy must be an http, https or socks5 URL, got %q", c.Proxy))
+		}
+	}
+
+	// Validate snapshots (0 disables them)
+	if c.SnapshotInterval != 0 && (c.SnapshotInterval < MinSnapshotInterval || c.SnapshotInterval > MaxTimeout) {
+		errs = append(errs, fmt.Errorf("snapshot interval must be 0 or between %v and %v, got %v", MinSnapshotInterval, MaxTimeout, c.SnapshotInterval))
+	}
+	if c.SnapshotInterval != 0 && c.SnapshotFile == "" {
+		errs = append(errs, fmt.Errorf("snapshot file cannot be empty when snapshots are enabled"))
+	}
+	// Snapshots interleaved with the output would leave neither machine-readable
+	if c.SnapshotInterval != 0 && c.SnapshotFile != "" && sameFile(c.SnapshotFile, c.OutputFile) {
+		errs = append(errs, fmt.Errorf("snapshot file %q cannot be the output file", c.SnapshotFile))
+	}
+
+	// Validate runtime reloading (0 disables it)
+	if c.WordBankReloadInterval != 0 && (c.WordBankReloadInterval < MinReloadInterval || c.WordBankReloadInterval > MaxTimeout) {
+		errs = append(errs, fmt.Errorf("word bank reload interval must be 0 or between %v and %v, got %v", MinReloadInterval, MaxTimeout, c.WordBankReloadInterval))
+	}
+
+	// Validate the OOV report
+	if c.OOVReportTop < MinTopWordsCount || c.OOVReportTop > MaxTopWordsCount {
+		errs = append(errs, fmt.Errorf("OOV report size must be between %d and %d, got %d", MinTopWordsCount, MaxTopWordsCount, c.OOVReportTop))
+	}
+
+	// Validate fuzzy matching
+	if c.FuzzyDistance < 0 || c.FuzzyDistance > MaxFuzzyDistance {
+		errs = append(errs, fmt.Errorf("fuzzy distance must be between 0 and %d, got %d", MaxFuzzyDistance, c.FuzzyDistance))
+	}
+	if c.FuzzyReportFile != "" && c.FuzzyDistance == 0 {
+		errs = append(errs, fmt.Errorf("fuzzy report requires a fuzzy distance"))
+	}
+
+	// Validate near-duplicate detection
+	if !slices.Contains(processor.NearDuplicateModes, c.NearDuplicates) {
+		errs = append(errs, fmt.Errorf("near duplicates must be one of %s, got %q", strings.Join(processor.NearDuplicateModes, ", "), c.NearDuplicates))
+	}
+	if c.NearDuplicateThreshold < MinNearDuplicateThreshold || c.NearDuplicateThreshold > 1 {
+		errs = append(errs, fmt.Errorf("near-duplicate threshold must be between %v and 1, got %v", MinNearDuplicateThreshold, c.NearDuplicateThreshold))
+	}
+	if c.NearDuplicateWeight < 0 || c.NearDuplicateWeight > 1 {
+		errs = append(errs, fmt.Errorf("near-duplicate weight must be between 0 and 1, got %v", c.NearDuplicateWeight))
 	}
 
-	return nil
+	// Validate output
+	if _, err := output.ParseFormat(c.OutputFormat); err != nil {
+		errs = append(errs, err)
+	}
+	if c.OutputFile == "" {
+		errs = append(errs, fmt.Errorf("output file cannot be empty, use - for stdout"))
+	}
+
+	// Validate logging
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, err)
+	}
+	if err := logging.ValidateFormat(c.LogFormat); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Validate named word banks
+	if c.WordBanks != "" {
+		files, err := wordbank.ParseBankFiles(c.WordBanks)
+		if err != nil {
+			errs = append(errs, err)
+		} else if c.WordBankExpr != "" {
+			names := make([]string, len(files))
+			for i, file := range files {
+				names[i] = file.Name
+			}
+			if err := wordbank.ValidateExpression(c.WordBankExpr, names); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	} else if c.WordBankExpr != "" || c.WordBankBreakdown {
+		errs = append(errs, fmt.Errorf("word bank expression and breakdown require named word banks"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// sameFile reports whether two paths, where - is stdout, name the same file
+func sameFile(a, b string) bool {
+	if a == "-" || b == "-" {
+		return a == b
+	}
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
 }
@@ -3,12 +3,18 @@ package config
 import "time"
 
 const (
-	DefaultEssaysFile   = "endg-urls"
-	DefaultWordBankFile = "words.txt"
+	DefaultEssaysFile      = "endg-urls"
+	DefaultWordBankFile    = "words.txt"
+	DefaultWordBankBackend = "map"
+	DefaultOutputFormat    = "json"
+	DefaultOutputFile      = "-" // stdout
+	DefaultLogLevel        = "info"
+	DefaultLogFormat       = "text"
 
 	// Processing limits
 	MaxConcurrentWorkers = 20
 	DefaultTopWordsCount = 10
+	DefaultOOVReportTop  = 100
 	ProcessingTimeout    = 1 * time.Minute
 
 	// Rate limiting
@@ -21,10 +27,20 @@ const (
 	// HTTP fetching
 	MaxHTTPWorkers = 200
 	HTTPRetryDelay = 200 * time.Millisecond
+	MaxBodyBytes   = 1 << 30 // 1GB
+	MaxRedirects   = 20
+
+	MinHTTPTimeout    = 1 * time.Second
+	MaxHTTPTimeout    = 5 * time.Minute
+	MinConnectTimeout = 100 * time.Millisecond
 
 	// Progress reporting
 	ProgressReportInterval = 10 // report every N essays
 
+	// Snapshots
+	DefaultSnapshotInterval = 0 // disabled
+	DefaultSnapshotFile     = "snapshots.ndjson"
+
 	// Validation limits
 	MinWorkers       = 1
 	MaxWorkers       = 1000
@@ -36,4 +52,19 @@ const (
 	MaxBufferSize    = 10000
 	MinTimeout       = 1 * time.Second
 	MaxTimeout       = 1 * time.Hour
+
+	MinSnapshotInterval = 1 * time.Second
+	MinReloadInterval   = 1 * time.Second
+)
+
+// Fuzzy matching
+const (
+	MaxFuzzyDistance = 2
+)
+
+// Near-duplicate detection
+const (
+	DefaultNearDuplicateThreshold = 0.9
+	DefaultNearDuplicateWeight    = 0.5
+	MinNearDuplicateThreshold     = 0.5
 )
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fileConfig is a parsed config file: top-level settings plus named profiles of settings,
+// with every value kept as the string the matching field parses
+type fileConfig struct {
+	path     string
+	values   map[string]string
+	profiles map[string]map[string]string
+}
+
+// parseFile reads a JSON, YAML or TOML config file, chosen by extension:
+//
+//	rate_limit: 25
+//	profiles:
+//	  nightly:
+//	    max_http_workers: 50
+func parseFile(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var raw map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&raw)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		raw, err = parseTOML(data)
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q (use .json, .yaml, .yml or .toml)", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	fc := &fileConfig{
+		path:     path,
+		profiles: make(map[string]map[string]string),
+	}
+
+	var errs []error
+	profiles, hasProfiles := raw["profiles"]
+	delete(raw, "profiles")
+	fc.values, errs = settingsFromMap(raw, path)
+
+	if hasProfiles {
+		profileMap, ok := profiles.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("profiles in config file %s must be a mapping of profile names to settings", path)
+		}
+		for name, settings := range profileMap {
+			settingsMap, ok := settings.(map[string]any)
+			if !ok {
+				errs = append(errs, fmt.Errorf("profile %q in config file %s must be a mapping of settings", name, path))
+				continue
+			}
+
+			values, profileErrs := settingsFromMap(settingsMap, fmt.Sprintf("%s (profile %s)", path, name))
+			fc.profiles[name] = values
+			errs = append(errs, profileErrs...)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, joinSorted(errs)
+	}
+	return fc, nil
+}
+
+// settingsFromMap converts decoded values to strings, rejecting unknown keys and non-scalar values
+func settingsFromMap(raw map[string]any, where string) (map[string]string, []error) {
+	values := make(map[string]string, len(raw))
+	var errs []error
+
+	for key, v := range raw {
+		if _, ok := fieldByKey(key); !ok {
+			errs = append(errs, fmt.Errorf("unknown key %q in config file %s", key, where))
+			continue
+		}
+
+		switch v := v.(type) {
+		case string:
+			values[key] = v
+		case bool:
+			values[key] = strconv.FormatBool(v)
+		case json.Number:
+			values[key] = v.String()
+		case int:
+			values[key] = strconv.Itoa(v)
+		case int64:
+			values[key] = strconv.FormatInt(v, 10)
+		case float64:
+			// Whole numbers are written as integers so integer settings accept them
+			if v == math.Trunc(v) {
+				values[key] = strconv.FormatInt(int64(v), 10)
+			} else {
+				values[key] = strconv.FormatFloat(v, 'g', -1, 64)
+			}
+		default:
+			errs = append(errs, fmt.Errorf("invalid value for %q in config file %s: expected a string, number or boolean", key, where))
+		}
+	}
+
+	return values, errs
+}
+
+// parseTOML supports the subset of TOML a flat config needs: key = value pairs,
+// [profiles.<name>] tables, quoted strings, integers, floats, booleans and # comments
+func parseTOML(data []byte) (map[string]any, error) {
+	root := make(map[string]any)
+	profiles := make(map[string]any)
+	current := root
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(stripTOMLComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: malformed table header %q", lineNo, line)
+			}
+			table := strings.TrimSpace(strings.Trim(line, "[]"))
+			name, ok := strings.CutPrefix(table, "profiles.")
+			if !ok || name == "" {
+				return nil, fmt.Errorf("line %d: only [profiles.<name>] tables are supported, got [%s]", lineNo, table)
+			}
+			name = strings.Trim(name, `"`)
+
+			section := make(map[string]any)
+			profiles[name] = section
+			current = section
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value, got %q", lineNo, line)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch {
+		case len(value) >= 2 && (value[0] == '"' && value[len(value)-1] == '"' || value[0] == '\'' && value[len(value)-1] == '\''):
+			current[key] = value[1 : len(value)-1]
+		case value == "true" || value == "false":
+			current[key] = value == "true"
+		default:
+			number := strings.ReplaceAll(value, "_", "")
+			if n, err := strconv.ParseInt(number, 10, 64); err == nil {
+				current[key] = n
+			} else if f, err := strconv.ParseFloat(number, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+				current[key] = f
+			} else {
+				return nil, fmt.Errorf("line %d: value for %q must be a quoted string, a number or a boolean", lineNo, key)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(profiles) > 0 {
+		root["profiles"] = profiles
+	}
+	return root, nil
+}
+
+// stripTOMLComment removes a trailing # comment that is not inside a quoted string
+func stripTOMLComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// joinSorted joins errors in message order so reports are stable across runs
+func joinSorted(errs []error) error {
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Error() < errs[j].Error()
+	})
+	return errors.Join(errs...)
+}
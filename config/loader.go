@@ -0,0 +1,205 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Flags holds the configuration flags registered on a command's FlagSet
+type Flags struct {
+	configFile string
+	profile    string
+	values     []*fieldFlag
+}
+
+// fieldFlag is a flag.Value that checks the value parses when the flag is set, so typos fail at parse time
+type fieldFlag struct {
+	field field
+	value string
+	isSet bool
+}
+
+func (f *fieldFlag) String() string {
+	return f.value
+}
+
+// IsBoolFlag lets boolean settings be given as a bare flag
+func (f *fieldFlag) IsBoolFlag() bool {
+	return f.field.bool
+}
+
+func (f *fieldFlag) Set(value string) error {
+	if err := f.field.set(Default(), value); err != nil {
+		return err
+	}
+	f.value = value
+	f.isSet = true
+	return nil
+}
+
+// Setting is one effective configuration value and the layer it came from
+type Setting struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// RegisterFlags adds -config, -profile and one flag per setting to fs
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	flags := &Flags{}
+	fs.StringVar(&flags.configFile, "config", os.Getenv("APP_CONFIG_FILE"), "config file, .json, .yaml or .toml (env APP_CONFIG_FILE)")
+	fs.StringVar(&flags.profile, "profile", os.Getenv("APP_PROFILE"), fmt.Sprintf("named profile to apply on top of the config file (env APP_PROFILE, built in: %s)", strings.Join(ProfileNames(), ", ")))
+
+	defaults := Default()
+	for _, f := range fields {
+		value := &fieldFlag{field: f}
+		flags.values = append(flags.values, value)
+		fs.Var(value, f.flag, fmt.Sprintf("%s (env %s, default %q)", f.usage, f.env, f.get(defaults)))
+	}
+
+	return flags
+}
+
+// ProfileNames lists the built-in profiles
+func ProfileNames() []string {
+	names := make([]string, 0, len(builtinProfiles))
+	for name := range builtinProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load layers the built-in defaults, the config file, the selected profile, APP_* environment variables
+// and flags, in that order, and validates the result. Every malformed or out-of-range value is reported.
+func Load(flags *Flags) (*Config, error) {
+	config, _, err := load(flags)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Explain returns every effective setting with its source, with cookies and proxy passwords hidden.
+// Settings are returned even when the configuration is invalid so the offending layer can be found.
+func Explain(flags *Flags) ([]Setting, error) {
+	config, sources, err := load(flags)
+
+	settings := make([]Setting, 0, len(fields))
+	for _, f := range fields {
+		value := f.get(config)
+		if f.show != nil {
+			value = f.show(value)
+		}
+		settings = append(settings, Setting{Key: f.key, Value: value, Source: sources[f.key]})
+	}
+	return settings, err
+}
+
+func load(flags *Flags) (*Config, map[string]string, error) {
+	if flags == nil {
+		flags = &Flags{}
+	}
+
+	config := Default()
+	sources := make(map[string]string, len(fields))
+	for _, f := range fields {
+		sources[f.key] = "default"
+	}
+
+	var errs []error
+	apply := func(key, value, source string) {
+		f, _ := fieldByKey(key)
+		if err := f.set(config, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value for %s: %w", describeSource(f, source), err))
+			return
+		}
+		sources[key] = source
+	}
+
+	var file *fileConfig
+	if flags.configFile != "" {
+		var err error
+		if file, err = parseFile(flags.configFile); err != nil {
+			return config, sources, err
+		}
+		for _, key := range sortedKeys(file.values) {
+			apply(key, file.values[key], "file "+file.path)
+		}
+	}
+
+	if flags.profile != "" {
+		profile, source, err := findProfile(flags.profile, file)
+		if err != nil {
+			return config, sources, err
+		}
+		for _, key := range sortedKeys(profile) {
+			apply(key, profile[key], source)
+		}
+	}
+
+	for _, f := range fields {
+		// Set but empty still counts for strings, so APP_X= clears one set in the file; other types ignore it
+		if value, ok := os.LookupEnv(f.env); ok && (value != "" || f.text) {
+			apply(f.key, value, "env "+f.env)
+		}
+	}
+
+	for _, value := range flags.values {
+		if value.isSet {
+			apply(value.field.key, value.value, "flag -"+value.field.flag)
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return config, sources, fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+
+	return config, sources, nil
+}
+
+// findProfile prefers a profile defined in the config file over a built-in one of the same name
+func findProfile(name string, file *fileConfig) (map[string]string, string, error) {
+	if file != nil {
+		if profile, ok := file.profiles[name]; ok {
+			return profile, fmt.Sprintf("profile %s (%s)", name, file.path), nil
+		}
+	}
+	if profile, ok := builtinProfiles[name]; ok {
+		return profile, fmt.Sprintf("profile %s (built-in)", name), nil
+	}
+
+	available := ProfileNames()
+	if file != nil {
+		available = append(available, sortedKeys(file.profiles)...)
+	}
+	return nil, "", fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(available, ", "))
+}
+
+// describeSource names a setting the way the user wrote it in that layer
+func describeSource(f field, source string) string {
+	switch {
+	case strings.HasPrefix(source, "env "):
+		return f.env
+	case strings.HasPrefix(source, "flag "):
+		return "-" + f.flag
+	default:
+		return fmt.Sprintf("%q in %s", f.key, source)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,21 @@
+package config
+
+// builtinProfiles match the tuning sections of the README; a config file profile with the same name replaces them
+var builtinProfiles = map[string]map[string]string{
+	"high-volume": {
+		"max_http_workers":     "500",
+		"rate_limit":           "200",
+		"essay_stream_buffer":  "100",
+		"error_channel_buffer": "500",
+	},
+	"conservative": {
+		"max_http_workers": "10",
+		"rate_limit":       "5",
+		"http_retry_delay": "1s",
+	},
+	"memory-constrained": {
+		"max_http_workers":     "50",
+		"essay_stream_buffer":  "10",
+		"error_channel_buffer": "50",
+	},
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/internal/discovery"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// runDiscover writes the article URLs found in the given sitemaps or index pages, one per line
+func runDiscover(args []string) error {
+	flags := newFlagSet("discover", "source-url...")
+	output := flags.String("o", "-", "write discovered URLs to this path, - for stdout")
+	match := flags.String("match", "", "keep only URLs matching this regular expression (default: same host as the source)")
+	timeout := flags.Duration("timeout", time.Minute, "overall discovery timeout")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	var matchRegex *regexp.Regexp
+	if *match != "" {
+		var err error
+		if matchRegex, err = regexp.Compile(*match); err != nil {
+			return fmt.Errorf("invalid -match expression: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	discoverer := discovery.NewDiscoverer(&http.Client{Timeout: 30 * time.Second}, matchRegex)
+	urls, err := discoverer.Discover(ctx, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	out, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	writer := bufio.NewWriter(out)
+	for _, url := range urls {
+		fmt.Fprintln(writer, url)
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed writing URLs: %w", err)
+	}
+
+	slog.Info("discovered URLs", "urls", len(urls), "sources", flags.NArg())
+	return nil
+}
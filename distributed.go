@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/config"
+	"github.com/ireuven89/firefly-itzik/internal/distributed"
+	"github.com/ireuven89/firefly-itzik/internal/essay"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/processor"
+	"github.com/ireuven89/firefly-itzik/internal/results"
+	"github.com/ireuven89/firefly-itzik/internal/urlnorm"
+	"net/http"
+	"os"
+	"time"
+)
+
+// runCoordinator shards the essays file, serves leases to workers and prints the merged output once every shard is done
+func runCoordinator(args []string) error {
+	flags := newFlagSet("coordinator", "")
+	listen := flags.String("listen", ":8080", "address to serve the worker protocol on")
+	shardSize := flags.Int("shard-size", 100, "number of URLs per lease")
+	leaseTTL := flags.Duration("lease-ttl", 5*time.Minute, "how long a worker may hold a lease before it is reassigned")
+	configFlags := config.RegisterFlags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *shardSize < 1 {
+		return fmt.Errorf("-shard-size must be at least 1, got %d", *shardSize)
+	}
+	if *leaseTTL < time.Second {
+		return fmt.Errorf("-lease-ttl must be at least 1s, got %v", *leaseTTL)
+	}
+
+	cfg, err := config.Load(configFlags)
+	if err != nil {
+		return err
+	}
+	logger := newLogger(cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ProcessTimeout)
+	defer cancel()
+
+	urls, err := essay.ReadURLList(cfg.EssaysFile)
+	if err != nil {
+		return err
+	}
+
+	// Variants of a URL in different shards would be fetched by different workers
+	var urlDuplicates *models.DuplicateReport
+	if cfg.Dedupe {
+		var dropped int
+		urls, dropped = urlnorm.NewNormalizer(config.SplitList(cfg.StripParams)).Unique(urls)
+		urlDuplicates = &models.DuplicateReport{URLs: dropped}
+	}
+
+	coordinator := distributed.NewCoordinator(urls, *shardSize, *leaseTTL)
+	server := &http.Server{Addr: *listen, Handler: coordinator}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("coordinator server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+	logger.Info("coordinator listening", "addr", *listen, "shards", coordinator.Status().TotalShards)
+
+	merged, err := coordinator.Wait(ctx)
+	if err != nil {
+		return fmt.Errorf("coordinator stopped before all shards completed: %w (%+v)", err, coordinator.Status())
+	}
+
+	if urlDuplicates != nil {
+		merged.Add(&results.Result{Duplicates: urlDuplicates})
+	}
+	logDuplicates(logger, merged.Duplicates)
+
+	// Keep answering lease requests with 410 briefly so idle workers learn the run is over
+	time.Sleep(2 * time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	server.Shutdown(shutdownCtx)
+
+	if cfg.ResultFile != "" {
+		if err := results.Save(cfg.ResultFile, merged); err != nil {
+			return fmt.Errorf("failed to save result file: %w", err)
+		}
+	}
+
+	return writeOutput(cfg.OutputFile, cfg.OutputFormat, models.Output{
+		TopWords:         merged.TopWords(cfg.TopWordsCount),
+		TotalEssays:      merged.TotalEssays,
+		TotalErrors:      merged.TotalErrors,
+		ErrorsByCategory: merged.ErrorsByCategory,
+		Duplicates:       merged.Duplicates,
+		NearDuplicates:   merged.NearDuplicates,
+		Timestamp:        time.Now().UTC(),
+	})
+}
+
+// runWorker leases shards from a coordinator and reports their counts until the run is done
+func runWorker(args []string) error {
+	flags := newFlagSet("worker", "")
+	coordinatorURL := flags.String("coordinator", "http://localhost:8080", "coordinator base URL")
+	workerID := flags.String("id", defaultWorkerID(), "worker identifier reported to the coordinator")
+	pollInterval := flags.Duration("poll-interval", time.Second, "wait between lease requests when none is available")
+	configFlags := config.RegisterFlags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(configFlags)
+	if err != nil {
+		return err
+	}
+	logger := newLogger(cfg)
+	m, stopMetrics, err := startMetrics(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ProcessTimeout)
+	defer cancel()
+
+	essayFetcher, _, err := newEssayFetcher(cfg, logger, m)
+	if err != nil {
+		return err
+	}
+	wordBank, err := newWordBank(cfg, logger)
+	if err != nil {
+		return err
+	}
+	options := processorOptions(cfg, logger, m, wordBank)
+	newProcessor := func() processor.WordProcessor {
+		return processor.NewWordProcessorWithOptions(wordBank, options)
+	}
+
+	worker := distributed.NewWorker(*coordinatorURL, *workerID, essayFetcher, newProcessor, *pollInterval, cfg.EssayStreamBuffer, cfg.ErrorChannelBuffer, logger)
+	if err := worker.Run(ctx); err != nil {
+		return fmt.Errorf("worker stopped: %w", err)
+	}
+	return nil
+}
+
+func defaultWorkerID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "worker"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
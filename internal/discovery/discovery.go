@@ -0,0 +1,146 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	locRegex          = regexp.MustCompile(`(?is)<loc>\s*([^<]+?)\s*</loc>`)
+	hrefRegex         = regexp.MustCompile(`(?is)<a[^>]+href\s*=\s*["']([^"']+)["']`)
+	sitemapIndexRegex = regexp.MustCompile(`(?i)<sitemapindex`)
+)
+
+// maxSitemapDepth bounds how far nested sitemap indexes are followed
+const maxSitemapDepth = 2
+
+type Discoverer interface {
+	Discover(ctx context.Context, sources []string) ([]string, error)
+}
+
+type discoverer struct {
+	client *http.Client
+	match  *regexp.Regexp
+}
+
+// NewDiscoverer returns a discoverer that keeps links matching match; with a nil match
+// only links on the same host as the source they were found on are kept
+func NewDiscoverer(client *http.Client, match *regexp.Regexp) Discoverer {
+	return &discoverer{
+		client: client,
+		match:  match,
+	}
+}
+
+// Discover reads each source, an XML sitemap, sitemap index or HTML page, and returns its unique article links in order
+func (d *discoverer) Discover(ctx context.Context, sources []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var links []string
+
+	for _, source := range sources {
+		found, err := d.discoverSource(ctx, source, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, link := range found {
+			if !seen[link] {
+				seen[link] = true
+				links = append(links, link)
+			}
+		}
+	}
+
+	return links, nil
+}
+
+func (d *discoverer) discoverSource(ctx context.Context, source string, depth int) ([]string, error) {
+	base, err := url.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source URL %s: %w", source, err)
+	}
+
+	body, err := d.fetch(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sitemap indexes list further sitemaps rather than articles
+	if sitemapIndexRegex.MatchString(body) {
+		if depth >= maxSitemapDepth {
+			return nil, nil
+		}
+
+		var links []string
+		for _, match := range locRegex.FindAllStringSubmatch(body, -1) {
+			nested, err := d.discoverSource(ctx, strings.TrimSpace(match[1]), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			links = append(links, nested...)
+		}
+		return links, nil
+	}
+
+	matches := locRegex.FindAllStringSubmatch(body, -1)
+	if len(matches) == 0 {
+		matches = hrefRegex.FindAllStringSubmatch(body, -1)
+	}
+
+	var links []string
+	for _, match := range matches {
+		if link, ok := d.resolve(base, match[1]); ok {
+			links = append(links, link)
+		}
+	}
+
+	return links, nil
+}
+
+// resolve makes raw absolute against base, drops fragments and applies the link filter
+func (d *discoverer) resolve(base *url.URL, raw string) (string, bool) {
+	raw = strings.ReplaceAll(strings.TrimSpace(raw), "&amp;", "&")
+	ref, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+
+	link := base.ResolveReference(ref)
+	if link.Scheme != "http" && link.Scheme != "https" {
+		return "", false
+	}
+	link.Fragment = ""
+
+	if d.match != nil {
+		return link.String(), d.match.MatchString(link.String())
+	}
+	return link.String(), strings.EqualFold(link.Host, base.Host)
+}
+
+func (d *discoverer) fetch(ctx context.Context, source string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed fetching source %s: %w", source, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("source %s returned status %d", source, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed reading source %s: %w", source, err)
+	}
+	return string(body), nil
+}
@@ -0,0 +1,249 @@
+package distributed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/internal/results"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type Coordinator interface {
+	http.Handler
+	Status() Status
+	Wait(ctx context.Context) (*results.Result, error)
+}
+
+type shardState int
+
+const (
+	shardPending shardState = iota
+	shardLeased
+	shardCompleted
+)
+
+type shard struct {
+	id        int
+	urls      []string
+	state     shardState
+	leaseID   string
+	expiresAt time.Time
+}
+
+type coordinator struct {
+	mu         sync.Mutex
+	shards     []*shard
+	leases     map[string]*shard
+	leaseTTL   time.Duration
+	leaseSeq   int
+	reassigned int
+	remaining  int
+	result     *results.Result
+	done       chan struct{}
+	mux        *http.ServeMux
+	now        func() time.Time
+}
+
+// NewCoordinator splits urls into shards of shardSize and leases them to workers for leaseTTL at a time
+func NewCoordinator(urls []string, shardSize int, leaseTTL time.Duration) Coordinator {
+	c := &coordinator{
+		leases:   make(map[string]*shard),
+		leaseTTL: leaseTTL,
+		result:   results.NewResult(),
+		done:     make(chan struct{}),
+		mux:      http.NewServeMux(),
+		now:      time.Now,
+	}
+
+	for start := 0; start < len(urls); start += shardSize {
+		end := start + shardSize
+		if end > len(urls) {
+			end = len(urls)
+		}
+		c.shards = append(c.shards, &shard{id: len(c.shards), urls: urls[start:end]})
+	}
+	c.remaining = len(c.shards)
+	if c.remaining == 0 {
+		close(c.done)
+	}
+
+	c.mux.HandleFunc("POST "+LeasePath, c.handleLease)
+	c.mux.HandleFunc("POST "+RenewPath, c.handleRenew)
+	c.mux.HandleFunc("POST "+CompletePath, c.handleComplete)
+	c.mux.HandleFunc("GET "+StatusPath, c.handleStatus)
+
+	return c
+}
+
+func (c *coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mux.ServeHTTP(w, r)
+}
+
+// Wait blocks until every shard is completed and returns the merged counts
+func (c *coordinator) Wait(ctx context.Context) (*results.Result, error) {
+	select {
+	case <-c.done:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *coordinator) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	status := Status{
+		TotalShards:     len(c.shards),
+		ReassignedCount: c.reassigned,
+		Done:            c.remaining == 0,
+	}
+	for _, s := range c.shards {
+		switch {
+		case s.state == shardCompleted:
+			status.CompletedShards++
+		case s.state == shardLeased && now.Before(s.expiresAt):
+			status.LeasedShards++
+		default:
+			status.PendingShards++
+		}
+	}
+
+	return status
+}
+
+func (c *coordinator) handleLease(w http.ResponseWriter, r *http.Request) {
+	var req LeaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid lease request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	lease, done := c.nextLease()
+	if done {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+	if lease == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeJSON(w, lease)
+}
+
+// nextLease hands out the first pending or expired shard
+func (c *coordinator) nextLease() (*Lease, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.remaining == 0 {
+		return nil, true
+	}
+
+	now := c.now()
+	for _, s := range c.shards {
+		if s.state == shardCompleted || (s.state == shardLeased && now.Before(s.expiresAt)) {
+			continue
+		}
+
+		// Expired leases are reassigned; the old lease ID can no longer complete the shard
+		if s.state == shardLeased {
+			delete(c.leases, s.leaseID)
+			c.reassigned++
+		}
+
+		c.leaseSeq++
+		s.state = shardLeased
+		s.leaseID = fmt.Sprintf("%d-%d", s.id, c.leaseSeq)
+		s.expiresAt = now.Add(c.leaseTTL)
+		c.leases[s.leaseID] = s
+
+		return c.leaseOf(s), false
+	}
+
+	return nil, false
+}
+
+func (c *coordinator) leaseOf(s *shard) *Lease {
+	return &Lease{ID: s.leaseID, ShardID: s.id, URLs: s.urls, ExpiresAt: s.expiresAt, TTLMillis: c.leaseTTL.Milliseconds()}
+}
+
+func (c *coordinator) handleRenew(w http.ResponseWriter, r *http.Request) {
+	var req RenewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid renew request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Reassigned and completed leases are no longer known
+	s, ok := c.leases[req.LeaseID]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown lease %s", req.LeaseID), http.StatusNotFound)
+		return
+	}
+	if s.state != shardLeased || s.leaseID != req.LeaseID {
+		http.Error(w, fmt.Sprintf("shard of lease %s is no longer leased to it", req.LeaseID), http.StatusConflict)
+		return
+	}
+
+	s.expiresAt = c.now().Add(c.leaseTTL)
+	writeJSON(w, c.leaseOf(s))
+}
+
+func (c *coordinator) handleComplete(w http.ResponseWriter, r *http.Request) {
+	var req CompleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid complete request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Result == nil {
+		http.Error(w, "complete request is missing a result", http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.leases[req.LeaseID]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown lease %s", req.LeaseID), http.StatusNotFound)
+		return
+	}
+	delete(c.leases, req.LeaseID)
+
+	// An expired lease still completes its shard unless the shard was handed to another worker, which
+	// removes the old lease ID above
+	if s.state != shardLeased || s.leaseID != req.LeaseID {
+		http.Error(w, fmt.Sprintf("shard of lease %s is no longer leased to it", req.LeaseID), http.StatusConflict)
+		return
+	}
+
+	c.result.Add(req.Result)
+	s.state = shardCompleted
+	c.remaining--
+	if c.remaining == 0 {
+		close(c.done)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *coordinator) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, c.Status())
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,59 @@
+package distributed
+
+import (
+	"github.com/ireuven89/firefly-itzik/internal/results"
+	"time"
+)
+
+// HTTP/JSON protocol between the coordinator and its workers:
+//
+//	POST /lease     LeaseRequest    -> 200 Lease | 204 nothing available yet | 410 all shards done
+//	POST /renew     RenewRequest    -> 200 Lease | 404 unknown lease | 409 shard already done
+//	POST /complete  CompleteRequest -> 200 | 404 unknown lease | 409 shard already done
+//	GET  /status                    -> 200 Status
+//
+// A lease that outlives its TTL keeps its shard until another worker leases it, so a late completion is
+// still accepted while the shard is unclaimed. Workers renew their leases to keep long shards.
+const (
+	LeasePath    = "/lease"
+	RenewPath    = "/renew"
+	CompletePath = "/complete"
+	StatusPath   = "/status"
+)
+
+type LeaseRequest struct {
+	WorkerID string `json:"worker_id"`
+}
+
+type Lease struct {
+	ID        string    `json:"id"`
+	ShardID   int       `json:"shard_id"`
+	URLs      []string  `json:"urls"`
+	ExpiresAt time.Time `json:"expires_at"` // by the coordinator's clock
+	TTLMillis int64     `json:"ttl_ms"`     // how long the lease lasts from when it was granted or renewed
+}
+
+// TTL is the lease duration; workers measure it on their own clock so clock skew does not matter
+func (l *Lease) TTL() time.Duration {
+	return time.Duration(l.TTLMillis) * time.Millisecond
+}
+
+type RenewRequest struct {
+	LeaseID  string `json:"lease_id"`
+	WorkerID string `json:"worker_id"`
+}
+
+type CompleteRequest struct {
+	LeaseID  string          `json:"lease_id"`
+	WorkerID string          `json:"worker_id"`
+	Result   *results.Result `json:"result"`
+}
+
+type Status struct {
+	TotalShards     int  `json:"total_shards"`
+	PendingShards   int  `json:"pending_shards"`
+	LeasedShards    int  `json:"leased_shards"`
+	CompletedShards int  `json:"completed_shards"`
+	ReassignedCount int  `json:"reassigned_count"`
+	Done            bool `json:"done"`
+}
@@ -0,0 +1,247 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/internal/essay"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/processor"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	errLeaseExpired = errors.New("lease was not renewed within its TTL")
+	errLeaseLost    = errors.New("coordinator rejected the lease renewal")
+)
+
+type Worker interface {
+	Run(ctx context.Context) error
+}
+
+type worker struct {
+	client         *http.Client
+	coordinatorURL string
+	workerID       string
+	fetcher        essay.EssayFetcher
+	newProcessor   func() processor.WordProcessor
+	pollInterval   time.Duration
+	streamBuffer   int
+	errorBuffer    int
+	logger         *slog.Logger
+}
+
+// NewWorker creates a worker that leases shards from the coordinator until all of them are done.
+// A fresh processor is created per lease so each completion carries only that shard's counts.
+// A nil logger logs to slog.Default().
+func NewWorker(coordinatorURL, workerID string, fetcher essay.EssayFetcher, newProcessor func() processor.WordProcessor, pollInterval time.Duration, streamBuffer, errorBuffer int, logger *slog.Logger) Worker {
+	return &worker{
+		client:         &http.Client{Timeout: 30 * time.Second},
+		coordinatorURL: strings.TrimSuffix(coordinatorURL, "/"),
+		workerID:       workerID,
+		fetcher:        fetcher,
+		newProcessor:   newProcessor,
+		pollInterval:   pollInterval,
+		streamBuffer:   streamBuffer,
+		errorBuffer:    errorBuffer,
+		logger:         logging.OrDefault(logger).With("worker", workerID),
+	}
+}
+
+// Run processes leases until the coordinator reports that every shard is done
+func (w *worker) Run(ctx context.Context) error {
+	for {
+		lease, done, err := w.requestLease(ctx)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		// Nothing to lease right now, other workers hold the remaining shards
+		if lease == nil {
+			select {
+			case <-time.After(w.pollInterval):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if err := w.processLease(ctx, lease); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *worker) processLease(ctx context.Context, lease *Lease) error {
+	leaseCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go w.keepAlive(leaseCtx, lease, cancel)
+
+	essayStream := make(chan models.Essay, w.streamBuffer)
+	errorChan := make(chan error, w.errorBuffer)
+
+	go func() {
+		defer close(essayStream)
+		defer close(errorChan)
+
+		if err := w.fetcher.StreamURLs(leaseCtx, lease.URLs, essayStream, errorChan); err != nil {
+			select {
+			case errorChan <- err:
+			case <-leaseCtx.Done():
+			}
+		}
+	}()
+
+	// Only the full counts are reported back, the coordinator computes the top words
+	wp := w.newProcessor()
+	wp.ProcessEssayStream(leaseCtx, essayStream, errorChan, 0)
+
+	// The shard belongs to another worker now, or will once the coordinator reassigns it
+	if leaseCtx.Err() != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		w.logger.Warn("lease lost before completion, requesting a new one", "lease", lease.ID, "reason", context.Cause(leaseCtx))
+		return nil
+	}
+
+	return w.completeLease(ctx, lease, wp)
+}
+
+// keepAlive renews the lease every third of its TTL until ctx is done. It cancels the lease when the coordinator
+// rejects a renewal, or when renewals kept failing for a whole TTL by the worker's own clock.
+func (w *worker) keepAlive(ctx context.Context, lease *Lease, cancel context.CancelCauseFunc) {
+	ttl := lease.TTL()
+	if ttl <= 0 {
+		return
+	}
+	ticker := time.NewTicker(max(ttl/3, time.Millisecond))
+	defer ticker.Stop()
+
+	expires := time.Now().Add(ttl)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sent := time.Now()
+		renewed, err := w.renewLease(ctx, lease)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return
+		case err != nil && time.Now().After(expires):
+			cancel(fmt.Errorf("%w: %v", errLeaseExpired, err))
+			return
+		case err != nil:
+			w.logger.Warn("failed renewing lease", "lease", lease.ID, "error", err)
+		case !renewed:
+			cancel(errLeaseLost)
+			return
+		default:
+			expires = sent.Add(ttl)
+		}
+	}
+}
+
+// renewLease extends the lease, returning false when the coordinator no longer holds it for this worker
+func (w *worker) renewLease(ctx context.Context, lease *Lease) (bool, error) {
+	resp, err := w.post(ctx, RenewPath, RenewRequest{LeaseID: lease.ID, WorkerID: w.workerID})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusConflict, http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("coordinator returned status %d renewing lease %s", resp.StatusCode, lease.ID)
+	}
+}
+
+func (w *worker) requestLease(ctx context.Context) (*Lease, bool, error) {
+	resp, err := w.post(ctx, LeasePath, LeaseRequest{WorkerID: w.workerID})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed requesting lease: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var lease Lease
+		if err := json.NewDecoder(resp.Body).Decode(&lease); err != nil {
+			return nil, false, fmt.Errorf("failed decoding lease: %w", err)
+		}
+		return &lease, false, nil
+	case http.StatusNoContent:
+		return nil, false, nil
+	case http.StatusGone:
+		return nil, true, nil
+	default:
+		return nil, false, fmt.Errorf("coordinator returned status %d for lease request", resp.StatusCode)
+	}
+}
+
+func (w *worker) completeLease(ctx context.Context, lease *Lease, wp processor.WordProcessor) error {
+	result := wp.Result()
+	result.Duplicates = w.fetcher.Duplicates()
+	result.NearDuplicates = wp.NearDuplicateReport()
+	resp, err := w.post(ctx, CompletePath, CompleteRequest{
+		LeaseID:  lease.ID,
+		WorkerID: w.workerID,
+		Result:   result,
+	})
+	if err != nil {
+		return fmt.Errorf("failed completing lease %s: %w", lease.ID, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict, http.StatusNotFound:
+		// Lease was reassigned meanwhile; the shard will be counted by whoever holds it now
+		w.logger.Warn("lease was rejected by coordinator", "lease", lease.ID, "status", resp.StatusCode)
+		return nil
+	default:
+		return fmt.Errorf("coordinator returned status %d completing lease %s", resp.StatusCode, lease.ID)
+	}
+}
+
+func (w *worker) post(ctx context.Context, path string, body any) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.coordinatorURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drain error bodies so the connection can be reused
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+	}
+	return resp, nil
+}
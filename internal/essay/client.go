@@ -0,0 +1,172 @@
+package essay
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// HTTP client defaults
+const (
+	DefaultTimeout        = 10 * time.Second
+	DefaultConnectTimeout = 10 * time.Second
+)
+
+// ClientOptions configure the HTTP client every request, robots.txt included, goes through
+type ClientOptions struct {
+	Headers        http.Header    // sent with every request; UserAgent overrides a User-Agent header
+	Cookies        []*http.Cookie // sent with every request to every host
+	Proxy          *url.URL       // nil uses HTTP_PROXY, HTTPS_PROXY and NO_PROXY from the environment
+	Timeout        time.Duration  // whole request including the body, 0 for DefaultTimeout
+	ConnectTimeout time.Duration  // dialing and the TLS handshake, 0 for DefaultConnectTimeout
+	RootCAs        *x509.CertPool // nil trusts the system CAs
+	DisableHTTP2   bool
+	// Transport, when set, wraps or replaces the network transport, e.g. to record or replay fixtures
+	Transport func(base http.RoundTripper) http.RoundTripper
+}
+
+// newClient builds the client described by options, validating redirects with the response policy
+func newClient(options Options) *http.Client {
+	client := options.Client
+	timeout := client.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	connectTimeout := client.ConnectTimeout
+	if connectTimeout == 0 {
+		connectTimeout = DefaultConnectTimeout
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		MaxIdleConns:          500,
+		MaxIdleConnsPerHost:   100,
+		IdleConnTimeout:       30 * time.Second,
+		DisableKeepAlives:     false,
+		DisableCompression:    false,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: timeout,
+		// A custom dialer or TLS config turns off HTTP/2 unless it is asked for
+		ForceAttemptHTTP2: !client.DisableHTTP2,
+	}
+	if client.Proxy != nil {
+		transport.Proxy = http.ProxyURL(client.Proxy)
+	}
+	if client.RootCAs != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: client.RootCAs}
+	}
+	if client.DisableHTTP2 {
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	var base http.RoundTripper = transport
+	if client.Transport != nil {
+		base = client.Transport(transport)
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &headerTransport{
+			base:      base,
+			headers:   client.Headers,
+			cookies:   client.Cookies,
+			userAgent: options.UserAgent,
+		},
+		CheckRedirect: options.Response.checkRedirect,
+	}
+}
+
+// headerTransport adds the configured headers, cookies and User-Agent to each request, redirects included
+type headerTransport struct {
+	base      http.RoundTripper
+	headers   http.Header
+	cookies   []*http.Cookie
+	userAgent string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.headers) == 0 && len(t.cookies) == 0 && t.userAgent == "" {
+		return t.base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the caller's request
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		req.Header[name] = values
+	}
+	for _, cookie := range t.cookies {
+		req.AddCookie(cookie)
+	}
+	if t.userAgent != "" {
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// ReadHeaders reads "Name: value" lines from path; blank lines and lines starting with # are skipped
+func ReadHeaders(path string) (http.Header, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	headers := make(http.Header)
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("%s:%d: expected \"Name: value\", got %q", path, lineNo, line)
+		}
+		headers.Add(name, strings.TrimSpace(value))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+// ParseCookies parses cookies written as in a Cookie header, "name=value; name2=value2"
+func ParseCookies(value string) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	for _, pair := range strings.Split(value, ";") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t,") {
+			return nil, fmt.Errorf("invalid cookie %q: expected name=value", pair)
+		}
+		cookies = append(cookies, &http.Cookie{Name: name, Value: strings.TrimSpace(value)})
+	}
+	return cookies, nil
+}
+
+// LoadCABundle returns the system CAs plus the PEM certificates in path
+func LoadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,119 @@
+package essay
+
+import (
+	"crypto/sha256"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/urlnorm"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	canonicalLinkRegex = regexp.MustCompile(`(?is)<link\b[^>]*\brel\s*=\s*["']?canonical["']?[^>]*>`)
+	hrefRegex          = regexp.MustCompile(`(?is)\bhref\s*=\s*["']([^"']+)["']`)
+)
+
+// Reasons an essay is collapsed into an earlier one
+const (
+	duplicateCanonical = "canonical"
+	duplicateContent   = "content"
+)
+
+// dedupe tracks what one StreamURLs call has dispatched and emitted
+type dedupe struct {
+	normalizer *urlnorm.Normalizer
+
+	mu        sync.Mutex
+	urls      map[string]bool // keys of dispatched URLs
+	canonical map[string]bool // keys of the canonical URLs of emitted essays
+	content   map[[sha256.Size]byte]bool
+	report    models.DuplicateReport
+}
+
+func newDedupe(normalizer *urlnorm.Normalizer) *dedupe {
+	return &dedupe{
+		normalizer: normalizer,
+		urls:       make(map[string]bool),
+		canonical:  make(map[string]bool),
+		content:    make(map[[sha256.Size]byte]bool),
+	}
+}
+
+// dispatch returns the normalized URL to fetch, or false when a variant of it was already dispatched.
+// URLs that cannot be normalized are fetched as they are, so fetching reports them.
+func (d *dedupe) dispatch(raw string) (string, bool) {
+	normalized, err := d.normalizer.Normalize(raw)
+	if err != nil {
+		return raw, true
+	}
+	key := urlnorm.Key(normalized)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.urls[key] {
+		d.report.URLs++
+		return "", false
+	}
+	d.urls[key] = true
+	return normalized, true
+}
+
+// emit records essay and returns why it duplicates an essay already emitted, or "" when it does not.
+// An essay without a canonical link is its own canonical URL.
+func (d *dedupe) emit(essay *models.Essay) string {
+	canonical := essay.CanonicalURL
+	if canonical == "" {
+		canonical = essay.URL
+		if essay.FinalURL != "" {
+			canonical = essay.FinalURL
+		}
+	}
+	key := canonical
+	if normalized, err := d.normalizer.Normalize(canonical); err == nil {
+		key = urlnorm.Key(normalized)
+	}
+	sum := sha256.Sum256([]byte(essay.Content))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case d.canonical[key]:
+		d.report.Canonical++
+		return duplicateCanonical
+	case d.content[sum]:
+		d.report.Content++
+		return duplicateContent
+	}
+	d.canonical[key] = true
+	d.content[sum] = true
+	return ""
+}
+
+func (d *dedupe) snapshot() models.DuplicateReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.report
+}
+
+// canonicalLink returns the absolute <link rel="canonical"> target of a page fetched from base, or ""
+func canonicalLink(htmlContent, base string) string {
+	tag := canonicalLinkRegex.FindString(htmlContent)
+	if tag == "" {
+		return ""
+	}
+	matches := hrefRegex.FindStringSubmatch(tag)
+	if len(matches) < 2 {
+		return ""
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	link, err := baseURL.Parse(strings.TrimSpace(matches[1]))
+	if err != nil || (link.Scheme != "http" && link.Scheme != "https") {
+		return ""
+	}
+	return link.String()
+}
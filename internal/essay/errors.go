@@ -0,0 +1,107 @@
+package essay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"net"
+)
+
+// Kinds of fetch failure; errors.Is(err, ErrNotFound) and so on match a *FetchError of that kind
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrHTTPStatus        = errors.New("unexpected HTTP status")
+	ErrTimeout           = errors.New("timed out")
+	ErrConnection        = errors.New("connection failed")
+	ErrBodyRead          = errors.New("reading response body failed")
+	ErrExtraction        = errors.New("no content extracted")
+	ErrRateLimitCanceled = errors.New("canceled while waiting for the rate limiter")
+	ErrBodyTooLarge      = errors.New("response body too large")
+	ErrContentType       = errors.New("content type not accepted")
+	ErrRedirect          = errors.New("redirect not followed")
+	ErrDecompression     = errors.New("response body could not be decompressed")
+	ErrDisallowed        = errors.New("disallowed by robots.txt")
+	ErrInvalidURL        = errors.New("invalid URL")
+)
+
+// errEmptyBody is the cause of an ErrExtraction for a 200 response without a body
+var errEmptyBody = errors.New("empty response body")
+
+// categories names each kind in failure reports
+var categories = map[error]string{
+	ErrNotFound:          "not_found",
+	ErrHTTPStatus:        "http_status",
+	ErrTimeout:           "timeout",
+	ErrConnection:        "connection",
+	ErrBodyRead:          "body_read",
+	ErrExtraction:        "extraction",
+	ErrRateLimitCanceled: "rate_limit_canceled",
+	ErrBodyTooLarge:      "body_too_large",
+	ErrContentType:       "content_type",
+	ErrRedirect:          "redirect",
+	ErrDecompression:     "decompression",
+	ErrDisallowed:        "robots_disallowed",
+	ErrInvalidURL:        "invalid_url",
+}
+
+// FetchError is an essay that could not be fetched, with the URL and every attempt made
+type FetchError struct {
+	Kind    error // one of the Err* kinds above
+	URL     string
+	Status  int              // final status: that of the last response, 0 if none was received
+	History []models.Attempt // HTTP attempts in order, empty if none was made
+	Err     error            // underlying cause, if any
+}
+
+func (e *FetchError) Error() string {
+	msg := fmt.Sprintf("fetch %s: %v", e.URL, e.Kind)
+	if e.Status != 0 {
+		msg += fmt.Sprintf(" (status %d)", e.Status)
+	}
+	if len(e.History) > 1 {
+		msg += fmt.Sprintf(" after %d attempts", len(e.History))
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *FetchError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// Category is the report name of the error's kind
+func (e *FetchError) Category() string {
+	return Category(e.Kind)
+}
+
+// Category is the report name of one of the Err* kinds
+func Category(kind error) string {
+	return categories[kind]
+}
+
+// Failure describes the error for failure reports
+func (e *FetchError) Failure() models.Failure {
+	return models.Failure{
+		URL:      e.URL,
+		Category: e.Category(),
+		Status:   e.Status,
+		Attempts: len(e.History),
+		History:  e.History,
+		Message:  e.Error(),
+	}
+}
+
+// transportKind tells timeouts from other failures to get a response
+func transportKind(err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrTimeout
+	}
+	return ErrConnection
+}
@@ -2,51 +2,104 @@ package essay
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/metrics"
 	"github.com/ireuven89/firefly-itzik/internal/models"
 	"github.com/ireuven89/firefly-itzik/internal/rateLimiter"
-	"io"
+	"github.com/ireuven89/firefly-itzik/internal/robots"
+	"github.com/ireuven89/firefly-itzik/internal/urlnorm"
+	"log/slog"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// maxAttempts bounds the requests made for one URL
+const maxAttempts = 3
+
+// DefaultUserAgent identifies the fetcher to servers and robots.txt
+const DefaultUserAgent = "firefly-itzik/1.0"
+
 type EssayFetcher interface {
 	StreamEssays(ctx context.Context, essayStream chan<- models.Essay, errorChan chan<- error) error
+	StreamURLs(ctx context.Context, essayURLs []string, essayStream chan<- models.Essay, errorChan chan<- error) error
+	SetMaxWorkers(maxWorkers int)
+	MaxWorkers() int
+	// Duplicates counts what the latest StreamEssays or StreamURLs call collapsed; nil when deduplication is off
+	Duplicates() *models.DuplicateReport
+}
+
+// Options configure how responses are fetched and validated
+type Options struct {
+	Client    ClientOptions
+	Response  ResponsePolicy
+	UserAgent string // sent with every request and matched against robots.txt groups; empty sends Go's default
+	Robots    bool   // skip URLs robots.txt disallows and space requests by its Crawl-delay
+	// Dedupe normalizes URLs, fetching each once, and drops essays whose canonical URL or text was already emitted
+	Dedupe      bool
+	StripParams []string // query parameters Dedupe removes, see urlnorm.NewNormalizer
+}
+
+// DefaultOptions are the options NewEssayFetcher uses; robots.txt is not consulted and nothing is deduplicated
+func DefaultOptions() Options {
+	return Options{Response: DefaultResponsePolicy(), UserAgent: DefaultUserAgent}
 }
 
 type essayFetcher struct {
-	client        *http.Client
-	rateLimiter   rateLimiter.RateLimiter
-	filePath      string
-	maxWorkers    int
-	retryDelay    time.Duration
+	client      *http.Client
+	policy      ResponsePolicy
+	robots      robots.Checker // nil when robots.txt is not consulted
+	hosts       rateLimiter.HostLimiter
+	normalizer  *urlnorm.Normalizer // nil when deduplication is off
+	dedupe      atomic.Pointer[dedupe]
+	rateLimiter rateLimiter.RateLimiter
+	filePath    string
+	workers     *workerLimit
+	retryDelay  time.Duration
+	logger      *slog.Logger
+	metrics     *metrics.Metrics
+}
+
+// NewEssayFetcher creates a fetcher with DefaultOptions; a nil logger logs to slog.Default() and nil metrics record nothing
+func NewEssayFetcher(rateLimiter rateLimiter.RateLimiter, filePath string, maxWorkers int, retryDelay time.Duration, logger *slog.Logger, m *metrics.Metrics) EssayFetcher {
+	return NewEssayFetcherWithOptions(rateLimiter, filePath, maxWorkers, retryDelay, logger, m, DefaultOptions())
 }
 
-func NewEssayFetcher(rateLimiter rateLimiter.RateLimiter, filePath string, maxWorkers int, retryDelay time.Duration) EssayFetcher {
-	transport := &http.Transport{
-		MaxIdleConns:          500,
-		MaxIdleConnsPerHost:   100,
-		IdleConnTimeout:       30 * time.Second,
-		DisableKeepAlives:     false,
-		DisableCompression:    false,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ResponseHeaderTimeout: 10 * time.Second,
+func NewEssayFetcherWithOptions(limiter rateLimiter.RateLimiter, filePath string, maxWorkers int, retryDelay time.Duration, logger *slog.Logger, m *metrics.Metrics, options Options) EssayFetcher {
+	client := newClient(options)
+	logger = logging.OrDefault(logger)
+
+	var checker robots.Checker
+	if options.Robots {
+		checker = robots.NewChecker(client, options.UserAgent, logger)
+	}
+	var normalizer *urlnorm.Normalizer
+	if options.Dedupe {
+		normalizer = urlnorm.NewNormalizer(options.StripParams)
 	}
 
 	return &essayFetcher{
-		client: &http.Client{
-			Timeout:   10 * time.Second,
-			Transport: transport,
-		},
-		rateLimiter: rateLimiter,
+		client:      client,
+		policy:      options.Response,
+		robots:      checker,
+		hosts:       rateLimiter.NewHostLimiter(),
+		normalizer:  normalizer,
+		rateLimiter: limiter,
 		filePath:    filePath,
-		maxWorkers:  maxWorkers,
+		workers:     newWorkerLimit(maxWorkers),
 		retryDelay:  retryDelay,
+		logger:      logger,
+		metrics:     m,
 	}
 }
 
@@ -57,111 +110,259 @@ func (ef *essayFetcher) StreamEssays(ctx context.Context, essayStream chan<- mod
 		return fmt.Errorf("failed to read essay list: %w", err)
 	}
 
-	// Create channel for workers
-	urlChan := make(chan string, ef.maxWorkers)
+	return ef.StreamURLs(ctx, essayURLs, essayStream, errorChan)
+}
 
-	// Start workers
+// StreamURLs fetches the given URLs concurrently, sending essays and errors to the provided channels.
+// At most maxWorkers fetches run at once; the limit can be changed with SetMaxWorkers while streaming.
+func (ef *essayFetcher) StreamURLs(ctx context.Context, essayURLs []string, essayStream chan<- models.Essay, errorChan chan<- error) error {
 	var wg sync.WaitGroup
-	numWorkers := ef.maxWorkers
-	if len(essayURLs) < ef.maxWorkers {
-		numWorkers = len(essayURLs)
-	}
-
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go ef.essayWorker(ctx, urlChan, essayStream, errorChan, &wg)
+	var d *dedupe
+	if ef.normalizer != nil {
+		d = newDedupe(ef.normalizer)
+		ef.dedupe.Store(d)
 	}
 
-	// Send URLs to workers
-	go func() {
-		defer close(urlChan)
-		for _, url := range essayURLs {
-			select {
-			case urlChan <- url:
-			case <-ctx.Done():
-				return
+	for _, url := range essayURLs {
+		if d != nil {
+			normalized, ok := d.dispatch(url)
+			if !ok {
+				ef.logger.Debug("skipped duplicate URL", "url", url)
+				continue
 			}
+			url = normalized
+		}
+		if err := ef.workers.acquire(ctx); err != nil {
+			break
 		}
-	}()
 
-	// Wait for all workers to complete
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			defer ef.workers.release()
+
+			ef.fetchAndSend(ctx, url, d, essayStream, errorChan)
+		}(url)
+	}
+
+	// Wait for all fetches to complete
 	wg.Wait()
 	return nil
 }
 
-func (ef *essayFetcher) essayWorker(ctx context.Context, urlChan <-chan string, resultChan chan<- models.Essay, errorChan chan<- error, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	for {
-		select {
-		case url, ok := <-urlChan:
-			if !ok {
-				return
-			}
+// SetMaxWorkers changes how many fetches may run concurrently; running fetches are not interrupted
+func (ef *essayFetcher) SetMaxWorkers(maxWorkers int) {
+	ef.workers.setLimit(maxWorkers)
+}
 
-			essay, err := ef.fetchSingleEssay(ctx, url)
-			if err != nil {
-				errorChan <- err
-				continue
-			}
+func (ef *essayFetcher) MaxWorkers() int {
+	return ef.workers.getLimit()
+}
 
-			resultChan <- *essay
+func (ef *essayFetcher) Duplicates() *models.DuplicateReport {
+	if ef.normalizer == nil {
+		return nil
+	}
+	var report models.DuplicateReport
+	if d := ef.dedupe.Load(); d != nil {
+		report = d.snapshot()
+	}
+	return &report
+}
 
-		case <-ctx.Done():
+// fetchAndSend fetches url and sends the essay unless d, when set, finds it duplicates one already sent
+func (ef *essayFetcher) fetchAndSend(ctx context.Context, url string, d *dedupe, resultChan chan<- models.Essay, errorChan chan<- error) {
+	// Sends also watch ctx so fetches don't block once the consumer has stopped reading
+	essay, err := ef.fetchSingleEssay(ctx, url)
+	if err != nil {
+		// Errors caused by ctx ending are still reported when the channel has room
+		select {
+		case errorChan <- err:
+		default:
+			select {
+			case errorChan <- err:
+			case <-ctx.Done():
+			}
+		}
+		return
+	}
+	if d != nil {
+		if reason := d.emit(essay); reason != "" {
+			ef.logger.Debug("skipped duplicate essay", "url", url, "reason", reason, "canonical_url", essay.CanonicalURL)
 			return
 		}
 	}
+
+	select {
+	case resultChan <- *essay:
+	case <-ctx.Done():
+	}
 }
 
 func (ef *essayFetcher) fetchSingleEssay(ctx context.Context, url string) (*models.Essay, error) {
-	if err := ef.rateLimiter.Wait(ctx); err != nil {
+	crawlDelay, err := ef.checkRobots(ctx, url)
+	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	waitStart := time.Now()
+	if err := ef.rateLimiter.Wait(ctx); err != nil {
+		return nil, &FetchError{Kind: ErrRateLimitCanceled, URL: url, Err: err}
+	}
+	ef.metrics.LimiterWait(time.Since(waitStart))
+
+	body, history, err := ef.fetchBody(ctx, url, crawlDelay)
 	if err != nil {
 		return nil, err
 	}
+	finalURL := history[len(history)-1].FinalURL
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, &FetchError{Kind: ErrExtraction, URL: url, Status: http.StatusOK, History: history, Err: errEmptyBody}
+	}
 
-	//retry mechanism
-	maxRetries := 3
-	var resp *http.Response
-	var body []byte
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		resp, err = ef.client.Do(req)
-		if err == nil && resp.StatusCode == http.StatusOK {
-			body, err = io.ReadAll(resp.Body)
-			if err != nil {
-				fmt.Printf("failed reading %s reponse body %v\n", url, err)
-				return nil, fmt.Errorf("failed parsing resp body")
-			}
-			break
+	// Extract title and content from HTML (not JSON)
+	title := ef.extractTitle(string(body))
+	content, strategy := ef.extractContent(string(body))
+	ef.metrics.Extraction(strategy)
+	if strategy == metrics.ExtractionParagraphs {
+		ef.logger.Debug("no article container found, falling back to paragraph extraction", "url", url)
+	}
+	if content == "" {
+		return nil, &FetchError{Kind: ErrExtraction, URL: url, Status: http.StatusOK, History: history}
+	}
+
+	// Extract text content from HTML if needed
+	essay := &models.Essay{
+		URL:          url,
+		Title:        title,
+		Content:      content,
+		FinalURL:     finalURL,
+		CanonicalURL: canonicalLink(string(body), cmp.Or(finalURL, url)),
+	}
+
+	return essay, nil
+}
+
+// fetchBody requests url until it answers 200, fails in a way retrying cannot fix or runs out of attempts.
+// It returns the body with every attempt made; any other outcome is a *FetchError with the final status.
+// Attempts to one host are spaced at least crawlDelay apart.
+func (ef *essayFetcher) fetchBody(ctx context.Context, url string, crawlDelay time.Duration) ([]byte, []models.Attempt, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, &FetchError{Kind: ErrInvalidURL, URL: url, Err: err}
+	}
+
+	var history []models.Attempt
+	fail := func(kind error, status int, cause error) error {
+		return &FetchError{Kind: kind, URL: url, Status: status, History: history, Err: cause}
+	}
+	reject := func(v *FetchError, status int) error {
+		return fail(v.Kind, status, v.Err)
+	}
+
+	for {
+		if err := ef.hosts.Wait(ctx, req.URL.Host, crawlDelay); err != nil {
+			return nil, history, fail(ErrRateLimitCanceled, 0, err)
 		}
+		start := time.Now()
+		resp, err := ef.client.Do(req)
+		attempt := models.Attempt{Duration: time.Since(start)}
 		if resp != nil {
-			resp.Body.Close()
+			attempt.Status = resp.StatusCode
+			if final := resp.Request.URL.String(); final != url {
+				attempt.FinalURL = final
+			}
 		}
-		// Don't retry 404s
-		if resp != nil && resp.StatusCode == 404 {
-			fmt.Printf("essay %s returned status 404 (not found)\n", url)
-			return nil, fmt.Errorf("essay %s returned status 404 (not found)", url)
+		if err != nil {
+			attempt.Error = err.Error()
 		}
-		if attempt < maxRetries-1 {
-			time.Sleep(ef.retryDelay)
+		history = append(history, attempt)
+		ef.metrics.FetchAttempt(attempt.Status, attempt.Duration, len(history) > 1)
+		logger := ef.logger.With("url", url, "attempt", len(history), "duration", attempt.Duration)
+
+		var failure error
+		var retry bool
+		var redirectErr *redirectError
+		switch {
+		case errors.As(err, &redirectErr):
+			logger.Warn("redirect not followed", "status", attempt.Status, "location", resp.Header.Get("Location"), "reason", redirectErr)
+			return nil, history, fail(ErrRedirect, attempt.Status, redirectErr)
+		case err != nil:
+			logger.Warn("fetch attempt failed", "error", err)
+			failure, retry = fail(transportKind(err), 0, err), ctx.Err() == nil
+		case resp.StatusCode == http.StatusOK:
+			if v := ef.policy.checkHeaders(resp); v != nil {
+				resp.Body.Close()
+				logger.Warn("response rejected", "status", resp.StatusCode, "category", v.Category(), "error", v.Err)
+				return nil, history, reject(v, resp.StatusCode)
+			}
+			body, v := ef.policy.readBody(resp)
+			resp.Body.Close()
+			ef.metrics.FetchBytes(len(body))
+			// Without a Content-Type header, the type is sniffed from the body as browsers do
+			if v == nil && resp.Header.Get("Content-Type") == "" && len(bytes.TrimSpace(body)) > 0 {
+				v = ef.policy.checkContentType(http.DetectContentType(body))
+			}
+			if v != nil {
+				logger.Warn("response rejected", "status", resp.StatusCode, "category", v.Category(), "error", v.Err)
+				return nil, history, reject(v, resp.StatusCode)
+			}
+			logger.Debug("fetched essay", "status", resp.StatusCode, "bytes", len(body), "final_url", attempt.FinalURL)
+			return body, history, nil
+		case resp.StatusCode == http.StatusNotFound:
+			resp.Body.Close()
+			logger.Info("essay not found", "status", resp.StatusCode)
+			return nil, history, fail(ErrNotFound, resp.StatusCode, nil)
+		default:
+			resp.Body.Close()
+			logger.Warn("fetch attempt failed", "status", resp.StatusCode)
+			failure, retry = fail(ErrHTTPStatus, resp.StatusCode, nil), retryableStatus(resp.StatusCode)
+		}
+
+		if !retry || len(history) == maxAttempts || !sleep(ctx, ef.retryDelay) {
+			return nil, history, failure
 		}
 	}
+}
 
-	// Extract title and content from HTML (not JSON)
-	title := ef.extractTitle(string(body))
-	content := ef.extractTextContent(string(body))
+// checkRobots returns the Crawl-delay of url's host, or a *FetchError when robots.txt disallows url.
+// Malformed URLs pass so fetching reports them.
+func (ef *essayFetcher) checkRobots(ctx context.Context, url string) (time.Duration, error) {
+	if ef.robots == nil {
+		return 0, nil
+	}
+	u, err := neturl.Parse(url)
+	if err != nil || u.Host == "" {
+		return 0, nil
+	}
 
-	// Extract text content from HTML if needed
-	essay := &models.Essay{
-		URL:     url,
-		Title:   title,
-		Content: content,
+	rules, err := ef.robots.Rules(ctx, u)
+	if err != nil {
+		return 0, &FetchError{Kind: transportKind(err), URL: url, Err: fmt.Errorf("robots.txt: %w", err)}
 	}
+	if allowed, rule := rules.Allowed(u); !allowed {
+		ef.logger.Info("skipped by robots.txt", "url", url, "rule", rule)
+		return 0, &FetchError{Kind: ErrDisallowed, URL: url, Err: fmt.Errorf("matched %q", rule)}
+	}
+	return rules.CrawlDelay, nil
+}
 
-	return essay, nil
+// retryableStatus reports whether a later attempt may succeed: the server was overloaded or failed
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// sleep waits for d and reports whether ctx is still live
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
 func (ef *essayFetcher) extractTitle(htmlContent string) string {
@@ -183,6 +384,12 @@ func (ef *essayFetcher) extractTitle(htmlContent string) string {
 }
 
 func (ef *essayFetcher) extractTextContent(htmlContent string) string {
+	content, _ := ef.extractContent(htmlContent)
+	return content
+}
+
+// extractContent returns the article text and the extraction strategy that produced it
+func (ef *essayFetcher) extractContent(htmlContent string) (string, string) {
 	// Try to find main article content, excluding headers
 	articlePatterns := []string{
 		`(?is)<div[^>]*class="[^"]*article-body[^"]*"[^>]*>(.*)</div>\s*(?:<footer|</body)`,
@@ -204,13 +411,12 @@ func (ef *essayFetcher) extractTextContent(htmlContent string) string {
 		regex := regexp.MustCompile(pattern)
 		if matches := regex.FindStringSubmatch(htmlContent); len(matches) > 1 {
 			content := matches[1]
-			return ef.cleanTextContent(content)
+			return ef.cleanTextContent(content), metrics.ExtractionContainer
 		}
 	}
 
 	// Fallback: extract paragraphs only (skip headings)
-	fmt.Printf("falling back to paragraph extraction")
-	return ef.extractParagraphsOnly(htmlContent)
+	return ef.extractParagraphsOnly(htmlContent), metrics.ExtractionParagraphs
 }
 
 func (ef *essayFetcher) extractParagraphsOnly(htmlContent string) string {
@@ -270,9 +476,20 @@ func (ef *essayFetcher) cleanTextContent(content string) string {
 }
 
 func (ef *essayFetcher) readEssayListFromFile() ([]string, error) {
-	file, err := os.Open(ef.filePath)
+	urls, err := ReadURLList(ef.filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	ef.logger.Info("read essay URLs", "count", len(urls), "file", ef.filePath)
+	return urls, nil
+}
+
+// ReadURLList reads one URL per line, skipping empty lines and comments
+func ReadURLList(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open essay list file %s: %w", ef.filePath, err)
+		return nil, fmt.Errorf("failed to open essay list file %s: %w", filePath, err)
 	}
 	defer file.Close()
 
@@ -291,6 +508,5 @@ func (ef *essayFetcher) readEssayListFromFile() ([]string, error) {
 		return nil, fmt.Errorf("error reading essay list file: %w", err)
 	}
 
-	fmt.Printf("Found %d essay URLs in %s\n", len(urls), ef.filePath)
 	return urls, nil
 }
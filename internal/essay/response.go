@@ -0,0 +1,157 @@
+package essay
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Response policy defaults
+const (
+	DefaultMaxBodyBytes = 10 << 20 // 10MB
+	DefaultMaxRedirects = 10
+)
+
+// DefaultContentTypes are the media types the HTML extractor can read
+var DefaultContentTypes = []string{"text/html", "application/xhtml+xml"}
+
+// ResponsePolicy bounds which responses are read and handed to the extractor
+type ResponsePolicy struct {
+	MaxBodyBytes       int64    // limit on the decoded body, 0 for none
+	ContentTypes       []string // accepted media types, "type/*" matches a whole type; empty accepts any
+	MaxRedirects       int      // redirects followed per request, 0 follows none
+	CrossHostRedirects bool     // follow redirects to another host
+}
+
+// DefaultResponsePolicy reads HTML bodies up to DefaultMaxBodyBytes and follows up to DefaultMaxRedirects redirects anywhere
+func DefaultResponsePolicy() ResponsePolicy {
+	return ResponsePolicy{
+		MaxBodyBytes:       DefaultMaxBodyBytes,
+		ContentTypes:       DefaultContentTypes,
+		MaxRedirects:       DefaultMaxRedirects,
+		CrossHostRedirects: true,
+	}
+}
+
+// redirectError stops the client at a redirect the policy forbids
+type redirectError struct {
+	reason string
+}
+
+func (e *redirectError) Error() string {
+	return e.reason
+}
+
+// checkRedirect is the client's CheckRedirect; via holds the requests already made, oldest first
+func (p ResponsePolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > p.MaxRedirects {
+		return &redirectError{reason: fmt.Sprintf("stopped after %d redirects", p.MaxRedirects)}
+	}
+	if from := via[0].URL; !p.CrossHostRedirects && !strings.EqualFold(req.URL.Hostname(), from.Hostname()) {
+		return &redirectError{reason: fmt.Sprintf("redirect from host %s to %s", from.Hostname(), req.URL.Hostname())}
+	}
+	return nil
+}
+
+// violation is a response the policy rejects; fetchBody completes it with the URL, status and history
+func violation(kind, cause error) *FetchError {
+	return &FetchError{Kind: kind, Err: cause}
+}
+
+// checkHeaders rejects a 200 response before its body is read
+func (p ResponsePolicy) checkHeaders(resp *http.Response) *FetchError {
+	// Bodies in any other encoding would reach the extractor still encoded
+	if encoding := contentEncoding(resp); !slices.Contains(decodableEncodings, encoding) {
+		return violation(ErrDecompression, fmt.Errorf("unsupported content encoding %q", encoding))
+	}
+	if p.MaxBodyBytes > 0 && resp.ContentLength > p.MaxBodyBytes {
+		return violation(ErrBodyTooLarge, fmt.Errorf("content length %d exceeds %d bytes", resp.ContentLength, p.MaxBodyBytes))
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		return p.checkContentType(contentType)
+	}
+	return nil
+}
+
+// checkContentType matches a Content-Type header, or one sniffed from the body, against the allowlist
+func (p ResponsePolicy) checkContentType(contentType string) *FetchError {
+	if len(p.ContentTypes) == 0 {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return violation(ErrContentType, fmt.Errorf("malformed content type %q: %w", contentType, err))
+	}
+	for _, allowed := range p.ContentTypes {
+		if strings.EqualFold(allowed, mediaType) {
+			return nil
+		}
+		if kind, ok := strings.CutSuffix(allowed, "/*"); ok && strings.EqualFold(kind, strings.Split(mediaType, "/")[0]) {
+			return nil
+		}
+	}
+	return violation(ErrContentType, fmt.Errorf("content type %s not accepted", mediaType))
+}
+
+// decodableEncodings are the Content-Encodings readBody decodes; "" is none
+var decodableEncodings = []string{"", "identity", "gzip", "x-gzip", "deflate"}
+
+func contentEncoding(resp *http.Response) string {
+	return strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+}
+
+// decodedBody undoes a Content-Encoding the transport left in place, reporting whether the body is decoded at
+// all. The transport only decodes the gzip it asked for itself, so a configured Accept-Encoding header leaves
+// gzip and deflate bodies encoded.
+func decodedBody(resp *http.Response) (io.Reader, bool, error) {
+	var reader io.Reader
+	var err error
+	switch contentEncoding(resp) {
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(resp.Body)
+	case "deflate":
+		reader, err = zlib.NewReader(resp.Body)
+	default:
+		return resp.Body, resp.Uncompressed, nil
+	}
+	if errors.Is(err, io.EOF) {
+		return strings.NewReader(""), true, nil
+	}
+	return reader, true, err
+}
+
+// readBody reads at most MaxBodyBytes of the decoded body, so a small compressed body cannot inflate without bound
+func (p ResponsePolicy) readBody(resp *http.Response) ([]byte, *FetchError) {
+	reader, decoded, err := decodedBody(resp)
+	if err != nil {
+		return nil, violation(ErrDecompression, err)
+	}
+	if p.MaxBodyBytes > 0 {
+		reader = io.LimitReader(reader, p.MaxBodyBytes+1)
+	}
+
+	body, err := io.ReadAll(reader)
+	switch {
+	case err != nil && decoded && isDecodeError(err):
+		return body, violation(ErrDecompression, err)
+	case err != nil:
+		return body, violation(ErrBodyRead, err)
+	case p.MaxBodyBytes > 0 && int64(len(body)) > p.MaxBodyBytes:
+		return body[:p.MaxBodyBytes], violation(ErrBodyTooLarge, fmt.Errorf("body exceeds %d bytes", p.MaxBodyBytes))
+	}
+	return body, nil
+}
+
+// isDecodeError reports whether err came from decoding a compressed body rather than from the connection
+func isDecodeError(err error) bool {
+	var corrupt flate.CorruptInputError
+	return errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum) ||
+		errors.Is(err, zlib.ErrHeader) || errors.Is(err, zlib.ErrChecksum) || errors.As(err, &corrupt)
+}
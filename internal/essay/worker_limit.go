@@ -0,0 +1,73 @@
+package essay
+
+import (
+	"context"
+	"sync"
+)
+
+// workerLimit is a counting semaphore whose size can change while it is in use
+type workerLimit struct {
+	mu     sync.Mutex
+	limit  int
+	active int
+	wake   chan struct{}
+}
+
+func newWorkerLimit(limit int) *workerLimit {
+	return &workerLimit{
+		limit: limit,
+		wake:  make(chan struct{}),
+	}
+}
+
+func (l *workerLimit) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.active < l.limit {
+			l.active++
+			l.mu.Unlock()
+			return nil
+		}
+		wake := l.wake
+		l.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *workerLimit) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+	l.broadcast()
+}
+
+func (l *workerLimit) setLimit(limit int) {
+	if limit < 1 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = limit
+	l.broadcast()
+}
+
+func (l *workerLimit) getLimit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.limit
+}
+
+// broadcast wakes every waiter; callers must hold mu
+func (l *workerLimit) broadcast() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
@@ -0,0 +1,209 @@
+package fuzzy
+
+import (
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"math"
+	"slices"
+	"sync"
+)
+
+const (
+	// MaxDistance is the largest supported edit distance; the index grows quickly beyond it
+	MaxDistance = 2
+
+	// prefixLength bounds the deletes generated per word, as in SymSpell; candidates are
+	// always verified against the whole word
+	prefixLength = 7
+
+	// cacheSize bounds the lookup cache, which is cleared when full
+	cacheSize = 1 << 17
+)
+
+// Matcher maps a token to the closest dictionary word within the edit distance
+type Matcher interface {
+	Match(token string) (string, bool)
+}
+
+type match struct {
+	word string
+	ok   bool
+}
+
+// symSpellMatcher indexes every delete of every word's prefix. A token's deletes are looked up in
+// the index and the candidates verified with the real distance. Each index entry packs a 32-bit
+// delete hash above the word id, so the index is one sorted []uint64, far smaller than a map of
+// delete strings.
+type symSpellMatcher struct {
+	words       []string
+	postings    []uint64
+	maxDistance int
+
+	mu    sync.RWMutex
+	cache map[string]match
+}
+
+// NewMatcher indexes words for matching within maxDistance (1 or 2) insertions, deletions,
+// substitutions or transpositions. Ties go to the lexicographically smallest word. Tokens of
+// 2*maxDistance letters or fewer are never matched, since nearly any short word would do.
+func NewMatcher(words []string, maxDistance int) Matcher {
+	maxDistance = min(max(maxDistance, 1), MaxDistance)
+	m := &symSpellMatcher{
+		words:       words,
+		maxDistance: maxDistance,
+		cache:       make(map[string]match),
+	}
+
+	for id, word := range words {
+		for _, d := range deletes(prefix(word), maxDistance) {
+			m.postings = append(m.postings, uint64(hashString(d))<<32|uint64(id))
+		}
+	}
+	slices.Sort(m.postings)
+
+	return m
+}
+
+// NewWordBankMatcher indexes the words currently in wb; later reloads of wb are not reflected
+func NewWordBankMatcher(wb wordbank.WordBank, maxDistance int) Matcher {
+	words := make([]string, 0, wb.Size())
+	wb.Each(func(word string) {
+		words = append(words, word)
+	})
+	return NewMatcher(words, maxDistance)
+}
+
+func (m *symSpellMatcher) Match(token string) (string, bool) {
+	if len(token) <= 2*m.maxDistance {
+		return "", false
+	}
+
+	m.mu.RLock()
+	cached, hit := m.cache[token]
+	m.mu.RUnlock()
+	if hit {
+		return cached.word, cached.ok
+	}
+
+	result := m.lookup(token)
+
+	m.mu.Lock()
+	if len(m.cache) >= cacheSize {
+		m.cache = make(map[string]match)
+	}
+	m.cache[token] = result
+	m.mu.Unlock()
+
+	return result.word, result.ok
+}
+
+func (m *symSpellMatcher) lookup(token string) match {
+	best := match{}
+	bestDistance := m.maxDistance + 1
+	seen := make(map[uint32]bool)
+
+	for _, d := range deletes(prefix(token), m.maxDistance) {
+		h := uint64(hashString(d)) << 32
+		i, _ := slices.BinarySearch(m.postings, h)
+		for ; i < len(m.postings) && m.postings[i]&^math.MaxUint32 == h; i++ {
+			id := uint32(m.postings[i])
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			word := m.words[id]
+			if abs(len(word)-len(token)) > m.maxDistance {
+				continue
+			}
+			distance := Distance(token, word, m.maxDistance)
+			if distance < bestDistance || distance == bestDistance && word < best.word {
+				best, bestDistance = match{word: word, ok: true}, distance
+			}
+		}
+	}
+
+	return best
+}
+
+// Distance is the optimal string alignment distance between a and b (Levenshtein plus adjacent
+// transpositions), or limit+1 once it is known to exceed limit
+func Distance(a, b string, limit int) int {
+	if abs(len(a)-len(b)) > limit {
+		return limit + 1
+	}
+
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+
+	return min(prev[len(b)], limit+1)
+}
+
+func prefix(word string) string {
+	if len(word) > prefixLength {
+		return word[:prefixLength]
+	}
+	return word
+}
+
+// deletes returns word and every string reachable from it by removing up to n characters.
+// Words are at most prefixLength long, so a linear duplicate check beats a map.
+func deletes(word string, n int) []string {
+	result := []string{word}
+	start := 0
+
+	for step := 0; step < n; step++ {
+		end := len(result)
+		for _, w := range result[start:end] {
+			for i := 0; i < len(w); i++ {
+				d := w[:i] + w[i+1:]
+				if !slices.Contains(result[end:], d) {
+					result = append(result, d)
+				}
+			}
+		}
+		start = end
+	}
+
+	return result
+}
+
+// hashString is 32-bit FNV-1a; collisions only add candidates, which are verified
+func hashString(s string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return h
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
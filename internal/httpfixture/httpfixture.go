@@ -0,0 +1,250 @@
+package httpfixture
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// How fetches use a fixtures directory
+const (
+	ModeOff    = "off"
+	ModeRecord = "record" // fetch from the network and record every response
+	ModeReplay = "replay" // answer from the recorded responses only
+)
+
+// Modes lists the valid modes
+var Modes = []string{ModeOff, ModeRecord, ModeReplay}
+
+// ErrNoFixture is returned when replaying a request nothing was recorded for
+var ErrNoFixture = errors.New("no fixture recorded")
+
+// volatileHeaders change on every response, so they are not recorded and fixtures diff cleanly
+var volatileHeaders = []string{"Date", "Age", "Expires", "Content-Length", "Set-Cookie", "Report-To", "Nel"}
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Fixture is one recorded response, stored as a JSON file so it can be reviewed and edited by hand
+type Fixture struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+	Base64 bool        `json:"base64,omitempty"` // Body is base64 encoded because it is not UTF-8
+}
+
+// FileName is the file a request's fixture is stored in: the host and path for reading, and a hash of the
+// method and URL so query strings and long paths cannot collide
+func FileName(method, rawURL string) string {
+	sum := sha256.Sum256([]byte(method + " " + rawURL))
+	name := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		name = u.Host + u.Path
+	}
+	name = strings.Trim(unsafeNameChars.ReplaceAllString(name, "_"), "_.")
+	if len(name) > 80 {
+		name = name[:80]
+	}
+	return name + "-" + hex.EncodeToString(sum[:4]) + ".json"
+}
+
+// Write stores f in dir under its FileName
+func Write(dir string, f Fixture) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write then rename so a concurrent replay never reads half a fixture
+	path := filepath.Join(dir, FileName(f.Method, f.URL))
+	tmp, err := os.CreateTemp(dir, ".fixture-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load reads every fixture in dir
+func Load(dir string) ([]Fixture, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	fixtures := make([]Fixture, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var f Fixture
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+		}
+		if f.Method == "" {
+			f.Method = http.MethodGet
+		}
+		if f.URL == "" || f.Status == 0 {
+			return nil, fmt.Errorf("invalid fixture %s: url and status are required", path)
+		}
+		fixtures = append(fixtures, f)
+	}
+	return fixtures, nil
+}
+
+func (f Fixture) body() ([]byte, error) {
+	if f.Base64 {
+		return base64.StdEncoding.DecodeString(f.Body)
+	}
+	return []byte(f.Body), nil
+}
+
+// response builds the recorded response to req
+func (f Fixture) response(req *http.Request) (*http.Response, error) {
+	body, err := f.body()
+	if err != nil {
+		return nil, fmt.Errorf("invalid fixture body for %s: %w", f.URL, err)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+		StatusCode:    f.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        f.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// recorder passes requests to the network and writes each response to a fixture
+type recorder struct {
+	dir  string
+	base http.RoundTripper
+}
+
+// NewRecorder records every response base returns into the existing directory dir; the last response to a
+// request wins. Bodies are recorded as the caller receives them, after transparent gzip decoding.
+func NewRecorder(dir string, base http.RoundTripper) http.RoundTripper {
+	return &recorder{dir: dir, base: base}
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	header := resp.Header.Clone()
+	for _, name := range volatileHeaders {
+		header.Del(name)
+	}
+	f := Fixture{Method: req.Method, URL: req.URL.String(), Status: resp.StatusCode, Header: header, Body: string(body)}
+	if !utf8.Valid(body) {
+		f.Body, f.Base64 = base64.StdEncoding.EncodeToString(body), true
+	}
+	if err := Write(r.dir, f); err != nil {
+		return nil, fmt.Errorf("failed to record fixture for %s: %w", f.URL, err)
+	}
+	return resp, nil
+}
+
+// Replayer answers requests from recorded fixtures without touching the network
+type Replayer struct {
+	fixtures map[string]Fixture // by method and URL
+}
+
+// NewReplayer loads the fixtures in dir
+func NewReplayer(dir string) (*Replayer, error) {
+	fixtures, err := Load(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load fixtures: %w", err)
+	}
+	r := &Replayer{fixtures: make(map[string]Fixture, len(fixtures))}
+	for _, f := range fixtures {
+		r.fixtures[f.Method+" "+f.URL] = f
+	}
+	return r, nil
+}
+
+// RoundTrip returns the fixture recorded for req's method and URL, or an error wrapping ErrNoFixture
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	f, ok := r.fixtures[req.Method+" "+req.URL.String()]
+	if !ok {
+		return nil, fmt.Errorf("%w for %s %s", ErrNoFixture, req.Method, req.URL)
+	}
+	return f.response(req)
+}
+
+// NewServer serves the fixtures of one host on a local test server, matching requests by path and query.
+// Point the fetcher at server.URL plus the recorded paths; the caller closes the server.
+func (r *Replayer) NewServer() (*httptest.Server, error) {
+	byURI := make(map[string]Fixture, len(r.fixtures))
+	host := ""
+	for _, f := range r.fixtures {
+		u, err := url.Parse(f.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fixture URL %s: %w", f.URL, err)
+		}
+		if host != "" && u.Host != host {
+			return nil, fmt.Errorf("fixtures of %s and %s cannot be served from one server, replay them through the Replayer instead", host, u.Host)
+		}
+		host = u.Host
+		byURI[f.Method+" "+u.RequestURI()] = f
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		f, ok := byURI[req.Method+" "+req.URL.RequestURI()]
+		if !ok {
+			http.Error(w, fmt.Sprintf("%v for %s %s", ErrNoFixture, req.Method, req.URL.RequestURI()), http.StatusNotImplemented)
+			return
+		}
+		body, err := f.body()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for name, values := range f.Header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(f.Status)
+		w.Write(body)
+	})), nil
+}
@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Handler formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q (available: debug, info, warn, error)", name)
+	}
+	return level, nil
+}
+
+// ValidateFormat checks a handler format name
+func ValidateFormat(format string) error {
+	switch strings.ToLower(format) {
+	case FormatText, FormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("unknown log format %q (available: text, json)", format)
+	}
+}
+
+// New returns a logger writing records at level and above to w in format
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	parsed, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateFormat(format); err != nil {
+		return nil, err
+	}
+
+	options := &slog.HandlerOptions{Level: parsed}
+	if strings.ToLower(format) == FormatJSON {
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	}
+	return slog.New(slog.NewTextHandler(w, options)), nil
+}
+
+// Discard returns a logger that drops every record, for tests and quiet callers
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+}
+
+// OrDefault returns logger, or slog.Default() when it is nil, so constructors can take an optional logger
+func OrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+)
+
+// Extraction strategies reported by Metrics.Extraction
+const (
+	ExtractionContainer  = "container"  // a known article container matched
+	ExtractionParagraphs = "paragraphs" // fell back to collecting paragraphs
+)
+
+// StatusError labels fetch attempts that failed before a response was received
+const StatusError = "error"
+
+// Latency buckets in seconds, from a fast local response to the fetcher's 10s timeout
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics are the fetch and processing metrics of the application. A nil *Metrics records
+// nothing, so components take one optionally.
+type Metrics struct {
+	registry      Registry
+	fetchAttempts *CounterVec
+	fetchRetries  *Counter
+	fetchDuration *Histogram
+	fetchBytes    *Counter
+	extractions   *CounterVec
+	limiterWait   *Histogram
+	essays        *Counter
+	essayErrors   *Counter
+	wordsCounted  *Counter
+}
+
+// New registers the application metrics in r; a nil r returns nil
+func New(r Registry) *Metrics {
+	if r == nil {
+		return nil
+	}
+
+	return &Metrics{
+		registry:      r,
+		fetchAttempts: r.NewCounterVec("firefly_fetch_attempts_total", "HTTP fetch attempts by response status code, or error when no response was received.", "status"),
+		fetchRetries:  r.NewCounter("firefly_fetch_retries_total", "HTTP fetch attempts after the first for the same URL."),
+		fetchDuration: r.NewHistogram("firefly_fetch_duration_seconds", "Duration of HTTP fetch attempts.", latencyBuckets),
+		fetchBytes:    r.NewCounter("firefly_fetch_bytes_total", "Response body bytes downloaded."),
+		extractions:   r.NewCounterVec("firefly_extractions_total", "Essays extracted by content extraction strategy.", "strategy"),
+		limiterWait:   r.NewHistogram("firefly_rate_limiter_wait_seconds", "Time spent waiting for a rate limiter token before a fetch.", latencyBuckets),
+		essays:        r.NewCounter("firefly_essays_processed_total", "Essays whose words were counted."),
+		essayErrors:   r.NewCounter("firefly_essay_errors_total", "Errors received from the essay stream."),
+		wordsCounted:  r.NewCounter("firefly_words_counted_total", "Word occurrences counted across all essays."),
+	}
+}
+
+// FetchAttempt records one HTTP attempt with its status code, 0 when no response was received
+func (m *Metrics) FetchAttempt(status int, duration time.Duration, retry bool) {
+	if m == nil {
+		return
+	}
+
+	label := StatusError
+	if status != 0 {
+		label = strconv.Itoa(status)
+	}
+	m.fetchAttempts.With(label).Inc()
+	m.fetchDuration.Observe(duration.Seconds())
+	if retry {
+		m.fetchRetries.Inc()
+	}
+}
+
+func (m *Metrics) FetchBytes(n int) {
+	if m == nil {
+		return
+	}
+	m.fetchBytes.Add(float64(n))
+}
+
+func (m *Metrics) Extraction(strategy string) {
+	if m == nil {
+		return
+	}
+	m.extractions.With(strategy).Inc()
+}
+
+func (m *Metrics) LimiterWait(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.limiterWait.Observe(d.Seconds())
+}
+
+func (m *Metrics) EssaysProcessed(n int) {
+	if m == nil {
+		return
+	}
+	m.essays.Add(float64(n))
+}
+
+func (m *Metrics) EssayError() {
+	if m == nil {
+		return
+	}
+	m.essayErrors.Inc()
+}
+
+func (m *Metrics) WordsCounted(n int) {
+	if m == nil {
+		return
+	}
+	m.wordsCounted.Add(float64(n))
+}
+
+// RegisterChannel reports the occupancy and capacity of a buffered channel as gauges named
+// firefly_<name>_length and firefly_<name>_capacity in the registry of m; a nil m registers nothing
+func RegisterChannel[T any](m *Metrics, name, help string, ch chan T) {
+	if m == nil {
+		return
+	}
+	m.registry.NewGaugeFunc("firefly_"+name+"_length", help+" currently queued.", func() float64 { return float64(len(ch)) })
+	m.registry.NewGaugeFunc("firefly_"+name+"_capacity", help+" buffer capacity.", func() float64 { return float64(cap(ch)) })
+}
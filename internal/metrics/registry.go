@@ -0,0 +1,248 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType is the Prometheus text exposition format served by a Registry
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Registry holds named metrics and writes them in the Prometheus text exposition format.
+// Registering a name twice panics, as it is a programming error.
+type Registry interface {
+	NewCounter(name, help string) *Counter
+	NewCounterVec(name, help, label string) *CounterVec
+	NewHistogram(name, help string, buckets []float64) *Histogram
+	NewGaugeFunc(name, help string, value func() float64)
+	WriteText(w io.Writer) error
+
+	// ServeHTTP serves WriteText, for mounting at /metrics
+	ServeHTTP(w http.ResponseWriter, r *http.Request)
+}
+
+// metric writes its samples after the registry has written its HELP and TYPE lines
+type metric interface {
+	kind() string
+	writeSamples(w *bufio.Writer, name string)
+}
+
+type entry struct {
+	name, help string
+	metric     metric
+}
+
+type registry struct {
+	mu      sync.Mutex
+	entries []entry
+}
+
+func NewRegistry() Registry {
+	return &registry{}
+}
+
+func (r *registry) register(name, help string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range r.entries {
+		if e.name == name {
+			panic(fmt.Sprintf("metrics: %s registered twice", name))
+		}
+	}
+	r.entries = append(r.entries, entry{name: name, help: help, metric: m})
+}
+
+func (r *registry) NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	r.register(name, help, c)
+	return c
+}
+
+func (r *registry) NewCounterVec(name, help, label string) *CounterVec {
+	v := &CounterVec{label: label, counters: make(map[string]*Counter)}
+	r.register(name, help, v)
+	return v
+}
+
+// NewHistogram counts observations into the given upper bounds, which must be increasing; +Inf is implied
+func (r *registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{buckets: slices.Clone(buckets), counts: make([]uint64, len(buckets))}
+	r.register(name, help, h)
+	return h
+}
+
+// NewGaugeFunc reports value() at every scrape
+func (r *registry) NewGaugeFunc(name, help string, value func() float64) {
+	r.register(name, help, gaugeFunc(value))
+}
+
+func (r *registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	entries := slices.Clone(r.entries)
+	r.mu.Unlock()
+
+	slices.SortFunc(entries, func(a, b entry) int { return strings.Compare(a.name, b.name) })
+
+	bw := bufio.NewWriter(w)
+	for _, e := range entries {
+		fmt.Fprintf(bw, "# HELP %s %s\n", e.name, escapeHelp(e.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", e.name, e.metric.kind())
+		e.metric.writeSamples(bw, e.name)
+	}
+	return bw.Flush()
+}
+
+func (r *registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteText(w)
+}
+
+// Counter is a monotonically increasing value; a nil Counter ignores updates
+type Counter struct {
+	bits atomic.Uint64
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increases the counter by v, which must not be negative
+func (c *Counter) Add(v float64) {
+	if c == nil {
+		return
+	}
+	for {
+		old := c.bits.Load()
+		if c.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (c *Counter) Value() float64 {
+	if c == nil {
+		return 0
+	}
+	return math.Float64frombits(c.bits.Load())
+}
+
+func (c *Counter) kind() string { return "counter" }
+
+func (c *Counter) writeSamples(w *bufio.Writer, name string) {
+	fmt.Fprintf(w, "%s %s\n", name, formatValue(c.Value()))
+}
+
+// CounterVec is a family of counters partitioned by the value of one label
+type CounterVec struct {
+	label    string
+	mu       sync.Mutex
+	counters map[string]*Counter
+}
+
+// With returns the counter for value, creating it on first use; a nil CounterVec returns a nil Counter
+func (v *CounterVec) With(value string) *Counter {
+	if v == nil {
+		return nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	c, ok := v.counters[value]
+	if !ok {
+		c = &Counter{}
+		v.counters[value] = c
+	}
+	return c
+}
+
+func (v *CounterVec) kind() string { return "counter" }
+
+func (v *CounterVec) writeSamples(w *bufio.Writer, name string) {
+	v.mu.Lock()
+	values := make([]string, 0, len(v.counters))
+	for value := range v.counters {
+		values = append(values, value)
+	}
+	v.mu.Unlock()
+
+	slices.Sort(values)
+	for _, value := range values {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %s\n", name, v.label, escapeLabel(value), formatValue(v.With(value).Value()))
+	}
+}
+
+// Histogram counts observations into cumulative buckets; a nil Histogram ignores observations
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *Histogram) Observe(v float64) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *Histogram) kind() string { return "histogram" }
+
+func (h *Histogram) writeSamples(w *bufio.Writer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, formatValue(bound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatValue(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+type gaugeFunc func() float64
+
+func (g gaugeFunc) kind() string { return "gauge" }
+
+func (g gaugeFunc) writeSamples(w *bufio.Writer, name string) {
+	fmt.Fprintf(w, "%s %s\n", name, formatValue(g()))
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
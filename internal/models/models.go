@@ -1,21 +1,196 @@
 package models
 
-import "time"
+import (
+	"cmp"
+	"slices"
+	"time"
+)
 
 type Essay struct {
-	ID      int    `json:"id"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
-	URL     string `json:"url"`
+	ID           int    `json:"id"`
+	Title        string `json:"title"`
+	Content      string `json:"content"`
+	URL          string `json:"url"`
+	FinalURL     string `json:"final_url,omitempty"`     // where redirects ended, when they left URL
+	CanonicalURL string `json:"canonical_url,omitempty"` // the page's <link rel="canonical">, if any
 }
 
 type WordCount struct {
-	Word  string `json:"word"`
-	Count int    `json:"count"`
+	Word  string   `json:"word"`
+	Count int      `json:"count"`
+	Score float64  `json:"score,omitempty"` // count × word bank weight, when ranking by weight
+	Banks []string `json:"banks,omitempty"`
 }
 
 type Output struct {
+	TopWords         []WordCount            `json:"top_words"`
+	ByBank           map[string][]WordCount `json:"by_bank,omitempty"`
+	TotalEssays      int                    `json:"total_essays"`
+	TotalErrors      int                    `json:"total_errors"`
+	ErrorsByCategory map[string]int         `json:"errors_by_category,omitempty"` // TotalErrors by failure category
+	Duplicates       *DuplicateReport       `json:"duplicates,omitempty"`         // absent when deduplication is off
+	NearDuplicates   *NearDuplicateReport   `json:"near_duplicates,omitempty"`    // absent when near-duplicate detection is off
+	Timestamp        time.Time              `json:"timestamp"`
+}
+
+// DuplicateReport counts essays collapsed into one already fetched; they are neither counted nor errors
+type DuplicateReport struct {
+	URLs      int `json:"urls"`      // URL variants dropped before fetching
+	Canonical int `json:"canonical"` // fetched essays whose canonical URL was already seen
+	Content   int `json:"content"`   // fetched essays with the same text as an earlier one
+}
+
+// Total is the number of essays collapsed
+func (r DuplicateReport) Total() int {
+	return r.URLs + r.Canonical + r.Content
+}
+
+// Add sums other into r
+func (r *DuplicateReport) Add(other DuplicateReport) {
+	r.URLs += other.URLs
+	r.Canonical += other.Canonical
+	r.Content += other.Content
+}
+
+// NearDuplicateReport groups essays whose text nearly matches an earlier essay's
+type NearDuplicateReport struct {
+	Mode      string                 `json:"mode"`
+	Threshold float64                `json:"threshold"`
+	Total     int                    `json:"total"` // essays in Clusters besides the first of each
+	Clusters  []NearDuplicateCluster `json:"clusters"`
+}
+
+// Add folds the clusters of other, found among other essays, into r, keeping the largest first
+func (r *NearDuplicateReport) Add(other NearDuplicateReport) {
+	if r.Mode == "" {
+		r.Mode, r.Threshold = other.Mode, other.Threshold
+	}
+	r.Total += other.Total
+	r.Clusters = append(r.Clusters, other.Clusters...)
+	if r.Clusters == nil {
+		r.Clusters = []NearDuplicateCluster{}
+	}
+	slices.SortStableFunc(r.Clusters, func(a, b NearDuplicateCluster) int {
+		return cmp.Compare(len(b.Duplicates), len(a.Duplicates))
+	})
+}
+
+// NearDuplicateCluster is the first essay seen with the essays found to nearly duplicate it
+type NearDuplicateCluster struct {
+	URL        string          `json:"url"`
+	Duplicates []NearDuplicate `json:"duplicates"`
+}
+
+// NearDuplicate is an essay and how similar its text is to its cluster's first essay, 0-1
+type NearDuplicate struct {
+	URL        string  `json:"url"`
+	Similarity float64 `json:"similarity"`
+}
+
+type Snapshot struct {
 	TopWords    []WordCount `json:"top_words"`
 	TotalEssays int         `json:"total_essays"`
+	TotalErrors int         `json:"total_errors"`
+	UniqueWords int         `json:"unique_words"`
 	Timestamp   time.Time   `json:"timestamp"`
 }
+
+// RejectedToken is a token the processor did not count and why
+type RejectedToken struct {
+	Token  string `json:"token"`
+	Count  int    `json:"count"`
+	Reason string `json:"reason"`
+}
+
+// OOVReport summarizes the out-of-vocabulary tokens of a run, for curating the word bank
+type OOVReport struct {
+	TotalRejected int             `json:"total_rejected"`
+	ByReason      map[string]int  `json:"by_reason"`
+	TopTokens     []RejectedToken `json:"top_tokens"`
+	Timestamp     time.Time       `json:"timestamp"`
+}
+
+// Attempt is one HTTP request made while fetching an essay
+type Attempt struct {
+	Status   int           `json:"status,omitempty"` // 0 when no response was received
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+	FinalURL string        `json:"final_url,omitempty"` // where redirects ended, when any were followed
+}
+
+// Failure is an essay that could not be fetched or extracted
+type Failure struct {
+	URL      string    `json:"url,omitempty"`
+	Category string    `json:"category"`
+	Status   int       `json:"status,omitempty"` // final status
+	Attempts int       `json:"attempts,omitempty"`
+	History  []Attempt `json:"history,omitempty"`
+	Message  string    `json:"message"`
+}
+
+// FailureReport counts the failures of a run by category and lists them for retrying
+type FailureReport struct {
+	TotalFailures int            `json:"total_failures"`
+	ByCategory    map[string]int `json:"by_category"`
+	Failures      []Failure      `json:"failures"`
+	Timestamp     time.Time      `json:"timestamp"`
+}
+
+// SkipReport lists the essays that were not requested because robots.txt disallows them
+type SkipReport struct {
+	TotalSkipped int            `json:"total_skipped"`
+	ByHost       map[string]int `json:"by_host"`
+	Skipped      []Failure      `json:"skipped"`
+	Timestamp    time.Time      `json:"timestamp"`
+}
+
+// Correction is a misspelled token counted as a word bank word
+type Correction struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Count int    `json:"count"`
+}
+
+// CorrectionReport lists the fuzzy-match corrections applied during a run
+type CorrectionReport struct {
+	TotalCorrected int          `json:"total_corrected"`
+	Corrections    []Correction `json:"corrections"`
+	Timestamp      time.Time    `json:"timestamp"`
+}
+
+// WordChange is how one word's frequency moved between two runs. Ranks are 1-based over all counted
+// words, 0 when the word is absent; frequencies are per million counted words.
+type WordChange struct {
+	Word          string  `json:"word"`
+	OldCount      int     `json:"old_count"`
+	NewCount      int     `json:"new_count"`
+	OldRank       int     `json:"old_rank"`
+	NewRank       int     `json:"new_rank"`
+	RankChange    int     `json:"rank_change"` // positive when the word moved up
+	OldFrequency  float64 `json:"old_frequency"`
+	NewFrequency  float64 `json:"new_frequency"`
+	LogRatio      float64 `json:"log_ratio"` // log2 of new over old frequency, smoothed so absent words stay finite
+	LogLikelihood float64 `json:"log_likelihood"`
+	ChiSquare     float64 `json:"chi_square"`
+	PValue        float64 `json:"p_value"`
+}
+
+// RunTotals summarizes one side of a comparison
+type RunTotals struct {
+	TotalEssays int `json:"total_essays"`
+	TotalWords  int `json:"total_words"`
+	UniqueWords int `json:"unique_words"`
+}
+
+// Comparison lists the words whose rank or relative frequency changed most between two runs
+type Comparison struct {
+	Old              RunTotals    `json:"old"`
+	New              RunTotals    `json:"new"`
+	RisingRank       []WordChange `json:"rising_rank"`
+	FallingRank      []WordChange `json:"falling_rank"`
+	RisingFrequency  []WordChange `json:"rising_frequency"`
+	FallingFrequency []WordChange `json:"falling_frequency"`
+	NewEntrants      []WordChange `json:"new_entrants"`
+	Dropped          []WordChange `json:"dropped"`
+	Timestamp        time.Time    `json:"timestamp"`
+}
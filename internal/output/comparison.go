@@ -0,0 +1,118 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// changeList is one list of a comparison with what it is ranked by
+type changeList struct {
+	Key       string // the list's JSON name, used as the list column of the per-row formats
+	Title     string
+	Direction string // up or down, for the HTML bar color
+	Changes   []models.WordChange
+	magnitude func(c models.WordChange) float64
+}
+
+func changeLists(c models.Comparison) []changeList {
+	rank := func(c models.WordChange) float64 { return math.Abs(float64(c.RankChange)) }
+	ratio := func(c models.WordChange) float64 { return math.Abs(c.LogRatio) }
+	return []changeList{
+		{"rising_rank", "Rising in rank", "up", c.RisingRank, rank},
+		{"falling_rank", "Falling in rank", "down", c.FallingRank, rank},
+		{"rising_frequency", "Rising in relative frequency", "up", c.RisingFrequency, ratio},
+		{"falling_frequency", "Falling in relative frequency", "down", c.FallingFrequency, ratio},
+		{"new_entrants", "New entrants", "up", c.NewEntrants, func(c models.WordChange) float64 { return float64(c.NewCount) }},
+		{"dropped", "Dropped", "down", c.Dropped, func(c models.WordChange) float64 { return float64(c.OldCount) }},
+	}
+}
+
+// changeRow is a word change as written by the per-row formats
+type changeRow struct {
+	List     string `json:"list"`
+	Position int    `json:"position"`
+	models.WordChange
+}
+
+func changeRows(c models.Comparison) []changeRow {
+	var rows []changeRow
+	for _, l := range changeLists(c) {
+		for i, change := range l.Changes {
+			rows = append(rows, changeRow{List: l.Key, Position: i + 1, WordChange: change})
+		}
+	}
+	return rows
+}
+
+func writeComparisonCSV(w io.Writer, c models.Comparison) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"list", "position", "word", "old_count", "new_count", "old_rank", "new_rank", "rank_change",
+		"old_frequency", "new_frequency", "log_ratio", "log_likelihood", "chi_square", "p_value"})
+	for _, r := range changeRows(c) {
+		writer.Write([]string{
+			r.List, strconv.Itoa(r.Position), r.Word,
+			strconv.Itoa(r.OldCount), strconv.Itoa(r.NewCount),
+			strconv.Itoa(r.OldRank), strconv.Itoa(r.NewRank), strconv.Itoa(r.RankChange),
+			formatFloat(r.OldFrequency), formatFloat(r.NewFrequency), formatFloat(r.LogRatio),
+			formatFloat(r.LogLikelihood), formatFloat(r.ChiSquare), strconv.FormatFloat(r.PValue, 'g', 4, 64),
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeComparisonNDJSON(w io.Writer, c models.Comparison) error {
+	encoder := json.NewEncoder(w)
+	for _, r := range changeRows(c) {
+		if err := encoder.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeComparisonMarkdown(w io.Writer, c models.Comparison) error {
+	var b strings.Builder
+	b.WriteString("# Run Comparison\n\n")
+	b.WriteString("| | Essays | Counted words | Unique words |\n|---|------:|------:|------:|\n")
+	fmt.Fprintf(&b, "| Old | %d | %d | %d |\n", c.Old.TotalEssays, c.Old.TotalWords, c.Old.UniqueWords)
+	fmt.Fprintf(&b, "| New | %d | %d | %d |\n", c.New.TotalEssays, c.New.TotalWords, c.New.UniqueWords)
+
+	for _, l := range changeLists(c) {
+		fmt.Fprintf(&b, "\n## %s\n\n", l.Title)
+		if len(l.Changes) == 0 {
+			b.WriteString("No significant changes.\n")
+			continue
+		}
+
+		b.WriteString("| # | Word | Old | New | Old rank | New rank | Per million | log2 ratio | G² | p |\n")
+		b.WriteString("|--:|------|----:|----:|---------:|---------:|------------:|-----------:|---:|--:|\n")
+		for i, change := range l.Changes {
+			fmt.Fprintf(&b, "| %d | %s | %d | %d | %s | %s | %.1f → %.1f | %+.2f | %.1f | %.2g |\n",
+				i+1, escapeMarkdown(change.Word), change.OldCount, change.NewCount, formatRank(change.OldRank), formatRank(change.NewRank),
+				change.OldFrequency, change.NewFrequency, change.LogRatio, change.LogLikelihood, change.PValue)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 4, 64)
+}
+
+// formatRank shows an absent word's rank 0 as a dash
+func formatRank(rank int) string {
+	if rank == 0 {
+		return "–"
+	}
+	return strconv.Itoa(rank)
+}
@@ -0,0 +1,116 @@
+package output
+
+import (
+	"embed"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"html/template"
+	"io"
+	"strings"
+)
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).ParseFS(templateFiles, "templates/*.tmpl"))
+
+// htmlBar is a ranked word with its bar width relative to the list's first word
+type htmlBar struct {
+	models.WordCount
+	Rank  int
+	Width float64
+}
+
+type htmlList struct {
+	Name string
+	Bars []htmlBar
+}
+
+type htmlReport struct {
+	models.Output
+	Lists      []htmlList
+	Categories []categoryCount
+	ErrorRate  float64
+	Weighted   bool
+	Attributed bool
+}
+
+// writeHTML renders a single page with inline styles and no external assets, so it can be mailed or archived as is
+func writeHTML(w io.Writer, output models.Output) error {
+	data := htmlReport{
+		Output:     output,
+		Weighted:   hasScores(output),
+		Attributed: hasBanks(output),
+		Categories: errorCategories(output),
+	}
+	if attempts := output.TotalEssays + output.TotalErrors; attempts > 0 {
+		data.ErrorRate = 100 * float64(output.TotalErrors) / float64(attempts)
+	}
+
+	for _, l := range lists(output) {
+		hl := htmlList{Name: l.Name}
+		top := 0.0
+		for i, wc := range l.Words {
+			value := barValue(wc, data.Weighted)
+			if i == 0 {
+				top = value
+			}
+			hl.Bars = append(hl.Bars, htmlBar{WordCount: wc, Rank: i + 1, Width: barWidth(value, top)})
+		}
+		data.Lists = append(data.Lists, hl)
+	}
+
+	return templates.ExecuteTemplate(w, "report.html.tmpl", data)
+}
+
+// barValue is what the list is ranked by: the score when weighted, otherwise the count
+func barValue(wc models.WordCount, weighted bool) float64 {
+	if weighted {
+		return wc.Score
+	}
+	return float64(wc.Count)
+}
+
+// barWidth is value as a percentage of the list's largest value
+func barWidth(value, top float64) float64 {
+	if top <= 0 {
+		return 0
+	}
+	return 100 * value / top
+}
+
+type htmlChange struct {
+	models.WordChange
+	Position int
+	Width    float64
+}
+
+type htmlChangeList struct {
+	Title     string
+	Direction string
+	Bars      []htmlChange
+}
+
+type htmlComparison struct {
+	models.Comparison
+	Lists []htmlChangeList
+}
+
+func writeComparisonHTML(w io.Writer, c models.Comparison) error {
+	data := htmlComparison{Comparison: c}
+	for _, l := range changeLists(c) {
+		hl := htmlChangeList{Title: l.Title, Direction: l.Direction}
+		top := 0.0
+		for i, change := range l.Changes {
+			value := l.magnitude(change)
+			if i == 0 {
+				top = value
+			}
+			hl.Bars = append(hl.Bars, htmlChange{WordChange: change, Position: i + 1, Width: barWidth(value, top)})
+		}
+		data.Lists = append(data.Lists, hl)
+	}
+
+	return templates.ExecuteTemplate(w, "comparison.html.tmpl", data)
+}
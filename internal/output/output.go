@@ -0,0 +1,245 @@
+package output
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Format selects how the run output is written
+type Format string
+
+const (
+	// FormatJSON is the indented JSON object, the default
+	FormatJSON Format = "json"
+	// FormatCSV is one row per ranked word
+	FormatCSV Format = "csv"
+	// FormatNDJSON is one JSON object per ranked word
+	FormatNDJSON Format = "ndjson"
+	// FormatMarkdown is a table per word list
+	FormatMarkdown Format = "markdown"
+	// FormatHTML is a self-contained report with bar charts and an error summary
+	FormatHTML Format = "html"
+)
+
+// TopList names the overall top words in the per-row formats; bank breakdowns use the bank name
+const TopList = "top"
+
+// Formats lists the available formats
+func Formats() []Format {
+	return []Format{FormatJSON, FormatCSV, FormatNDJSON, FormatMarkdown, FormatHTML}
+}
+
+// ParseFormat validates a format name; empty selects FormatJSON
+func ParseFormat(name string) (Format, error) {
+	if name == "" {
+		return FormatJSON, nil
+	}
+	for _, format := range Formats() {
+		if string(format) == strings.ToLower(name) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output format %q (available: json, csv, ndjson, markdown, html)", name)
+}
+
+// Writer renders the output of a run, or a comparison of two runs, in one format
+type Writer interface {
+	Write(w io.Writer, output models.Output) error
+	WriteComparison(w io.Writer, comparison models.Comparison) error
+}
+
+type formatWriter struct {
+	output     func(w io.Writer, output models.Output) error
+	comparison func(w io.Writer, comparison models.Comparison) error
+}
+
+func (f formatWriter) Write(w io.Writer, output models.Output) error {
+	return f.output(w, output)
+}
+
+func (f formatWriter) WriteComparison(w io.Writer, comparison models.Comparison) error {
+	return f.comparison(w, comparison)
+}
+
+// NewWriter returns the writer for format
+func NewWriter(format Format) Writer {
+	switch format {
+	case FormatCSV:
+		return formatWriter{writeCSV, writeComparisonCSV}
+	case FormatNDJSON:
+		return formatWriter{writeNDJSON, writeComparisonNDJSON}
+	case FormatMarkdown:
+		return formatWriter{writeMarkdown, writeComparisonMarkdown}
+	case FormatHTML:
+		return formatWriter{writeHTML, writeComparisonHTML}
+	default:
+		return formatWriter{writeIndentedJSON[models.Output], writeIndentedJSON[models.Comparison]}
+	}
+}
+
+// list is one ranked word list: the overall top words or one bank's
+type list struct {
+	Name  string
+	Words []models.WordCount
+}
+
+// lists returns the top words followed by each bank's words, ordered by bank name
+func lists(output models.Output) []list {
+	result := []list{{Name: TopList, Words: output.TopWords}}
+
+	banks := make([]string, 0, len(output.ByBank))
+	for bank := range output.ByBank {
+		banks = append(banks, bank)
+	}
+	slices.Sort(banks)
+	for _, bank := range banks {
+		result = append(result, list{Name: bank, Words: output.ByBank[bank]})
+	}
+	return result
+}
+
+func writeIndentedJSON[T any](w io.Writer, value T) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Errorf("failed to marshal output: %w", err)
+	}
+	return nil
+}
+
+// row is a ranked word as written by the per-row formats
+type row struct {
+	List  string   `json:"list"`
+	Rank  int      `json:"rank"`
+	Word  string   `json:"word"`
+	Count int      `json:"count"`
+	Score float64  `json:"score,omitempty"`
+	Banks []string `json:"banks,omitempty"`
+}
+
+func rows(output models.Output) []row {
+	var result []row
+	for _, l := range lists(output) {
+		for i, wc := range l.Words {
+			result = append(result, row{List: l.Name, Rank: i + 1, Word: wc.Word, Count: wc.Count, Score: wc.Score, Banks: wc.Banks})
+		}
+	}
+	return result
+}
+
+func writeCSV(w io.Writer, output models.Output) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"list", "rank", "word", "count", "score", "banks"})
+	for _, r := range rows(output) {
+		score := ""
+		if r.Score != 0 {
+			score = strconv.FormatFloat(r.Score, 'f', -1, 64)
+		}
+		writer.Write([]string{r.List, strconv.Itoa(r.Rank), r.Word, strconv.Itoa(r.Count), score, strings.Join(r.Banks, ";")})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeNDJSON(w io.Writer, output models.Output) error {
+	encoder := json.NewEncoder(w)
+	for _, r := range rows(output) {
+		if err := encoder.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeMarkdown(w io.Writer, output models.Output) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Top Words\n\n")
+	fmt.Fprintf(&b, "%d essays, %d errors, %s\n", output.TotalEssays, output.TotalErrors, output.Timestamp.Format("2006-01-02 15:04:05 MST"))
+
+	weighted, attributed := hasScores(output), hasBanks(output)
+	for _, l := range lists(output) {
+		if l.Name != TopList {
+			fmt.Fprintf(&b, "\n## %s\n", escapeMarkdown(l.Name))
+		}
+
+		header, rule := "| Rank | Word | Count |", "|-----:|------|------:|"
+		if weighted {
+			header, rule = header+" Score |", rule+"------:|"
+		}
+		if attributed {
+			header, rule = header+" Banks |", rule+"-------|"
+		}
+		fmt.Fprintf(&b, "\n%s\n%s\n", header, rule)
+
+		for i, wc := range l.Words {
+			fmt.Fprintf(&b, "| %d | %s | %d |", i+1, escapeMarkdown(wc.Word), wc.Count)
+			if weighted {
+				fmt.Fprintf(&b, " %s |", strconv.FormatFloat(wc.Score, 'f', -1, 64))
+			}
+			if attributed {
+				fmt.Fprintf(&b, " %s |", escapeMarkdown(strings.Join(wc.Banks, ", ")))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if categories := errorCategories(output); len(categories) > 0 {
+		b.WriteString("\n## Errors by category\n\n| Category | Errors |\n|----------|-------:|\n")
+		for _, c := range categories {
+			fmt.Fprintf(&b, "| %s | %d |\n", escapeMarkdown(c.Category), c.Count)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type categoryCount struct {
+	Category string
+	Count    int
+}
+
+// errorCategories orders the error breakdown by count, then by category
+func errorCategories(output models.Output) []categoryCount {
+	var categories []categoryCount
+	for category, count := range output.ErrorsByCategory {
+		categories = append(categories, categoryCount{category, count})
+	}
+	slices.SortFunc(categories, func(a, b categoryCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Category, b.Category))
+	})
+	return categories
+}
+
+// hasScores reports whether any word was ranked by weight
+func hasScores(output models.Output) bool {
+	return anyWord(output, func(wc models.WordCount) bool { return wc.Score != 0 })
+}
+
+// hasBanks reports whether words are attributed to named word banks
+func hasBanks(output models.Output) bool {
+	return anyWord(output, func(wc models.WordCount) bool { return len(wc.Banks) > 0 })
+}
+
+func anyWord(output models.Output, fn func(wc models.WordCount) bool) bool {
+	for _, l := range lists(output) {
+		if slices.ContainsFunc(l.Words, fn) {
+			return true
+		}
+	}
+	return false
+}
+
+var markdownEscaper = strings.NewReplacer("|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`")
+
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
@@ -0,0 +1,70 @@
+package processor
+
+import (
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/results"
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"sort"
+)
+
+// TopWordsByBank breaks the counts down per member bank of banks, with the top N words of each.
+// A word held by several banks is listed under each of them.
+func TopWordsByBank(wordCounts map[string]int, banks wordbank.Collection, topN int, weighted bool) map[string][]models.WordCount {
+	perBank := make(map[string]map[string]int)
+	for _, name := range banks.Names() {
+		perBank[name] = make(map[string]int)
+	}
+
+	for word, count := range wordCounts {
+		for _, name := range banks.Sources(word) {
+			perBank[name][word] = count
+		}
+	}
+
+	byBank := make(map[string][]models.WordCount, len(perBank))
+	for name, counts := range perBank {
+		byBank[name] = rankWords(counts, banks, topN, weighted)
+	}
+	return byBank
+}
+
+// rankWords returns the top N words by count, or by count × word bank weight when weighted,
+// attributed to their banks when wordBank is a collection
+func rankWords(wordCounts map[string]int, wordBank wordbank.WordBank, topN int, weighted bool) []models.WordCount {
+	var topWords []models.WordCount
+	if weighted {
+		topWords = topWordsByScore(wordCounts, wordBank, topN)
+	} else {
+		topWords = results.TopWords(wordCounts, topN)
+	}
+
+	if banks, ok := wordBank.(wordbank.Collection); ok {
+		for i := range topWords {
+			topWords[i].Banks = banks.Sources(topWords[i].Word)
+		}
+	}
+	return topWords
+}
+
+func topWordsByScore(wordCounts map[string]int, wordBank wordbank.WordBank, topN int) []models.WordCount {
+	words := make([]models.WordCount, 0, len(wordCounts))
+	for word, count := range wordCounts {
+		weight := 1.0
+		if entry, ok := wordBank.Lookup(word); ok {
+			weight = entry.EffectiveWeight()
+		}
+		words = append(words, models.WordCount{Word: word, Count: count, Score: float64(count) * weight})
+	}
+
+	sort.Slice(words, func(i, j int) bool {
+		if words[i].Score == words[j].Score {
+			return words[i].Word < words[j].Word
+		}
+		return words[i].Score > words[j].Score
+	})
+
+	if len(words) < topN {
+		return words
+	}
+	return words[:topN]
+}
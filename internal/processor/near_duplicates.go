@@ -0,0 +1,122 @@
+package processor
+
+import (
+	"cmp"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/simhash"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// What happens to the counts of an essay that nearly duplicates an earlier one
+const (
+	NearDuplicatesOff        = "off"
+	NearDuplicatesReport     = "report"     // counted in full and reported
+	NearDuplicatesDrop       = "drop"       // not counted, nor in the total of essays
+	NearDuplicatesDownweight = "downweight" // each word counted Weight times as often, rounded over all essays
+)
+
+// NearDuplicateModes lists the valid NearDuplicates.Mode values
+var NearDuplicateModes = []string{NearDuplicatesOff, NearDuplicatesReport, NearDuplicatesDrop, NearDuplicatesDownweight}
+
+// NearDuplicates detect essays whose SimHash is at least Threshold similar to an earlier essay's.
+// Each is compared with the first essay of every cluster, which is always counted in full.
+type NearDuplicates struct {
+	Mode      string  // one of NearDuplicateModes; empty is off
+	Threshold float64 // 0-1, the fraction of fingerprint bits that must match
+	Weight    float64 // 0-1, the share of a near-duplicate's counts kept when downweighting
+}
+
+func (n NearDuplicates) enabled() bool {
+	return n.Mode != "" && n.Mode != NearDuplicatesOff
+}
+
+// weight is the factor applied to the counts of a near-duplicate
+func (n NearDuplicates) weight() float64 {
+	switch n.Mode {
+	case NearDuplicatesDrop:
+		return 0
+	case NearDuplicatesDownweight:
+		return n.Weight
+	}
+	return 1
+}
+
+// nearDuplicateDetector clusters the essays of one stream
+type nearDuplicateDetector struct {
+	options NearDuplicates
+
+	mu       sync.Mutex
+	index    *simhash.Index
+	clusters []models.NearDuplicateCluster // by index id
+	total    int
+}
+
+func newNearDuplicateDetector(options NearDuplicates) *nearDuplicateDetector {
+	return &nearDuplicateDetector{options: options, index: simhash.NewIndex(options.Threshold)}
+}
+
+// classify returns the weight to count essay's words with, 1 unless it nearly duplicates an earlier essay.
+// Essays without words are never clustered.
+func (d *nearDuplicateDetector) classify(essay models.Essay, tokens []string) float64 {
+	if len(tokens) == 0 {
+		return 1
+	}
+	for i, token := range tokens {
+		tokens[i] = strings.ToLower(token)
+	}
+	fingerprint := simhash.Of(tokens)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if id, similarity, ok := d.index.Nearest(fingerprint); ok {
+		d.clusters[id].Duplicates = append(d.clusters[id].Duplicates, models.NearDuplicate{
+			URL:        essay.URL,
+			Similarity: math.Round(similarity*1000) / 1000,
+		})
+		d.total++
+		return d.options.weight()
+	}
+	d.index.Add(fingerprint)
+	d.clusters = append(d.clusters, models.NearDuplicateCluster{URL: essay.URL})
+	return 1
+}
+
+// report lists the clusters with duplicates, largest first
+func (d *nearDuplicateDetector) report() *models.NearDuplicateReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	report := &models.NearDuplicateReport{
+		Mode:      d.options.Mode,
+		Threshold: d.options.Threshold,
+		Total:     d.total,
+		Clusters:  []models.NearDuplicateCluster{},
+	}
+	for _, cluster := range d.clusters {
+		if len(cluster.Duplicates) > 0 {
+			cluster.Duplicates = slices.Clone(cluster.Duplicates)
+			report.Clusters = append(report.Clusters, cluster)
+		}
+	}
+	slices.SortStableFunc(report.Clusters, func(a, b models.NearDuplicateCluster) int {
+		return cmp.Compare(len(b.Duplicates), len(a.Duplicates))
+	})
+	return report
+}
+
+// weighCounts scales one essay's counts by weight, dropping words that round to nothing
+func weighCounts(counts map[string]int, weight float64) {
+	if weight == 1 {
+		return
+	}
+	for word, count := range counts {
+		if scaled := int(math.Round(float64(count) * weight)); scaled > 0 {
+			counts[word] = scaled
+		} else {
+			delete(counts, word)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// WriteSnapshots periodically writes the processor's current snapshot to w as NDJSON
+// until ctx is done. A final snapshot is written on exit so the last line reflects the end state.
+func WriteSnapshots(ctx context.Context, wp WordProcessor, w io.Writer, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("snapshot interval must be positive, got %v", interval)
+	}
+
+	encoder := json.NewEncoder(w)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := encoder.Encode(wp.Snapshot()); err != nil {
+				return fmt.Errorf("failed writing snapshot: %w", err)
+			}
+
+		case <-ctx.Done():
+			if err := encoder.Encode(wp.Snapshot()); err != nil {
+				return fmt.Errorf("failed writing snapshot: %w", err)
+			}
+			return nil
+		}
+	}
+}
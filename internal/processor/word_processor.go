@@ -2,13 +2,21 @@ package processor
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"github.com/ireuven89/firefly-itzik/internal/fuzzy"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/metrics"
 	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/results"
 	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"log/slog"
+	"math"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Configuration constants
@@ -18,26 +26,109 @@ const (
 	ProgressInterval = 10
 )
 
+// Reasons a token is not counted
+const (
+	ReasonTooShort  = "too_short"
+	ReasonStopword  = "stopword"
+	ReasonNotInBank = "not_in_bank"
+	ReasonFiltered  = "filtered" // in the word bank but excluded by the POS or tag filter
+)
+
+// CategoryOther is the failure category of stream errors that do not describe themselves
+const CategoryOther = "other"
+
 type WordProcessor interface {
 	ProcessEssayStream(ctx context.Context, essayStream <-chan models.Essay, errorChan <-chan error, topN int) ([]models.WordCount, int, int)
+	Snapshot() models.Snapshot
+	Result() *results.Result
+	OOVReport(topN int) models.OOVReport
+	CorrectionReport() models.CorrectionReport
+	FailureReport() models.FailureReport
+	// NearDuplicateReport clusters the near-duplicate essays found so far; nil when detection is off
+	NearDuplicateReport() *models.NearDuplicateReport
+}
+
+// Options narrow and weight what is counted using word bank metadata
+type Options struct {
+	POS           []string // count only words with one of these parts of speech
+	Tags          []string // count only words carrying one of these tags
+	Weighted      bool     // rank top words by count × word bank weight
+	TrackRejected bool     // keep every rejected token for OOVReport
+
+	// Fuzzy, when set, counts tokens missing from the word bank as their closest bank word
+	Fuzzy fuzzy.Matcher
+
+	// NearDuplicates reports, drops or downweights essays nearly identical to an earlier one
+	NearDuplicates NearDuplicates
+
+	// OnEssay and OnError, when set, observe each essay's counts and each stream error, e.g. to
+	// record them. OnEssay is called concurrently from the batch workers, with a near-duplicate's
+	// counts weighted and rounded on their own.
+	OnEssay func(essay models.Essay, counts map[string]int)
+	OnError func(err error)
+
+	// Logger receives progress and stream errors; nil logs to slog.Default()
+	Logger *slog.Logger
+
+	// Metrics, when set, count processed essays, stream errors and counted words
+	Metrics *metrics.Metrics
 }
 
 type wordProcessor struct {
 	wordBank  wordbank.WordBank
 	wordRegex *regexp.Regexp
+	options   Options
+	logger    *slog.Logger
+
+	// Running state, guarded by mu so Snapshot can be called mid-run
+	mu             sync.RWMutex
+	wordCounts     map[string]int
+	partialCounts  map[string]float64 // downweighted near-duplicate counts, rounded once when read
+	docFrequencies map[string]int
+	totalEssays    int
+	totalErrors    int
+	topN           int
+	rejected       map[string]models.RejectedToken
+	corrections    map[string]models.Correction
+	failures       []models.Failure
+	nearDuplicates *nearDuplicateDetector // nil when detection is off
+}
+
+// An essay with the factor to count its words by
+type weightedEssay struct {
+	essay  models.Essay
+	weight float64
+}
+
+// Per-worker counts merged into the running state after each batch
+type workerCounts struct {
+	wordCounts     map[string]int
+	partialCounts  map[string]float64
+	docFrequencies map[string]int
+	rejected       map[string]models.RejectedToken
+	corrections    map[string]models.Correction
 }
 
 func NewWordProcessor(wordBank wordbank.WordBank) WordProcessor {
+	return NewWordProcessorWithOptions(wordBank, Options{})
+}
+
+func NewWordProcessorWithOptions(wordBank wordbank.WordBank, options Options) WordProcessor {
 	return &wordProcessor{
-		wordBank:  wordBank,
-		wordRegex: regexp.MustCompile(`[a-zA-Z]+`),
+		wordBank:       wordBank,
+		wordRegex:      regexp.MustCompile(`[a-zA-Z]+`),
+		options:        options,
+		logger:         logging.OrDefault(options.Logger),
+		wordCounts:     make(map[string]int),
+		partialCounts:  make(map[string]float64),
+		docFrequencies: make(map[string]int),
+		rejected:       make(map[string]models.RejectedToken),
+		corrections:    make(map[string]models.Correction),
 	}
 }
 
 func (wp *wordProcessor) ProcessEssayStream(ctx context.Context, essayStream <-chan models.Essay, errorChan <-chan error, topN int) ([]models.WordCount, int, int) {
-	wordCounts := make(map[string]int)
-	var totalEssays int
-	var totalErrors int
+	wp.reset(topN)
 
 	// Process essays in batches for better performance
 	batch := make([]models.Essay, 0, DefaultBatchSize)
@@ -47,9 +138,9 @@ func (wp *wordProcessor) ProcessEssayStream(ctx context.Context, essayStream <-c
 		case essay, ok := <-essayStream:
 			if !ok {
 				// Process any remaining essays in the final batch
-				totalEssays += wp.processFinalBatch(batch, wordCounts)
-				totalErrors += wp.drainErrorsAndCount(errorChan)
-				return wp.getTopNWords(wordCounts, topN), totalEssays, totalErrors
+				wp.addEssays(wp.processBatch(batch))
+				wp.addErrors(wp.drainErrorsAndCount(errorChan))
+				return wp.result()
 			}
 
 			// Collect essays into batch
@@ -57,8 +148,7 @@ func (wp *wordProcessor) ProcessEssayStream(ctx context.Context, essayStream <-c
 
 			// Process full batch
 			if len(batch) >= DefaultBatchSize {
-				wp.processBatch(batch, wordCounts)
-				totalEssays += len(batch)
+				totalEssays := wp.addEssays(wp.processBatch(batch))
 				batch = batch[:0] // Reset batch for reuse
 
 				wp.logProgress(totalEssays)
@@ -68,23 +158,210 @@ func (wp *wordProcessor) ProcessEssayStream(ctx context.Context, essayStream <-c
 			if !ok {
 				errorChan = nil
 			} else if err != nil {
-				totalErrors++
+				wp.observeError(err)
+				wp.addErrors(1)
 			}
 
 		case <-ctx.Done():
-			return wp.getTopNWords(wordCounts, topN), totalEssays, totalErrors
+			return wp.result()
 		}
 	}
 }
 
-// Process final batch when stream is closed
-func (wp *wordProcessor) processFinalBatch(batch []models.Essay, wordCounts map[string]int) int {
-	if len(batch) == 0 {
-		return 0
+// Snapshot returns the current top-N words and totals; safe to call while a stream is being processed
+func (wp *wordProcessor) Snapshot() models.Snapshot {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+
+	counts := wp.counts()
+	return models.Snapshot{
+		TopWords:    wp.getTopNWords(counts, wp.topN),
+		TotalEssays: wp.totalEssays,
+		TotalErrors: wp.totalErrors,
+		UniqueWords: len(counts),
+		Timestamp:   time.Now().UTC(),
+	}
+}
+
+// Result returns a copy of the full counts, suitable for saving and merging with other runs
+func (wp *wordProcessor) Result() *results.Result {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+
+	r := results.NewResult()
+	for word, count := range wp.counts() {
+		r.WordCounts[word] = count
+	}
+	for word, count := range wp.docFrequencies {
+		r.DocFrequencies[word] = count
+	}
+	r.TotalEssays = wp.totalEssays
+	r.TotalErrors = wp.totalErrors
+	r.ErrorsByCategory = countByCategory(wp.failures)
+
+	return r
+}
+
+// OOVReport returns the most frequent rejected tokens with their reasons; empty unless Options.TrackRejected is set
+func (wp *wordProcessor) OOVReport(topN int) models.OOVReport {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+
+	report := models.OOVReport{
+		ByReason:  make(map[string]int),
+		TopTokens: make([]models.RejectedToken, 0, len(wp.rejected)),
+		Timestamp: time.Now().UTC(),
+	}
+	for _, token := range wp.rejected {
+		report.TotalRejected += token.Count
+		report.ByReason[token.Reason] += token.Count
+		report.TopTokens = append(report.TopTokens, token)
+	}
+
+	sort.Slice(report.TopTokens, func(i, j int) bool {
+		if report.TopTokens[i].Count == report.TopTokens[j].Count {
+			return report.TopTokens[i].Token < report.TopTokens[j].Token
+		}
+		return report.TopTokens[i].Count > report.TopTokens[j].Count
+	})
+	if len(report.TopTokens) > topN {
+		report.TopTokens = report.TopTokens[:topN]
+	}
+
+	return report
+}
+
+// CorrectionReport lists the fuzzy-match corrections applied so far, most frequent first
+func (wp *wordProcessor) CorrectionReport() models.CorrectionReport {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+
+	report := models.CorrectionReport{
+		Corrections: make([]models.Correction, 0, len(wp.corrections)),
+		Timestamp:   time.Now().UTC(),
+	}
+	for _, correction := range wp.corrections {
+		report.TotalCorrected += correction.Count
+		report.Corrections = append(report.Corrections, correction)
+	}
+
+	sort.Slice(report.Corrections, func(i, j int) bool {
+		if report.Corrections[i].Count == report.Corrections[j].Count {
+			return report.Corrections[i].From < report.Corrections[j].From
+		}
+		return report.Corrections[i].Count > report.Corrections[j].Count
+	})
+
+	return report
+}
+
+func (wp *wordProcessor) NearDuplicateReport() *models.NearDuplicateReport {
+	wp.mu.RLock()
+	detector := wp.nearDuplicates
+	wp.mu.RUnlock()
+
+	if detector == nil {
+		return nil
+	}
+	return detector.report()
+}
+
+// FailureReport lists the stream errors so far in arrival order, with their counts by category
+func (wp *wordProcessor) FailureReport() models.FailureReport {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+
+	return models.FailureReport{
+		TotalFailures: len(wp.failures),
+		ByCategory:    countByCategory(wp.failures),
+		Failures:      slices.Clone(wp.failures),
+		Timestamp:     time.Now().UTC(),
+	}
+}
+
+// failure is implemented by errors that describe the essay they failed, such as *essay.FetchError
+type failure interface {
+	error
+	Failure() models.Failure
+}
+
+// DescribeFailure returns the failure an error describes; other errors fall under CategoryOther
+func DescribeFailure(err error) models.Failure {
+	var f failure
+	if errors.As(err, &f) {
+		return f.Failure()
+	}
+	return models.Failure{Category: CategoryOther, Message: err.Error()}
+}
+
+func countByCategory(failures []models.Failure) map[string]int {
+	counts := make(map[string]int)
+	for _, f := range failures {
+		counts[f.Category]++
+	}
+	return counts
+}
+
+// Reset running state at the start of a stream
+func (wp *wordProcessor) reset(topN int) {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+
+	wp.wordCounts = make(map[string]int)
+	wp.partialCounts = make(map[string]float64)
+	wp.docFrequencies = make(map[string]int)
+	wp.rejected = make(map[string]models.RejectedToken)
+	wp.corrections = make(map[string]models.Correction)
+	wp.failures = nil
+	wp.totalEssays = 0
+	wp.totalErrors = 0
+	wp.topN = topN
+	wp.nearDuplicates = nil
+	if wp.options.NearDuplicates.enabled() {
+		wp.nearDuplicates = newNearDuplicateDetector(wp.options.NearDuplicates)
+	}
+}
+
+func (wp *wordProcessor) addEssays(n int) int {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+
+	wp.totalEssays += n
+	wp.options.Metrics.EssaysProcessed(n)
+	return wp.totalEssays
+}
+
+func (wp *wordProcessor) addErrors(n int) {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+
+	wp.totalErrors += n
+}
+
+// Final top-N words and totals
+func (wp *wordProcessor) result() ([]models.WordCount, int, int) {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+
+	return wp.getTopNWords(wp.counts(), wp.topN), wp.totalEssays, wp.totalErrors
+}
+
+// The word counts with the downweighted near-duplicate shares added, each rounded once; callers hold mu
+func (wp *wordProcessor) counts() map[string]int {
+	if len(wp.partialCounts) == 0 {
+		return wp.wordCounts
 	}
 
-	wp.processBatch(batch, wordCounts)
-	return len(batch)
+	counts := make(map[string]int, len(wp.wordCounts)+len(wp.partialCounts))
+	for word, count := range wp.wordCounts {
+		counts[word] = count
+	}
+	for word, partial := range wp.partialCounts {
+		if count := counts[word] + int(math.Round(partial)); count > 0 {
+			counts[word] = count
+		}
+	}
+	return counts
 }
 
 // Drain remaining errors and count them
@@ -98,7 +375,8 @@ func (wp *wordProcessor) drainErrorsAndCount(errorChan <-chan error) int {
 				return errorCount
 			}
 			if err != nil {
-				fmt.Printf("Processing error: %v\n", err)
+				wp.logger.Warn("essay stream error", "error", err)
+				wp.observeError(err)
 				errorCount++
 			}
 		default:
@@ -107,19 +385,27 @@ func (wp *wordProcessor) drainErrorsAndCount(errorChan <-chan error) int {
 	}
 }
 
-// Process a batch of essays concurrently
-func (wp *wordProcessor) processBatch(essays []models.Essay, globalWordCounts map[string]int) {
+// Process a batch of essays concurrently and return how many were counted, which leaves out dropped near-duplicates
+func (wp *wordProcessor) processBatch(essays []models.Essay) int {
 	if len(essays) == 0 {
-		return
+		return 0
 	}
 
 	// Create channels for worker communication
-	essayChan := make(chan models.Essay, len(essays))
-	resultChan := make(chan map[string]int, BatchWorkers)
+	essayChan := make(chan weightedEssay, len(essays))
+	resultChan := make(chan workerCounts, BatchWorkers)
 
-	// Send essays to workers
+	// Send essays to workers; near-duplicates are detected here so the first of a cluster is the first to arrive
+	counted := 0
 	for _, essay := range essays {
-		essayChan <- essay
+		weight := 1.0
+		if wp.nearDuplicates != nil {
+			weight = wp.nearDuplicates.classify(essay, wp.wordRegex.FindAllString(essay.Content, -1))
+		}
+		if weight > 0 {
+			counted++
+		}
+		essayChan <- weightedEssay{essay: essay, weight: weight}
 	}
 	close(essayChan)
 
@@ -137,77 +423,147 @@ func (wp *wordProcessor) processBatch(essays []models.Essay, globalWordCounts ma
 	}()
 
 	// Merge worker results into global counts
-	wp.mergeWorkerResults(resultChan, globalWordCounts)
+	wp.mergeWorkerResults(resultChan)
+	return counted
 }
 
 // Worker that processes essays and counts words
-func (wp *wordProcessor) processEssaysWorker(essayChan <-chan models.Essay, resultChan chan<- map[string]int, wg *sync.WaitGroup) {
+func (wp *wordProcessor) processEssaysWorker(essayChan <-chan weightedEssay, resultChan chan<- workerCounts, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	localWordCounts := make(map[string]int)
+	local := workerCounts{
+		wordCounts:     make(map[string]int),
+		partialCounts:  make(map[string]float64),
+		docFrequencies: make(map[string]int),
+		rejected:       make(map[string]models.RejectedToken),
+		corrections:    make(map[string]models.Correction),
+	}
+
+	for weighted := range essayChan {
+		essay := weighted.essay
+		essayCounts := make(map[string]int)
+		if weighted.weight > 0 {
+			wp.countWordsInText(essay.Content, essayCounts, &local)
+		}
 
-	for essay := range essayChan {
-		wp.countWordsInText(essay.Content, localWordCounts)
+		// A downweighted essay adds its fractional share, so small weights still add up across essays
+		counted := 0
+		for word, count := range essayCounts {
+			if weighted.weight == 1 {
+				local.wordCounts[word] += count
+			} else {
+				local.partialCounts[word] += float64(count) * weighted.weight
+			}
+			local.docFrequencies[word]++
+			counted += count
+		}
+		wp.options.Metrics.WordsCounted(counted)
+
+		if wp.options.OnEssay != nil {
+			weighCounts(essayCounts, weighted.weight)
+			wp.options.OnEssay(essay, essayCounts)
+		}
 	}
 
-	resultChan <- localWordCounts
+	resultChan <- local
 }
 
 // Merge results from all workers
-func (wp *wordProcessor) mergeWorkerResults(resultChan <-chan map[string]int, globalWordCounts map[string]int) {
-	for workerCounts := range resultChan {
-		for word, count := range workerCounts {
-			globalWordCounts[word] += count
+func (wp *wordProcessor) mergeWorkerResults(resultChan <-chan workerCounts) {
+	for counts := range resultChan {
+		wp.mu.Lock()
+		for word, count := range counts.wordCounts {
+			wp.wordCounts[word] += count
+		}
+		for word, partial := range counts.partialCounts {
+			wp.partialCounts[word] += partial
+		}
+		for word, count := range counts.docFrequencies {
+			wp.docFrequencies[word] += count
+		}
+		for token, rejected := range counts.rejected {
+			rejected.Count += wp.rejected[token].Count
+			wp.rejected[token] = rejected
 		}
+		for token, correction := range counts.corrections {
+			correction.Count += wp.corrections[token].Count
+			wp.corrections[token] = correction
+		}
+		wp.mu.Unlock()
+	}
+}
+
+func (wp *wordProcessor) observeError(err error) {
+	wp.options.Metrics.EssayError()
+
+	wp.mu.Lock()
+	wp.failures = append(wp.failures, DescribeFailure(err))
+	wp.mu.Unlock()
+
+	if wp.options.OnError != nil {
+		wp.options.OnError(err)
 	}
 }
 
 // Log processing progress
 func (wp *wordProcessor) logProgress(totalEssays int) {
 	if totalEssays%ProgressInterval == 0 {
-		fmt.Printf("Processed %d essays...\n", totalEssays)
+		wp.logger.Info("processed essays", "total", totalEssays)
 	}
 }
 
-// Count valid words in text
-func (wp *wordProcessor) countWordsInText(text string, wordCounts map[string]int) {
+// Count valid words in text, correcting misspellings when fuzzy matching and recording rejected tokens when tracking them
+func (wp *wordProcessor) countWordsInText(text string, wordCounts map[string]int, local *workerCounts) {
 	words := wp.wordRegex.FindAllString(text, -1)
 
 	for _, word := range words {
 		normalizedWord := strings.ToLower(word)
 
-		if wp.isValidWord(normalizedWord) {
-			wordCounts[normalizedWord]++
+		key, reason := wp.countKey(normalizedWord)
+		if reason == ReasonNotInBank && wp.options.Fuzzy != nil {
+			if corrected, ok := wp.options.Fuzzy.Match(normalizedWord); ok {
+				if key, reason = wp.countKey(corrected); reason == "" {
+					local.corrections[normalizedWord] = models.Correction{From: normalizedWord, To: key, Count: local.corrections[normalizedWord].Count + 1}
+				}
+			}
 		}
-	}
-}
 
-// Check if word meets validation criteria
-func (wp *wordProcessor) isValidWord(word string) bool {
-	return len(word) >= 3 && wp.wordBank.Contains(word)
+		if reason == "" {
+			wordCounts[key]++
+		} else if wp.options.TrackRejected {
+			local.rejected[normalizedWord] = models.RejectedToken{Token: normalizedWord, Count: local.rejected[normalizedWord].Count + 1, Reason: reason}
+		}
+	}
 }
 
-// Get top N words sorted by count
-func (wp *wordProcessor) getTopNWords(wordCounts map[string]int, topN int) []models.WordCount {
-	words := make([]models.WordCount, 0, len(wordCounts))
-
-	for word, count := range wordCounts {
-		words = append(words, models.WordCount{
-			Word:  word,
-			Count: count,
-		})
+// Check if word meets validation criteria and the metadata filters; it is counted under its canonical form if it has one.
+// A rejected word comes back with the reason.
+func (wp *wordProcessor) countKey(word string) (string, string) {
+	if len(word) < 3 {
+		return "", ReasonTooShort
 	}
 
-	// Sort by count descending, then by word ascending
-	sort.Slice(words, func(i, j int) bool {
-		if words[i].Count == words[j].Count {
-			return words[i].Word < words[j].Word
+	entry, ok := wp.wordBank.Lookup(word)
+	if !ok {
+		if stopwords[word] {
+			return "", ReasonStopword
 		}
-		return words[i].Count > words[j].Count
-	})
+		return "", ReasonNotInBank
+	}
+	if len(wp.options.POS) > 0 && !slices.ContainsFunc(wp.options.POS, func(pos string) bool { return strings.EqualFold(pos, entry.POS) }) {
+		return "", ReasonFiltered
+	}
+	if len(wp.options.Tags) > 0 && !entry.HasTag(wp.options.Tags...) {
+		return "", ReasonFiltered
+	}
 
-	if len(words) < topN {
-		return words
+	if entry.Canonical != "" {
+		return entry.Canonical, ""
 	}
-	return words[:topN]
+	return word, ""
+}
+
+// Get top N words sorted by count, or by weighted score
+func (wp *wordProcessor) getTopNWords(wordCounts map[string]int, topN int) []models.WordCount {
+	return rankWords(wordCounts, wp.wordBank, topN, wp.options.Weighted)
 }
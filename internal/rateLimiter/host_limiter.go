@@ -0,0 +1,52 @@
+package rateLimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// HostLimiter spaces the requests to each host at least a given delay apart, on top of the overall rate limit
+type HostLimiter interface {
+	// Wait blocks until a request to host may start delay after the previous one; a delay of 0 never waits
+	Wait(ctx context.Context, host string, delay time.Duration) error
+}
+
+type hostLimiter struct {
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+func NewHostLimiter() HostLimiter {
+	return &hostLimiter{next: make(map[string]time.Time)}
+}
+
+func (hl *hostLimiter) Wait(ctx context.Context, host string, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+
+	// Reserve the next slot before sleeping so concurrent callers queue up behind each other
+	hl.mu.Lock()
+	now := time.Now()
+	start := now
+	if next := hl.next[host]; next.After(now) {
+		start = next
+	}
+	hl.next[host] = start.Add(delay)
+	hl.mu.Unlock()
+
+	wait := start.Sub(now)
+	if wait == 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -2,31 +2,49 @@ package rateLimiter
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type RateLimiter interface {
 	Wait(ctx context.Context) error
+	SetRate(requestsPerSecond int)
+	Rate() int
+	Stop()
+}
+
+// bucket is swapped as a whole when the rate changes; changed is closed so waiters move to the new bucket
+type bucket struct {
+	tokens  chan struct{}
+	changed chan struct{}
 }
 
 type tokenBucketRateLimiter struct {
+	mu       sync.Mutex
 	ticker   *time.Ticker
-	tokens   chan struct{}
-	capacity int
+	interval time.Duration
+	rate     int
+	bucket   atomic.Pointer[bucket]
+	done     chan struct{}
+	stopOnce sync.Once
 }
 
 func NewRateLimiter(requestsPerSecond int, interval time.Duration) RateLimiter {
 	capacity := requestsPerSecond
 	rl := &tokenBucketRateLimiter{
 		ticker:   time.NewTicker(interval / time.Duration(requestsPerSecond)),
-		tokens:   make(chan struct{}, capacity),
-		capacity: capacity,
+		interval: interval,
+		rate:     requestsPerSecond,
+		done:     make(chan struct{}),
 	}
 
 	// Fill initial tokens
+	b := &bucket{tokens: make(chan struct{}, capacity), changed: make(chan struct{})}
 	for i := 0; i < capacity; i++ {
-		rl.tokens <- struct{}{}
+		b.tokens <- struct{}{}
 	}
+	rl.bucket.Store(b)
 
 	// Start token refill goroutine
 	go rl.refillTokens()
@@ -35,20 +53,73 @@ func NewRateLimiter(requestsPerSecond int, interval time.Duration) RateLimiter {
 }
 
 func (rl *tokenBucketRateLimiter) Wait(ctx context.Context) error {
-	select {
-	case <-rl.tokens:
-		return nil
-	case <-ctx.Done():
-		return ctx.Err()
+	for {
+		b := rl.bucket.Load()
+		select {
+		case <-b.tokens:
+			return nil
+		case <-b.changed:
+			// Rate changed while waiting, retry on the new bucket
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 }
 
-func (rl *tokenBucketRateLimiter) refillTokens() {
-	for range rl.ticker.C {
+// SetRate changes the refill rate and bucket capacity at runtime; tokens already available carry over up to the new capacity
+func (rl *tokenBucketRateLimiter) SetRate(requestsPerSecond int) {
+	if requestsPerSecond < 1 {
+		return
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	old := rl.bucket.Load()
+	b := &bucket{tokens: make(chan struct{}, requestsPerSecond), changed: make(chan struct{})}
+	for len(b.tokens) < requestsPerSecond {
 		select {
-		case rl.tokens <- struct{}{}:
+		case <-old.tokens:
+			b.tokens <- struct{}{}
+			continue
 		default:
-			// Bucket is full, skip
+		}
+		break
+	}
+
+	rl.bucket.Store(b)
+	close(old.changed)
+
+	rl.rate = requestsPerSecond
+	rl.ticker.Reset(rl.interval / time.Duration(requestsPerSecond))
+}
+
+func (rl *tokenBucketRateLimiter) Rate() int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	return rl.rate
+}
+
+// Stop releases the refill goroutine; limiters created per job must be stopped when the job ends
+func (rl *tokenBucketRateLimiter) Stop() {
+	rl.stopOnce.Do(func() {
+		rl.ticker.Stop()
+		close(rl.done)
+	})
+}
+
+func (rl *tokenBucketRateLimiter) refillTokens() {
+	for {
+		select {
+		case <-rl.ticker.C:
+			select {
+			case rl.bucket.Load().tokens <- struct{}{}:
+			default:
+				// Bucket is full, skip
+			}
+		case <-rl.done:
+			return
 		}
 	}
 }
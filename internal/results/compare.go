@@ -0,0 +1,155 @@
+package results
+
+import (
+	"cmp"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"math"
+	"slices"
+	"time"
+)
+
+// CompareOptions bound the lists of a comparison
+type CompareOptions struct {
+	TopN     int     // words per list
+	MinCount int     // ignore words counted fewer times than this across both runs
+	Alpha    float64 // keep only changes with a p-value at or below this; 1 keeps everything
+}
+
+// Compare reports how word frequencies moved from before to after. Significance is Dunning's log-likelihood
+// (G²) on the 2×2 table of the word's count against all other counted words in each run, with its
+// p-value from the chi-square distribution with one degree of freedom; Pearson's chi-square is given
+// alongside for reference.
+func Compare(before, after *Result, options CompareOptions) models.Comparison {
+	comparison := models.Comparison{
+		Old:       totals(before),
+		New:       totals(after),
+		Timestamp: time.Now().UTC(),
+	}
+
+	oldRanks, newRanks := ranks(before.WordCounts), ranks(after.WordCounts)
+	oldTotal, newTotal := float64(comparison.Old.TotalWords), float64(comparison.New.TotalWords)
+
+	var both []models.WordChange
+	visit := func(word string) {
+		a, b := before.WordCounts[word], after.WordCounts[word]
+		if a+b < options.MinCount {
+			return
+		}
+
+		change := models.WordChange{
+			Word:     word,
+			OldCount: a,
+			NewCount: b,
+			OldRank:  oldRanks[word],
+			NewRank:  newRanks[word],
+		}
+		change.LogLikelihood, change.ChiSquare, change.PValue = significance(float64(a), float64(b), oldTotal, newTotal)
+		if change.PValue > options.Alpha {
+			return
+		}
+		if oldTotal > 0 && newTotal > 0 {
+			change.OldFrequency = 1e6 * float64(a) / oldTotal
+			change.NewFrequency = 1e6 * float64(b) / newTotal
+			change.LogRatio = math.Log2(((float64(b) + 0.5) / newTotal) / ((float64(a) + 0.5) / oldTotal))
+		}
+
+		switch {
+		case a == 0:
+			comparison.NewEntrants = append(comparison.NewEntrants, change)
+		case b == 0:
+			comparison.Dropped = append(comparison.Dropped, change)
+		default:
+			change.RankChange = change.OldRank - change.NewRank
+			both = append(both, change)
+		}
+	}
+	for word := range before.WordCounts {
+		visit(word)
+	}
+	for word := range after.WordCounts {
+		if _, seen := before.WordCounts[word]; !seen {
+			visit(word)
+		}
+	}
+
+	comparison.NewEntrants = topChanges(comparison.NewEntrants, options.TopN, func(c models.WordChange) float64 { return float64(c.NewCount) })
+	comparison.Dropped = topChanges(comparison.Dropped, options.TopN, func(c models.WordChange) float64 { return float64(c.OldCount) })
+	comparison.RisingRank = topChanges(filterChanges(both, func(c models.WordChange) bool { return c.RankChange > 0 }), options.TopN,
+		func(c models.WordChange) float64 { return float64(c.RankChange) })
+	comparison.FallingRank = topChanges(filterChanges(both, func(c models.WordChange) bool { return c.RankChange < 0 }), options.TopN,
+		func(c models.WordChange) float64 { return float64(-c.RankChange) })
+	comparison.RisingFrequency = topChanges(filterChanges(both, func(c models.WordChange) bool { return c.LogRatio > 0 }), options.TopN,
+		func(c models.WordChange) float64 { return c.LogRatio })
+	comparison.FallingFrequency = topChanges(filterChanges(both, func(c models.WordChange) bool { return c.LogRatio < 0 }), options.TopN,
+		func(c models.WordChange) float64 { return -c.LogRatio })
+
+	return comparison
+}
+
+func totals(r *Result) models.RunTotals {
+	t := models.RunTotals{TotalEssays: r.TotalEssays, UniqueWords: len(r.WordCounts)}
+	for _, count := range r.WordCounts {
+		t.TotalWords += count
+	}
+	return t
+}
+
+// ranks numbers every word by count descending, then by word, as TopWords orders them
+func ranks(wordCounts map[string]int) map[string]int {
+	ranked := TopWords(wordCounts, len(wordCounts))
+	result := make(map[string]int, len(ranked))
+	for i, wc := range ranked {
+		result[wc.Word] = i + 1
+	}
+	return result
+}
+
+// significance compares count a out of oldTotal with count b out of newTotal
+func significance(a, b, oldTotal, newTotal float64) (logLikelihood, chiSquare, pValue float64) {
+	total := oldTotal + newTotal
+	if oldTotal == 0 || newTotal == 0 || a+b == 0 || a+b == total {
+		return 0, 0, 1
+	}
+
+	expectedOld := oldTotal * (a + b) / total
+	expectedNew := newTotal * (a + b) / total
+	logLikelihood = 2 * (xLogRatio(a, expectedOld) + xLogRatio(b, expectedNew))
+
+	c, d := oldTotal-a, newTotal-b
+	chiSquare = total * math.Pow(a*d-b*c, 2) / ((a + b) * (c + d) * oldTotal * newTotal)
+
+	// Survival function of chi-square with one degree of freedom
+	pValue = math.Erfc(math.Sqrt(logLikelihood / 2))
+	return logLikelihood, chiSquare, pValue
+}
+
+func xLogRatio(x, expected float64) float64 {
+	if x == 0 {
+		return 0
+	}
+	return x * math.Log(x/expected)
+}
+
+func filterChanges(changes []models.WordChange, keep func(c models.WordChange) bool) []models.WordChange {
+	var result []models.WordChange
+	for _, c := range changes {
+		if keep(c) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// topChanges returns the n changes with the largest key, ties broken by word
+func topChanges(changes []models.WordChange, n int, key func(c models.WordChange) float64) []models.WordChange {
+	slices.SortFunc(changes, func(x, y models.WordChange) int {
+		return cmp.Or(cmp.Compare(key(y), key(x)), cmp.Compare(x.Word, y.Word))
+	})
+	if len(changes) > n {
+		changes = changes[:n]
+	}
+	if changes == nil {
+		return []models.WordChange{}
+	}
+	return changes
+}
@@ -0,0 +1,164 @@
+package results
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"os"
+	"sort"
+	"time"
+)
+
+// FormatVersion is bumped whenever the serialized layout of Result changes. Load still reads files from
+// MinFormatVersion on, whose missing fields decode as empty.
+//
+//	1  word and document counts, totals
+//	2  errors_by_category
+//	3  duplicates
+//	4  near_duplicates
+const (
+	FormatVersion    = 4
+	MinFormatVersion = 1
+)
+
+// Result holds the full counts of a run so that partial runs can be merged exactly
+type Result struct {
+	Version          int                         `json:"version"`
+	WordCounts       map[string]int              `json:"word_counts"`
+	DocFrequencies   map[string]int              `json:"doc_frequencies"`
+	TotalEssays      int                         `json:"total_essays"`
+	TotalErrors      int                         `json:"total_errors"`
+	ErrorsByCategory map[string]int              `json:"errors_by_category,omitempty"` // TotalErrors by failure category, absent before version 2
+	Duplicates       *models.DuplicateReport     `json:"duplicates,omitempty"`         // absent when deduplication was off and before version 3
+	NearDuplicates   *models.NearDuplicateReport `json:"near_duplicates,omitempty"`    // absent when near-duplicate detection was off and before version 4
+	CreatedAt        time.Time                   `json:"created_at"`
+}
+
+func NewResult() *Result {
+	return &Result{
+		Version:        FormatVersion,
+		WordCounts:     make(map[string]int),
+		DocFrequencies: make(map[string]int),
+		CreatedAt:      time.Now().UTC(),
+	}
+}
+
+// Add folds other into r
+func (r *Result) Add(other *Result) {
+	for word, count := range other.WordCounts {
+		r.WordCounts[word] += count
+	}
+	for word, count := range other.DocFrequencies {
+		r.DocFrequencies[word] += count
+	}
+	r.TotalEssays += other.TotalEssays
+	r.TotalErrors += other.TotalErrors
+	for category, count := range other.ErrorsByCategory {
+		if r.ErrorsByCategory == nil {
+			r.ErrorsByCategory = make(map[string]int)
+		}
+		r.ErrorsByCategory[category] += count
+	}
+	if other.Duplicates != nil {
+		if r.Duplicates == nil {
+			r.Duplicates = &models.DuplicateReport{}
+		}
+		r.Duplicates.Add(*other.Duplicates)
+	}
+	if other.NearDuplicates != nil {
+		if r.NearDuplicates == nil {
+			r.NearDuplicates = &models.NearDuplicateReport{}
+		}
+		r.NearDuplicates.Add(*other.NearDuplicates)
+	}
+}
+
+// TopWords returns the n most frequent words
+func (r *Result) TopWords(n int) []models.WordCount {
+	return TopWords(r.WordCounts, n)
+}
+
+// Merge combines results into a new one; counts are summed, so top-N is exact
+func Merge(results ...*Result) *Result {
+	merged := NewResult()
+	for _, r := range results {
+		merged.Add(r)
+	}
+	return merged
+}
+
+// Save writes r to path as gzip'd JSON
+func Save(path string, r *Result) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create result file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	if err := json.NewEncoder(gz).Encode(r); err != nil {
+		return fmt.Errorf("failed to encode result file %s: %w", path, err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to compress result file %s: %w", path, err)
+	}
+
+	return file.Close()
+}
+
+// Load reads a result file written by Save
+func Load(path string) (*Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open result file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("result file %s is not gzip compressed: %w", path, err)
+	}
+	defer gz.Close()
+
+	var r Result
+	if err := json.NewDecoder(gz).Decode(&r); err != nil {
+		return nil, fmt.Errorf("failed to decode result file %s: %w", path, err)
+	}
+	if r.Version < MinFormatVersion || r.Version > FormatVersion {
+		return nil, fmt.Errorf("result file %s has unsupported version %d (expected %d to %d)", path, r.Version, MinFormatVersion, FormatVersion)
+	}
+	r.Version = FormatVersion
+	if r.WordCounts == nil {
+		r.WordCounts = make(map[string]int)
+	}
+	if r.DocFrequencies == nil {
+		r.DocFrequencies = make(map[string]int)
+	}
+
+	return &r, nil
+}
+
+// TopWords returns the n most frequent words sorted by count descending, then by word ascending
+func TopWords(wordCounts map[string]int, n int) []models.WordCount {
+	words := make([]models.WordCount, 0, len(wordCounts))
+
+	for word, count := range wordCounts {
+		words = append(words, models.WordCount{
+			Word:  word,
+			Count: count,
+		})
+	}
+
+	sort.Slice(words, func(i, j int) bool {
+		if words[i].Count == words[j].Count {
+			return words[i].Word < words[j].Word
+		}
+		return words[i].Count > words[j].Count
+	})
+
+	if len(words) < n {
+		return words
+	}
+	return words[:n]
+}
@@ -0,0 +1,124 @@
+package robots
+
+import (
+	"context"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+type Checker interface {
+	// Rules returns the rules for u's host, fetching its robots.txt on first use
+	Rules(ctx context.Context, u *url.URL) (*Rules, error)
+}
+
+// entry is one host's rules; ready is closed once rules is set
+type entry struct {
+	ready chan struct{}
+	rules *Rules
+}
+
+type checker struct {
+	client    *http.Client
+	userAgent string
+	logger    *slog.Logger
+
+	mu    sync.Mutex
+	hosts map[string]*entry
+}
+
+// NewChecker creates a checker that fetches robots.txt with client as userAgent and caches the rules per host
+// for its lifetime; a nil logger logs to slog.Default()
+func NewChecker(client *http.Client, userAgent string, logger *slog.Logger) Checker {
+	return &checker{
+		client:    client,
+		userAgent: userAgent,
+		logger:    logging.OrDefault(logger),
+		hosts:     make(map[string]*entry),
+	}
+}
+
+// Rules fetches each host's robots.txt once, however many callers ask at the same time. A caller whose ctx ends
+// while waiting gets ctx's error and nothing is cached, so the next caller fetches again.
+func (c *checker) Rules(ctx context.Context, u *url.URL) (*Rules, error) {
+	key := u.Scheme + "://" + u.Host
+
+	c.mu.Lock()
+	e, ok := c.hosts[key]
+	if !ok {
+		e = &entry{ready: make(chan struct{})}
+		c.hosts[key] = e
+	}
+	c.mu.Unlock()
+
+	if ok {
+		select {
+		case <-e.ready:
+			if e.rules != nil {
+				return e.rules, nil
+			}
+			// The fetching caller gave up; fetch again
+			return c.Rules(ctx, u)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	rules, err := c.fetch(ctx, key)
+	if err != nil {
+		c.mu.Lock()
+		delete(c.hosts, key)
+		c.mu.Unlock()
+	}
+	e.rules = rules
+	close(e.ready)
+	return rules, err
+}
+
+// fetch applies RFC 9309: a 2xx robots.txt is parsed, a 4xx allows everything and a 5xx or no response
+// disallows everything. It only fails when ctx ends.
+func (c *checker) fetch(ctx context.Context, origin string) (*Rules, error) {
+	robotsURL := origin + "/robots.txt"
+	logger := c.logger.With("url", robotsURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("robots.txt for %s: %w", origin, err)
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	resp, err := c.client.Do(req)
+	switch {
+	case ctx.Err() != nil:
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, ctx.Err()
+	case err != nil:
+		logger.Warn("robots.txt unreachable, disallowing host", "error", err)
+		return DisallowAll(), nil
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		rules := Parse(resp.Body, c.userAgent)
+		if ctx.Err() != nil {
+			// The body may have been cut short
+			return nil, ctx.Err()
+		}
+		logger.Debug("fetched robots.txt", "status", resp.StatusCode, "rules", len(rules.rules), "crawl_delay", rules.CrawlDelay)
+		return rules, nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		logger.Debug("no robots.txt, allowing host", "status", resp.StatusCode)
+		return AllowAll(), nil
+	default:
+		logger.Warn("robots.txt unavailable, disallowing host", "status", resp.StatusCode)
+		return DisallowAll(), nil
+	}
+}
@@ -0,0 +1,174 @@
+package robots
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxCrawlDelay caps the Crawl-delay a robots.txt can impose, so one host cannot stall a run
+const MaxCrawlDelay = time.Minute
+
+// maxFileBytes is how much of a robots.txt is parsed, as RFC 9309 allows
+const maxFileBytes = 500 << 10
+
+// Rule is one Allow or Disallow line of the group that applies to us
+type Rule struct {
+	Allow   bool
+	Pattern string
+}
+
+func (r Rule) String() string {
+	if r.Allow {
+		return "Allow: " + r.Pattern
+	}
+	return "Disallow: " + r.Pattern
+}
+
+// Rules are the robots.txt rules for one user agent on one host
+type Rules struct {
+	rules      []Rule
+	CrawlDelay time.Duration
+}
+
+// AllowAll are the rules of a host without a robots.txt
+func AllowAll() *Rules {
+	return &Rules{}
+}
+
+// DisallowAll are the rules of a host whose robots.txt could not be fetched
+func DisallowAll() *Rules {
+	return &Rules{rules: []Rule{{Pattern: "/"}}}
+}
+
+// Allowed reports whether u may be fetched and, when a rule decided it, which one.
+// The longest matching pattern wins and Allow wins a tie, as RFC 9309 specifies.
+func (r *Rules) Allowed(u *url.URL) (bool, Rule) {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true, Rule{}
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	var best Rule
+	matched := false
+	for _, rule := range r.rules {
+		if !match(rule.Pattern, path) {
+			continue
+		}
+		if !matched || len(rule.Pattern) > len(best.Pattern) || (len(rule.Pattern) == len(best.Pattern) && rule.Allow) {
+			best, matched = rule, true
+		}
+	}
+	return !matched || best.Allow, best
+}
+
+// match reports whether path matches pattern, where * matches any run of characters and a trailing $ anchors the end
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if i == len(parts)-2 && anchored {
+			return strings.HasSuffix(rest, part)
+		}
+		idx := strings.Index(rest, part)
+		if idx < 0 {
+			return false
+		}
+		rest = rest[idx+len(part):]
+	}
+	return !anchored || rest == ""
+}
+
+// Parse reads a robots.txt and returns the rules for userAgent: those of every group naming its product token,
+// or else of the * groups. Unknown lines and lines outside a group are ignored.
+func Parse(r io.Reader, userAgent string) *Rules {
+	token := ProductToken(userAgent)
+
+	var own, wildcard Rules
+	var ownFound bool
+	// The user agents of the group being read; a rule line ends the list so the next user-agent starts a new group
+	var agents []string
+	inRules := false
+
+	scanner := bufio.NewScanner(io.LimitReader(r, maxFileBytes))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			if inRules {
+				agents, inRules = nil, false
+			}
+			agent := ProductToken(value)
+			agents = append(agents, agent)
+			ownFound = ownFound || agent == token
+			continue
+		}
+		if len(agents) == 0 {
+			continue
+		}
+		inRules = true
+
+		for _, agent := range agents {
+			var target *Rules
+			switch {
+			case agent == token:
+				target = &own
+			case agent == "*":
+				target = &wildcard
+			default:
+				continue
+			}
+			target.add(key, value)
+		}
+	}
+
+	if ownFound {
+		return &own
+	}
+	return &wildcard
+}
+
+func (r *Rules) add(key, value string) {
+	switch key {
+	case "allow", "disallow":
+		// An empty Disallow allows everything, which is the default anyway
+		if value != "" {
+			r.rules = append(r.rules, Rule{Allow: key == "allow", Pattern: value})
+		}
+	case "crawl-delay":
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || seconds <= 0 {
+			return
+		}
+		r.CrawlDelay = min(time.Duration(seconds*float64(time.Second)), MaxCrawlDelay)
+	}
+}
+
+// ProductToken is the part of a User-Agent that robots.txt groups name, e.g. "firefly-itzik" of "firefly-itzik/1.0",
+// lowercased for matching
+func ProductToken(userAgent string) string {
+	token, _, _ := strings.Cut(strings.TrimSpace(userAgent), "/")
+	token, _, _ = strings.Cut(token, " ")
+	return strings.ToLower(token)
+}
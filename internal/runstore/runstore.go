@@ -0,0 +1,389 @@
+package runstore
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/results"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SchemaVersion is bumped whenever the record layout changes; stores and run files written by a newer
+// version are refused rather than misread
+const SchemaVersion = 1
+
+const (
+	manifestFile = "store.json"
+	runsDir      = "runs"
+	runExt       = ".ndjson"
+)
+
+// Record types, one JSON record per line of a run file
+const (
+	recordRun   = "run"   // first line: the run header
+	recordEssay = "essay" // an essay with its word counts
+	recordError = "error" // a fetch or processing error
+	recordEnd   = "end"   // last line of a run that finished
+)
+
+// ErrNewerSchema is returned for data written by a newer schema version
+var ErrNewerSchema = errors.New("written by a newer schema version")
+
+// Run summarizes one recorded run. Runs that never finished (crashed or killed) are not Complete, and
+// their totals are recounted from the records that made it to disk.
+type Run struct {
+	ID          string     `json:"id"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	TotalEssays int        `json:"total_essays"`
+	TotalErrors int        `json:"total_errors"`
+	Complete    bool       `json:"complete"`
+}
+
+// Essay is a recorded essay and the words counted in it
+type Essay struct {
+	RunID  string         `json:"run_id"`
+	ID     int            `json:"id"`
+	URL    string         `json:"url"`
+	Title  string         `json:"title"`
+	Time   time.Time      `json:"time"`
+	Counts map[string]int `json:"counts,omitempty"`
+}
+
+// Error is a recorded fetch or processing error
+type Error struct {
+	RunID   string    `json:"run_id"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// record is one line of a run file; only the part matching Type is set
+type record struct {
+	Version int       `json:"v,omitempty"`
+	Type    string    `json:"type"`
+	RunID   string    `json:"run_id"`
+	Time    time.Time `json:"time"`
+
+	Essay       *essayRecord `json:"essay,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	TotalEssays int          `json:"total_essays,omitempty"`
+	TotalErrors int          `json:"total_errors,omitempty"`
+}
+
+// essayRecord is an Essay as stored; the run and time come from the enclosing record
+type essayRecord struct {
+	ID     int            `json:"id"`
+	URL    string         `json:"url"`
+	Title  string         `json:"title"`
+	Counts map[string]int `json:"counts,omitempty"`
+}
+
+// Filter selects the records a query reads; zero values match everything. From is inclusive, To exclusive.
+type Filter struct {
+	RunID string
+	From  time.Time
+	To    time.Time
+}
+
+func (f Filter) matches(t time.Time) bool {
+	return (f.From.IsZero() || !t.Before(f.From)) && (f.To.IsZero() || t.Before(f.To))
+}
+
+// Store keeps every recorded run as an append-only NDJSON file under dir/runs
+type Store interface {
+	NewRun() (Recorder, error)
+	Runs() ([]Run, error)
+	TopWords(filter Filter, n int) ([]models.WordCount, int, error)
+	Essays(filter Filter, word string) ([]Essay, error)
+	Errors(filter Filter) ([]Error, error)
+}
+
+// Recorder appends the essays and errors of one run; its methods are safe for concurrent use
+type Recorder interface {
+	ID() string
+	RecordEssay(essay models.Essay, counts map[string]int)
+	RecordError(err error)
+	// Close ends the run with its totals; a run file without an end record is reported as incomplete
+	Close(totalEssays, totalErrors int) error
+	// Abort closes a run that failed without an end record, so it is reported as incomplete
+	Abort() error
+}
+
+type store struct {
+	dir string
+}
+
+type manifest struct {
+	SchemaVersion int       `json:"schema_version"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Open opens the store in dir, creating it if needed
+func Open(dir string) (Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, runsDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory %s: %w", dir, err)
+	}
+
+	path := filepath.Join(dir, manifestFile)
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		data, _ = json.MarshalIndent(manifest{SchemaVersion: SchemaVersion, CreatedAt: time.Now().UTC()}, "", "  ")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write store manifest: %w", err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to read store manifest: %w", err)
+	default:
+		var m manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("failed to decode store manifest %s: %w", path, err)
+		}
+		if m.SchemaVersion > SchemaVersion {
+			return nil, fmt.Errorf("store %s is %w %d (this build reads up to %d)", dir, ErrNewerSchema, m.SchemaVersion, SchemaVersion)
+		}
+	}
+
+	return &store{dir: dir}, nil
+}
+
+// NewRun starts a run file named after its ID, which sorts by start time
+func (s *store) NewRun() (Recorder, error) {
+	now := time.Now().UTC()
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("failed to generate run ID: %w", err)
+	}
+	id := now.Format("20060102T150405.000000Z") + "-" + hex.EncodeToString(suffix)
+
+	file, err := os.OpenFile(s.runPath(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create run file: %w", err)
+	}
+
+	r := &recorder{id: id, file: file, writer: bufio.NewWriter(file)}
+	r.encoder = json.NewEncoder(r.writer)
+	if err := r.write(record{Version: SchemaVersion, Type: recordRun, RunID: id, Time: now}); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *store) runPath(id string) string {
+	return filepath.Join(s.dir, runsDir, id+runExt)
+}
+
+// runIDs lists the recorded runs oldest first, or just runID when it is set
+func (s *store) runIDs(runID string) ([]string, error) {
+	if runID != "" {
+		if _, err := os.Stat(s.runPath(runID)); strings.ContainsAny(runID, `/\`) || err != nil {
+			return nil, fmt.Errorf("unknown run %s", runID)
+		}
+		return []string{runID}, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(s.dir, runsDir, "*"+runExt))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(paths))
+	for i, path := range paths {
+		ids[i] = strings.TrimSuffix(filepath.Base(path), runExt)
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// scan calls fn for every record of the runs filter selects. A torn last line, left by a run that was
+// killed mid-write, ends its file without an error.
+func (s *store) scan(filter Filter, fn func(r record)) error {
+	ids, err := s.runIDs(filter.RunID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := s.scanRun(id, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *store) scanRun(id string, fn func(r record)) error {
+	file, err := os.Open(s.runPath(id))
+	if err != nil {
+		return fmt.Errorf("failed to open run %s: %w", id, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			if !scanner.Scan() {
+				return nil
+			}
+			return fmt.Errorf("run %s line %d: %w", id, lineNo, err)
+		}
+		if r.Type == recordRun && r.Version > SchemaVersion {
+			return fmt.Errorf("run %s is %w %d", id, ErrNewerSchema, r.Version)
+		}
+		fn(r)
+	}
+	return scanner.Err()
+}
+
+func (s *store) Runs() ([]Run, error) {
+	var runs []Run
+	var current *Run
+
+	err := s.scan(Filter{}, func(r record) {
+		if r.Type != recordRun && current == nil {
+			return
+		}
+		switch r.Type {
+		case recordRun:
+			runs = append(runs, Run{ID: r.RunID, StartedAt: r.Time})
+			current = &runs[len(runs)-1]
+		case recordEssay:
+			current.TotalEssays++
+		case recordError:
+			current.TotalErrors++
+		case recordEnd:
+			finishedAt := r.Time
+			current.FinishedAt = &finishedAt
+			current.TotalEssays, current.TotalErrors = r.TotalEssays, r.TotalErrors
+			current.Complete = true
+		}
+	})
+	return runs, err
+}
+
+// TopWords sums the counts of the essays filter selects and returns the n most frequent words with the number of essays
+func (s *store) TopWords(filter Filter, n int) ([]models.WordCount, int, error) {
+	counts := make(map[string]int)
+	essays := 0
+
+	err := s.scan(filter, func(r record) {
+		if r.Type != recordEssay || !filter.matches(r.Time) {
+			return
+		}
+		essays++
+		for word, count := range r.Essay.Counts {
+			counts[word] += count
+		}
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return results.TopWords(counts, n), essays, nil
+}
+
+// Essays returns the essays filter selects, only those in which word was counted when word is set. Counts are
+// left out of the result, except for word.
+func (s *store) Essays(filter Filter, word string) ([]Essay, error) {
+	word = strings.ToLower(word)
+	var essays []Essay
+
+	err := s.scan(filter, func(r record) {
+		if r.Type != recordEssay || !filter.matches(r.Time) {
+			return
+		}
+		e := Essay{RunID: r.RunID, ID: r.Essay.ID, URL: r.Essay.URL, Title: r.Essay.Title, Time: r.Time, Counts: r.Essay.Counts}
+		if word != "" {
+			if e.Counts[word] == 0 {
+				return
+			}
+			e.Counts = map[string]int{word: e.Counts[word]}
+		} else {
+			e.Counts = nil
+		}
+		essays = append(essays, e)
+	})
+	return essays, err
+}
+
+func (s *store) Errors(filter Filter) ([]Error, error) {
+	var errs []Error
+	err := s.scan(filter, func(r record) {
+		if r.Type == recordError && filter.matches(r.Time) {
+			errs = append(errs, Error{RunID: r.RunID, Message: r.Error, Time: r.Time})
+		}
+	})
+	return errs, err
+}
+
+type recorder struct {
+	id string
+
+	mu      sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	err     error // first write error; later records are dropped and Close reports it
+}
+
+func (r *recorder) ID() string {
+	return r.id
+}
+
+func (r *recorder) RecordEssay(essay models.Essay, counts map[string]int) {
+	r.write(record{Type: recordEssay, RunID: r.id, Time: time.Now().UTC(), Essay: &essayRecord{
+		ID:     essay.ID,
+		URL:    essay.URL,
+		Title:  essay.Title,
+		Counts: counts,
+	}})
+}
+
+func (r *recorder) RecordError(err error) {
+	r.write(record{Type: recordError, RunID: r.id, Time: time.Now().UTC(), Error: err.Error()})
+}
+
+func (r *recorder) write(rec record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err == nil {
+		if err := r.encoder.Encode(rec); err != nil {
+			r.err = fmt.Errorf("failed to record run %s: %w", r.id, err)
+		}
+	}
+	return r.err
+}
+
+func (r *recorder) Close(totalEssays, totalErrors int) error {
+	r.write(record{Type: recordEnd, RunID: r.id, Time: time.Now().UTC(), TotalEssays: totalEssays, TotalErrors: totalErrors})
+	return r.closeFile()
+}
+
+func (r *recorder) Abort() error {
+	return r.closeFile()
+}
+
+// closeFile flushes the records written so far and closes the run file
+func (r *recorder) closeFile() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.writer.Flush(); err != nil && r.err == nil {
+		r.err = fmt.Errorf("failed to record run %s: %w", r.id, err)
+	}
+	if err := r.file.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
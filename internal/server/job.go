@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/config"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobRunning     JobStatus = "running"
+	JobCompleted   JobStatus = "completed"
+	JobTimedOut    JobStatus = "timed_out"
+	JobCanceled    JobStatus = "canceled"
+	JobFailed      JobStatus = "failed"
+	JobInterrupted JobStatus = "interrupted" // was running when the server stopped
+)
+
+// Finished reports whether the job will not change anymore
+func (s JobStatus) Finished() bool {
+	return s != JobRunning
+}
+
+// JobOptions tune a single job; zero values fall back to the server defaults
+type JobOptions struct {
+	TopWords       int             `json:"top_words,omitempty"`
+	RateLimit      int             `json:"rate_limit,omitempty"`
+	MaxHTTPWorkers int             `json:"max_http_workers,omitempty"`
+	Timeout        config.Duration `json:"timeout,omitempty"`
+}
+
+// JobRequest lists the articles to analyze: URLs, and sources whose article links are discovered when the job starts
+type JobRequest struct {
+	URLs    []string   `json:"urls"`
+	Sources []string   `json:"sources,omitempty"` // sitemaps, sitemap indexes or HTML pages, as for the discover command
+	Options JobOptions `json:"options"`
+}
+
+type Job struct {
+	ID          string           `json:"id"`
+	Status      JobStatus        `json:"status"`
+	Options     JobOptions       `json:"options"`
+	Sources     []string         `json:"sources,omitempty"`
+	URLCount    int              `json:"url_count"` // includes the discovered URLs once sources are read
+	SubmittedAt time.Time        `json:"submitted_at"`
+	FinishedAt  *time.Time       `json:"finished_at,omitempty"`
+	Error       string           `json:"error,omitempty"`
+	Progress    *models.Snapshot `json:"progress,omitempty"`
+	Output      *models.Output   `json:"output,omitempty"`
+}
+
+// withDefaults fills unset options from cfg and validates the result against the config limits
+func (o JobOptions) withDefaults(cfg *config.Config) (JobOptions, error) {
+	if o.TopWords == 0 {
+		o.TopWords = cfg.TopWordsCount
+	}
+	if o.RateLimit == 0 {
+		o.RateLimit = cfg.RateLimit
+	}
+	if o.MaxHTTPWorkers == 0 {
+		o.MaxHTTPWorkers = cfg.MaxHTTPWorkers
+	}
+	if o.Timeout == 0 {
+		o.Timeout = config.Duration(cfg.ProcessTimeout)
+	}
+
+	if o.TopWords < config.MinTopWordsCount || o.TopWords > config.MaxTopWordsCount {
+		return o, fmt.Errorf("top_words must be between %d and %d, got %d", config.MinTopWordsCount, config.MaxTopWordsCount, o.TopWords)
+	}
+	if o.RateLimit < config.MinRateLimit || o.RateLimit > config.MaxRateLimit {
+		return o, fmt.Errorf("rate_limit must be between %d and %d, got %d", config.MinRateLimit, config.MaxRateLimit, o.RateLimit)
+	}
+	if o.MaxHTTPWorkers < config.MinWorkers || o.MaxHTTPWorkers > config.MaxWorkers {
+		return o, fmt.Errorf("max_http_workers must be between %d and %d, got %d", config.MinWorkers, config.MaxWorkers, o.MaxHTTPWorkers)
+	}
+	if time.Duration(o.Timeout) < config.MinTimeout || time.Duration(o.Timeout) > config.MaxTimeout {
+		return o, fmt.Errorf("timeout must be between %v and %v, got %v", config.MinTimeout, config.MaxTimeout, time.Duration(o.Timeout))
+	}
+
+	return o, nil
+}
@@ -0,0 +1,407 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/config"
+	"github.com/ireuven89/firefly-itzik/internal/discovery"
+	"github.com/ireuven89/firefly-itzik/internal/essay"
+	"github.com/ireuven89/firefly-itzik/internal/fuzzy"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/metrics"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/processor"
+	"github.com/ireuven89/firefly-itzik/internal/rateLimiter"
+	"github.com/ireuven89/firefly-itzik/internal/tuning"
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrJobNotFound    = errors.New("job not found")
+	ErrJobNotFinished = errors.New("job has not finished")
+	ErrJobNotRunning  = errors.New("job is not running")
+	ErrShuttingDown   = errors.New("server is shutting down")
+)
+
+// JobManager runs analysis jobs concurrently, each with its own rate limiter, fetcher and processor
+type JobManager interface {
+	Submit(req JobRequest) (*Job, error)
+	Get(id string) (*Job, error)
+	List() []*Job
+	Cancel(id string) (*Job, error)
+	Tune(id string, settings tuning.Settings) (*Job, error)
+	SetDefaults(cfg *config.Config)
+	ReloadWordBank(ctx context.Context) error
+	Shutdown()
+}
+
+type runningJob struct {
+	cancel    context.CancelFunc
+	processor processor.WordProcessor
+	tuner     tuning.Tuner
+	ready     chan struct{} // closed once tuner is set
+	done      chan struct{}
+}
+
+type jobManager struct {
+	wordBank wordbank.WordBank
+	fuzzy    fuzzy.Matcher // shared by every job, built once from the word bank
+	store    *jobStore
+	logger   *slog.Logger
+	metrics  *metrics.Metrics
+
+	mu           sync.RWMutex
+	cfg          *config.Config
+	jobs         map[string]*Job
+	running      map[string]*runningJob
+	shuttingDown bool
+}
+
+// NewJobManager loads persisted jobs from dataDir; jobs that were still running when the server stopped are marked interrupted.
+// A nil logger logs to slog.Default() and nil metrics record nothing.
+func NewJobManager(cfg *config.Config, wordBank wordbank.WordBank, dataDir string, logger *slog.Logger, m *metrics.Metrics) (JobManager, error) {
+	store, err := newJobStore(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	jm := &jobManager{
+		cfg:      cfg,
+		wordBank: wordBank,
+		store:    store,
+		logger:   logging.OrDefault(logger),
+		metrics:  m,
+		jobs:     make(map[string]*Job),
+		running:  make(map[string]*runningJob),
+	}
+	if cfg.FuzzyDistance > 0 {
+		jm.fuzzy = fuzzy.NewWordBankMatcher(wordBank, cfg.FuzzyDistance)
+	}
+
+	persisted, err := store.loadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range persisted {
+		if job.Status == JobRunning {
+			job.Status = JobInterrupted
+			job.Progress = nil
+			if err := store.save(job); err != nil {
+				return nil, err
+			}
+		}
+		jm.jobs[job.ID] = job
+	}
+
+	return jm, nil
+}
+
+func (jm *jobManager) Submit(req JobRequest) (*Job, error) {
+	if len(req.URLs) == 0 && len(req.Sources) == 0 {
+		return nil, fmt.Errorf("job must contain at least one URL or source")
+	}
+	jm.mu.RLock()
+	cfg, shuttingDown := jm.cfg, jm.shuttingDown
+	jm.mu.RUnlock()
+	if shuttingDown {
+		return nil, ErrShuttingDown
+	}
+
+	options, err := req.Options.withDefaults(cfg)
+	if err != nil {
+		return nil, err
+	}
+	fetchOptions, err := cfg.FetchOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{
+		ID:          id,
+		Status:      JobRunning,
+		Options:     options,
+		Sources:     req.Sources,
+		URLCount:    len(req.URLs),
+		SubmittedAt: time.Now().UTC(),
+	}
+	if err := jm.store.save(job); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(options.Timeout))
+	run := &runningJob{
+		cancel: cancel,
+		processor: processor.NewWordProcessorWithOptions(jm.wordBank, processor.Options{
+			POS:            config.SplitList(cfg.POSFilter),
+			Tags:           config.SplitList(cfg.TagFilter),
+			Weighted:       cfg.WeightedCounts,
+			Fuzzy:          jm.fuzzy,
+			NearDuplicates: cfg.NearDuplicateOptions(),
+			Logger:         jm.logger.With("job", job.ID),
+			Metrics:        jm.metrics,
+		}),
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	// Shutdown may have started since the check above; it would never cancel a job added after it
+	jm.mu.Lock()
+	if jm.shuttingDown {
+		jm.mu.Unlock()
+		cancel()
+		job.Status = JobInterrupted
+		if err := jm.store.save(job); err != nil {
+			jm.logger.Error("failed to persist job", "job", job.ID, "error", err)
+		}
+		return nil, ErrShuttingDown
+	}
+	jm.jobs[job.ID] = job
+	jm.running[job.ID] = run
+	jm.mu.Unlock()
+
+	go jm.run(ctx, cfg, job.ID, req, options, fetchOptions, run)
+
+	return jm.Get(job.ID)
+}
+
+// Get returns a copy of the job, with live progress while it runs
+func (jm *jobManager) Get(id string) (*Job, error) {
+	jm.mu.RLock()
+	job, ok := jm.jobs[id]
+	if !ok {
+		jm.mu.RUnlock()
+		return nil, ErrJobNotFound
+	}
+	snapshot := *job
+	run, running := jm.running[id]
+	jm.mu.RUnlock()
+
+	// Snapshot ranks every counted word, so it is taken without blocking other calls
+	if running {
+		progress := run.processor.Snapshot()
+		snapshot.Progress = &progress
+	}
+	return &snapshot, nil
+}
+
+// List returns every job, most recently submitted first, without outputs
+func (jm *jobManager) List() []*Job {
+	jm.mu.RLock()
+	defer jm.mu.RUnlock()
+
+	jobs := make([]*Job, 0, len(jm.jobs))
+	for _, job := range jm.jobs {
+		summary := *job
+		summary.Output = nil
+		summary.Progress = nil
+		jobs = append(jobs, &summary)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].SubmittedAt.After(jobs[j].SubmittedAt)
+	})
+	return jobs
+}
+
+// Cancel stops a running job and waits for it to be persisted as canceled
+func (jm *jobManager) Cancel(id string) (*Job, error) {
+	jm.mu.RLock()
+	_, exists := jm.jobs[id]
+	run, running := jm.running[id]
+	jm.mu.RUnlock()
+
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+	if running {
+		run.cancel()
+		<-run.done
+	}
+
+	return jm.Get(id)
+}
+
+// Tune changes the rate limit and worker count of a running job
+func (jm *jobManager) Tune(id string, settings tuning.Settings) (*Job, error) {
+	jm.mu.RLock()
+	_, exists := jm.jobs[id]
+	run, running := jm.running[id]
+	jm.mu.RUnlock()
+
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+	if !running {
+		return nil, ErrJobNotRunning
+	}
+
+	<-run.ready
+	if err := run.tuner.Apply(settings); err != nil {
+		return nil, err
+	}
+
+	applied := run.tuner.Settings()
+	jm.mu.Lock()
+	if job, ok := jm.jobs[id]; ok {
+		job.Options.RateLimit = applied.RateLimit
+		job.Options.MaxHTTPWorkers = applied.MaxHTTPWorkers
+	}
+	jm.mu.Unlock()
+
+	return jm.Get(id)
+}
+
+// SetDefaults replaces the configuration used for options of jobs submitted from now on
+func (jm *jobManager) SetDefaults(cfg *config.Config) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	jm.cfg = cfg
+}
+
+// ReloadWordBank reloads the shared word bank from the configured file; running jobs pick up the new words immediately
+func (jm *jobManager) ReloadWordBank(ctx context.Context) error {
+	jm.mu.RLock()
+	path := jm.cfg.WordBankPath()
+	jm.mu.RUnlock()
+
+	return jm.wordBank.LoadWords(ctx, path)
+}
+
+// Shutdown cancels all running jobs; they are persisted as interrupted
+func (jm *jobManager) Shutdown() {
+	jm.mu.Lock()
+	jm.shuttingDown = true
+	runs := make([]*runningJob, 0, len(jm.running))
+	for _, run := range jm.running {
+		runs = append(runs, run)
+	}
+	jm.mu.Unlock()
+
+	for _, run := range runs {
+		run.cancel()
+		<-run.done
+	}
+}
+
+func (jm *jobManager) run(ctx context.Context, cfg *config.Config, id string, req JobRequest, options JobOptions, fetchOptions essay.Options, run *runningJob) {
+	defer close(run.done)
+	defer run.cancel()
+
+	limiter := rateLimiter.NewRateLimiter(options.RateLimit, time.Second)
+	defer limiter.Stop()
+
+	fetcher := essay.NewEssayFetcherWithOptions(limiter, "", options.MaxHTTPWorkers, cfg.HTTPRetryDelay, jm.logger.With("job", id), jm.metrics, fetchOptions)
+	run.tuner = tuning.NewTuner(limiter, fetcher, jm.wordBank, cfg.WordBankPath(), config.MinRateLimit, config.MaxRateLimit, config.MinWorkers, config.MaxWorkers)
+	close(run.ready)
+
+	essayStream := make(chan models.Essay, cfg.EssayStreamBuffer)
+	errorChan := make(chan error, cfg.ErrorChannelBuffer)
+
+	sourceErr := make(chan error, 1)
+	go func() {
+		defer close(essayStream)
+		defer close(errorChan)
+
+		urls, err := jm.jobURLs(ctx, cfg, id, req)
+		sourceErr <- err
+		if err != nil {
+			return
+		}
+
+		if err := fetcher.StreamURLs(ctx, urls, essayStream, errorChan); err != nil {
+			select {
+			case errorChan <- err:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	topWords, totalEssays, totalErrors := run.processor.ProcessEssayStream(ctx, essayStream, errorChan, options.TopWords)
+	finishedAt := time.Now().UTC()
+	progress := run.processor.Snapshot()
+	result := run.processor.Result()
+	result.Duplicates = fetcher.Duplicates()
+	result.NearDuplicates = run.processor.NearDuplicateReport()
+	resultErr := jm.store.saveResult(id, result)
+	discoverErr := <-sourceErr
+
+	jm.mu.Lock()
+	job := jm.jobs[id]
+	switch {
+	case discoverErr != nil && ctx.Err() == nil:
+		job.Status = JobFailed
+		job.Error = discoverErr.Error()
+	case resultErr != nil:
+		job.Status = JobFailed
+		job.Error = resultErr.Error()
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		job.Status = JobTimedOut
+	case errors.Is(ctx.Err(), context.Canceled) && jm.shuttingDown:
+		job.Status = JobInterrupted
+	case errors.Is(ctx.Err(), context.Canceled):
+		job.Status = JobCanceled
+	default:
+		job.Status = JobCompleted
+	}
+	job.FinishedAt = &finishedAt
+	job.Progress = &progress
+	job.Output = &models.Output{
+		TopWords:         topWords,
+		TotalEssays:      totalEssays,
+		TotalErrors:      totalErrors,
+		ErrorsByCategory: result.ErrorsByCategory,
+		Duplicates:       result.Duplicates,
+		NearDuplicates:   result.NearDuplicates,
+		Timestamp:        finishedAt,
+	}
+	if banks, ok := jm.wordBank.(wordbank.Collection); ok && cfg.WordBankBreakdown {
+		job.Output.ByBank = processor.TopWordsByBank(result.WordCounts, banks, options.TopWords, cfg.WeightedCounts)
+	}
+	delete(jm.running, id)
+	finished := *job
+	jm.mu.Unlock()
+
+	if err := jm.store.save(&finished); err != nil {
+		jm.logger.Error("failed to persist job", "job", id, "error", err)
+	}
+}
+
+// jobURLs returns the URLs of req followed by those discovered from its sources, and records their count on the job
+func (jm *jobManager) jobURLs(ctx context.Context, cfg *config.Config, id string, req JobRequest) ([]string, error) {
+	if len(req.Sources) == 0 {
+		return req.URLs, nil
+	}
+
+	discovered, err := discovery.NewDiscoverer(&http.Client{Timeout: cfg.HTTPTimeout}, nil).Discover(ctx, req.Sources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover URLs: %w", err)
+	}
+	urls := append(slices.Clone(req.URLs), discovered...)
+
+	jm.mu.Lock()
+	jm.jobs[id].URLCount = len(urls)
+	jm.mu.Unlock()
+	return urls, nil
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/internal/results"
+	"os"
+	"path/filepath"
+)
+
+// jobStore persists jobs as <dir>/<id>.json, with full counts of finished jobs in <id>.result.json.gz
+type jobStore struct {
+	dir string
+}
+
+func newJobStore(dir string) (*jobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create job store directory %s: %w", dir, err)
+	}
+	return &jobStore{dir: dir}, nil
+}
+
+// save writes the job atomically so a crash never leaves a truncated file behind
+func (s *jobStore) save(job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode job %s: %w", job.ID, err)
+	}
+
+	tmp := s.jobPath(job.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write job %s: %w", job.ID, err)
+	}
+	return os.Rename(tmp, s.jobPath(job.ID))
+}
+
+func (s *jobStore) saveResult(id string, r *results.Result) error {
+	return results.Save(s.resultPath(id), r)
+}
+
+// loadAll reads every persisted job
+func (s *jobStore) loadAll() ([]*Job, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*Job, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read job file %s: %w", path, err)
+		}
+
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, fmt.Errorf("failed to decode job file %s: %w", path, err)
+		}
+		jobs = append(jobs, &job)
+	}
+
+	return jobs, nil
+}
+
+func (s *jobStore) jobPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *jobStore) resultPath(id string) string {
+	return filepath.Join(s.dir, id+".result.json.gz")
+}
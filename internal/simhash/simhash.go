@@ -0,0 +1,122 @@
+package simhash
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"strings"
+)
+
+// ShingleSize is the number of consecutive tokens hashed together, so word order counts
+const ShingleSize = 3
+
+// Fingerprint is the 64-bit SimHash of a text; similar texts differ in few bits
+type Fingerprint uint64
+
+// Of fingerprints tokens by their overlapping shingles; fewer tokens than a shingle are hashed as one
+func Of(tokens []string) Fingerprint {
+	var weights [64]int
+	add := func(shingle []string) {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(shingle, " ")))
+		sum := h.Sum64()
+		for bit := range weights {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	if len(tokens) < ShingleSize {
+		add(tokens)
+	}
+	for i := 0; i+ShingleSize <= len(tokens); i++ {
+		add(tokens[i : i+ShingleSize])
+	}
+
+	var f Fingerprint
+	for bit, weight := range weights {
+		if weight > 0 {
+			f |= 1 << bit
+		}
+	}
+	return f
+}
+
+// Distance is the number of bits f and other differ in
+func (f Fingerprint) Distance(other Fingerprint) int {
+	return bits.OnesCount64(uint64(f ^ other))
+}
+
+// Similarity is the fraction of bits f and other share, 1 for identical fingerprints
+func (f Fingerprint) Similarity(other Fingerprint) float64 {
+	return 1 - float64(f.Distance(other))/64
+}
+
+// Index finds an added fingerprint at least threshold similar to a new one without comparing against all of them.
+// Fingerprints within d bits of each other agree exactly on at least one of d+1 bands, so only fingerprints
+// sharing a band are compared.
+type Index struct {
+	maxDistance  int
+	bands        []band
+	fingerprints []Fingerprint
+}
+
+type band struct {
+	shift   int
+	mask    uint64
+	buckets map[uint64][]int
+}
+
+// NewIndex indexes fingerprints for lookups at the given similarity threshold, between 0 and 1
+func NewIndex(threshold float64) *Index {
+	maxDistance := int(math.Floor((1 - threshold) * 64))
+	maxDistance = min(max(maxDistance, 0), 63)
+
+	n := maxDistance + 1
+	ix := &Index{maxDistance: maxDistance, bands: make([]band, n)}
+	for i := range ix.bands {
+		start, end := i*64/n, (i+1)*64/n
+		ix.bands[i] = band{
+			shift:   start,
+			mask:    math.MaxUint64 >> (64 - (end - start)),
+			buckets: make(map[uint64][]int),
+		}
+	}
+	return ix
+}
+
+// Add indexes f and returns its id, the number of fingerprints added before it
+func (ix *Index) Add(f Fingerprint) int {
+	id := len(ix.fingerprints)
+	ix.fingerprints = append(ix.fingerprints, f)
+	for _, b := range ix.bands {
+		key := uint64(f) >> b.shift & b.mask
+		b.buckets[key] = append(b.buckets[key], id)
+	}
+	return id
+}
+
+// Nearest returns the id of the closest indexed fingerprint within the threshold, the earliest added on ties
+func (ix *Index) Nearest(f Fingerprint) (int, float64, bool) {
+	best, bestDistance := -1, ix.maxDistance+1
+	for _, b := range ix.bands {
+		for _, id := range b.buckets[uint64(f)>>b.shift&b.mask] {
+			distance := f.Distance(ix.fingerprints[id])
+			if distance < bestDistance || (distance == bestDistance && id < best) {
+				best, bestDistance = id, distance
+			}
+		}
+	}
+	if best < 0 {
+		return 0, 0, false
+	}
+	return best, f.Similarity(ix.fingerprints[best]), true
+}
+
+// Len is the number of fingerprints added
+func (ix *Index) Len() int {
+	return len(ix.fingerprints)
+}
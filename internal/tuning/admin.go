@@ -0,0 +1,53 @@
+package tuning
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// NewAdminHandler exposes the tuner over HTTP:
+//
+//	GET  /admin/tuning           current settings
+//	PUT  /admin/tuning           apply Settings, omitted or zero fields are unchanged
+//	POST /admin/wordbank/reload  reload the word bank file
+func NewAdminHandler(t Tuner) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /admin/tuning", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, t.Settings())
+	})
+
+	mux.HandleFunc("PUT /admin/tuning", func(w http.ResponseWriter, r *http.Request) {
+		var settings Settings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid settings: %w", err))
+			return
+		}
+		if err := t.Apply(settings); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, t.Settings())
+	})
+
+	mux.HandleFunc("POST /admin/wordbank/reload", func(w http.ResponseWriter, r *http.Request) {
+		if err := t.ReloadWordBank(r.Context()); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,93 @@
+package tuning
+
+import (
+	"context"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/internal/essay"
+	"github.com/ireuven89/firefly-itzik/internal/rateLimiter"
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"sync"
+)
+
+// Settings are the knobs that can change while a run is in progress
+type Settings struct {
+	RateLimit      int `json:"rate_limit"`
+	MaxHTTPWorkers int `json:"max_http_workers"`
+}
+
+// Tuner applies runtime changes to a live limiter, fetcher and word bank
+type Tuner interface {
+	Settings() Settings
+	Apply(settings Settings) error
+	ReloadWordBank(ctx context.Context) error
+	SetWordBankPath(path string)
+}
+
+type tuner struct {
+	limiter  rateLimiter.RateLimiter
+	fetcher  essay.EssayFetcher
+	wordBank wordbank.WordBank
+
+	mu           sync.Mutex
+	wordBankPath string
+	minRate      int
+	maxRate      int
+	minWorkers   int
+	maxWorkers   int
+}
+
+// NewTuner returns a tuner that accepts rate limits within [minRate, maxRate] and worker counts within [minWorkers, maxWorkers]
+func NewTuner(limiter rateLimiter.RateLimiter, fetcher essay.EssayFetcher, wordBank wordbank.WordBank, wordBankPath string, minRate, maxRate, minWorkers, maxWorkers int) Tuner {
+	return &tuner{
+		limiter:      limiter,
+		fetcher:      fetcher,
+		wordBank:     wordBank,
+		wordBankPath: wordBankPath,
+		minRate:      minRate,
+		maxRate:      maxRate,
+		minWorkers:   minWorkers,
+		maxWorkers:   maxWorkers,
+	}
+}
+
+func (t *tuner) Settings() Settings {
+	return Settings{
+		RateLimit:      t.limiter.Rate(),
+		MaxHTTPWorkers: t.fetcher.MaxWorkers(),
+	}
+}
+
+// Apply validates and applies settings; zero values leave the current value unchanged
+func (t *tuner) Apply(settings Settings) error {
+	if settings.RateLimit != 0 && (settings.RateLimit < t.minRate || settings.RateLimit > t.maxRate) {
+		return fmt.Errorf("rate limit must be between %d and %d, got %d", t.minRate, t.maxRate, settings.RateLimit)
+	}
+	if settings.MaxHTTPWorkers != 0 && (settings.MaxHTTPWorkers < t.minWorkers || settings.MaxHTTPWorkers > t.maxWorkers) {
+		return fmt.Errorf("max HTTP workers must be between %d and %d, got %d", t.minWorkers, t.maxWorkers, settings.MaxHTTPWorkers)
+	}
+
+	if settings.RateLimit != 0 {
+		t.limiter.SetRate(settings.RateLimit)
+	}
+	if settings.MaxHTTPWorkers != 0 {
+		t.fetcher.SetMaxWorkers(settings.MaxHTTPWorkers)
+	}
+	return nil
+}
+
+// ReloadWordBank reloads the word bank from its current path; on failure the previous words stay in use
+func (t *tuner) ReloadWordBank(ctx context.Context) error {
+	t.mu.Lock()
+	path := t.wordBankPath
+	t.mu.Unlock()
+
+	return t.wordBank.LoadWords(ctx, path)
+}
+
+// SetWordBankPath changes the file used by later reloads
+func (t *tuner) SetWordBankPath(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.wordBankPath = path
+}
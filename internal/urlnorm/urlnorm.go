@@ -0,0 +1,104 @@
+package urlnorm
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// DefaultStripParams are tracking parameters that never change which article a URL points to
+var DefaultStripParams = []string{"utm_*", "fbclid", "gclid", "mc_cid", "mc_eid", "ref", "ncid", "guccounter"}
+
+// defaultPorts are dropped from hosts
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// Normalizer canonicalizes article URLs so variants of one URL compare equal
+type Normalizer struct {
+	stripParams []string
+}
+
+// NewNormalizer strips the query parameters named in stripParams; a trailing * matches any name with that prefix
+func NewNormalizer(stripParams []string) *Normalizer {
+	return &Normalizer{stripParams: stripParams}
+}
+
+// Normalize lowercases the scheme and host, drops default ports, the fragment and stripped parameters,
+// sorts the remaining parameters and gives an empty path a "/". The result is still fetchable as is.
+func (n *Normalizer) Normalize(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%q is not an absolute URL", raw)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); port != "" && port == defaultPorts[u.Scheme] {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+	u.Fragment, u.RawFragment = "", ""
+	if u.Path == "" {
+		u.Path, u.RawPath = "/", ""
+	}
+
+	if u.RawQuery != "" {
+		query := u.Query()
+		for name := range query {
+			if n.stripped(name) {
+				query.Del(name)
+			}
+		}
+		// Encode sorts by name
+		u.RawQuery = query.Encode()
+	}
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+func (n *Normalizer) stripped(name string) bool {
+	name = strings.ToLower(name)
+	return slices.ContainsFunc(n.stripParams, func(pattern string) bool {
+		pattern = strings.ToLower(pattern)
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			return strings.HasPrefix(name, prefix)
+		}
+		return name == pattern
+	})
+}
+
+// Unique normalizes urls, dropping variants of a URL earlier in the list, and returns how many it dropped.
+// URLs that cannot be normalized are kept as they are.
+func (n *Normalizer) Unique(urls []string) ([]string, int) {
+	seen := make(map[string]bool, len(urls))
+	unique := make([]string, 0, len(urls))
+	for _, raw := range urls {
+		normalized, err := n.Normalize(raw)
+		if err != nil {
+			unique = append(unique, raw)
+			continue
+		}
+		if key := Key(normalized); !seen[key] {
+			seen[key] = true
+			unique = append(unique, normalized)
+		}
+	}
+	return unique, len(urls) - len(unique)
+}
+
+// Key identifies a normalized URL for deduplication: http and https and a trailing slash do not make another article
+func Key(normalized string) string {
+	_, rest, ok := strings.Cut(normalized, "://")
+	if !ok {
+		return normalized
+	}
+	path, query, hasQuery := strings.Cut(rest, "?")
+	path = strings.TrimSuffix(path, "/")
+	if hasQuery {
+		return path + "?" + query
+	}
+	return path
+}
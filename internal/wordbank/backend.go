@@ -0,0 +1,189 @@
+package wordbank
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Backend selects how a word bank stores its words
+type Backend string
+
+const (
+	// BackendMap is a hash set: fastest lookups, most memory
+	BackendMap Backend = "map"
+	// BackendSorted packs the words into one string searched by binary search
+	BackendSorted Backend = "sorted"
+	// BackendBloom puts a Bloom filter in front of the sorted backend so most misses skip the search
+	BackendBloom Backend = "bloom"
+)
+
+// Backends lists the available backends
+func Backends() []Backend {
+	return []Backend{BackendMap, BackendSorted, BackendBloom}
+}
+
+// ParseBackend validates a backend name; empty selects BackendMap
+func ParseBackend(name string) (Backend, error) {
+	if name == "" {
+		return BackendMap, nil
+	}
+	for _, backend := range Backends() {
+		if string(backend) == name {
+			return backend, nil
+		}
+	}
+	return "", fmt.Errorf("unknown word bank backend %q (available: map, sorted, bloom)", name)
+}
+
+// wordSet is an immutable set of normalized words
+type wordSet interface {
+	contains(word string) bool
+	size() int
+	each(fn func(word string))
+}
+
+// newWordSet builds a set for backend from sorted, de-duplicated words
+func newWordSet(backend Backend, words []string) wordSet {
+	switch backend {
+	case BackendSorted:
+		return newSortedSet(words)
+	case BackendBloom:
+		return newBloomSet(words)
+	default:
+		return newMapSet(words)
+	}
+}
+
+type mapSet map[string]struct{}
+
+func newMapSet(words []string) mapSet {
+	set := make(mapSet, len(words))
+	for _, word := range words {
+		set[word] = struct{}{}
+	}
+	return set
+}
+
+func (s mapSet) contains(word string) bool {
+	_, ok := s[word]
+	return ok
+}
+
+func (s mapSet) size() int {
+	return len(s)
+}
+
+func (s mapSet) each(fn func(word string)) {
+	for word := range s {
+		fn(word)
+	}
+}
+
+// sortedSet stores every word back to back in one string; word i is data[offsets[i]:offsets[i+1]]
+type sortedSet struct {
+	data    string
+	offsets []uint32
+}
+
+func newSortedSet(words []string) *sortedSet {
+	var data strings.Builder
+	offsets := make([]uint32, 0, len(words)+1)
+	for _, word := range words {
+		offsets = append(offsets, uint32(data.Len()))
+		data.WriteString(word)
+	}
+	offsets = append(offsets, uint32(data.Len()))
+
+	return &sortedSet{data: data.String(), offsets: offsets}
+}
+
+func (s *sortedSet) word(i int) string {
+	return s.data[s.offsets[i]:s.offsets[i+1]]
+}
+
+func (s *sortedSet) contains(word string) bool {
+	n := s.size()
+	i := sort.Search(n, func(i int) bool { return s.word(i) >= word })
+	return i < n && s.word(i) == word
+}
+
+func (s *sortedSet) size() int {
+	return len(s.offsets) - 1
+}
+
+func (s *sortedSet) each(fn func(word string)) {
+	for i := 0; i < s.size(); i++ {
+		fn(s.word(i))
+	}
+}
+
+// Bloom filter sizing for a 1% false positive rate
+const (
+	bloomFalsePositiveRate = 0.01
+	bloomHashes            = 7
+)
+
+// bloomSet answers most misses from the filter and confirms possible hits against the exact set
+type bloomSet struct {
+	bits  []uint64
+	exact *sortedSet
+}
+
+func newBloomSet(words []string) *bloomSet {
+	n := max(len(words), 1)
+	m := uint64(math.Ceil(-float64(n) * math.Log(bloomFalsePositiveRate) / (math.Ln2 * math.Ln2)))
+
+	s := &bloomSet{
+		bits:  make([]uint64, (m+63)/64),
+		exact: newSortedSet(words),
+	}
+	for _, word := range words {
+		s.add(word)
+	}
+	return s
+}
+
+func (s *bloomSet) add(word string) {
+	h1, h2 := bloomHash(word)
+	m := uint64(len(s.bits)) * 64
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % m
+		s.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (s *bloomSet) mayContain(word string) bool {
+	h1, h2 := bloomHash(word)
+	m := uint64(len(s.bits)) * 64
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % m
+		if s.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *bloomSet) contains(word string) bool {
+	return s.mayContain(word) && s.exact.contains(word)
+}
+
+func (s *bloomSet) size() int {
+	return s.exact.size()
+}
+
+func (s *bloomSet) each(fn func(word string)) {
+	s.exact.each(fn)
+}
+
+// bloomHash derives the two hashes for double hashing from one 64-bit FNV-1a hash
+func bloomHash(word string) (uint64, uint64) {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(word); i++ {
+		h ^= uint64(word[i])
+		h *= 1099511628211
+	}
+	return h, h>>32 | 1
+}
@@ -0,0 +1,182 @@
+package wordbank
+
+import (
+	"context"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"log/slog"
+	"strings"
+)
+
+// BankFile is a named word bank and the file it is loaded from
+type BankFile struct {
+	Name string
+	Path string
+}
+
+// Collection is a set of named word banks composed by a set expression. Contains matches the
+// words the expression selects, and Sources attributes a word to the member banks holding it.
+type Collection interface {
+	WordBank
+	Names() []string
+	Files() []string
+	Sources(word string) []string
+}
+
+type member struct {
+	BankFile
+	bank *wordBank
+}
+
+type collection struct {
+	members []member
+	byName  map[string]WordBank
+	expr    setExpr
+}
+
+// ParseBankFiles parses "name=path,name=path"; names must be unique and usable in expressions
+func ParseBankFiles(spec string) ([]BankFile, error) {
+	var files []BankFile
+	seen := make(map[string]bool)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, path, ok := strings.Cut(entry, "=")
+		name, path = strings.TrimSpace(name), strings.TrimSpace(path)
+		if !ok || path == "" {
+			return nil, fmt.Errorf("word bank %q must be written as name=path", entry)
+		}
+		if !isBankName(name) {
+			return nil, fmt.Errorf("word bank name %q may only contain letters, digits and _", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("word bank %q is defined more than once", name)
+		}
+		seen[name] = true
+
+		files = append(files, BankFile{Name: name, Path: path})
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no word banks in %q", spec)
+	}
+	return files, nil
+}
+
+// NewCollection loads every bank into backend and composes them with expr; an empty expr is the union of all banks
+func NewCollection(ctx context.Context, files []BankFile, expr string, backend Backend, logger *slog.Logger) (Collection, error) {
+	c := &collection{byName: make(map[string]WordBank, len(files))}
+	logger = logging.OrDefault(logger)
+
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		bank := newEmptyWordBank(backend, logger.With("bank", file.Name))
+		if err := bank.LoadWords(ctx, file.Path); err != nil {
+			return nil, fmt.Errorf("word bank %s: %w", file.Name, err)
+		}
+
+		c.members = append(c.members, member{BankFile: file, bank: bank})
+		c.byName[file.Name] = bank
+		names = append(names, file.Name)
+	}
+
+	if expr == "" {
+		expr = strings.Join(names, " | ")
+	}
+	parsed, err := parseExpression(expr, names)
+	if err != nil {
+		return nil, err
+	}
+	c.expr = parsed
+
+	return c, nil
+}
+
+func (c *collection) Contains(word string) bool {
+	return c.expr.contains(c.byName, strings.ToLower(word))
+}
+
+// Lookup returns the entry from the first member bank, in declaration order, that has metadata for word
+func (c *collection) Lookup(word string) (Entry, bool) {
+	word = strings.ToLower(word)
+	if !c.Contains(word) {
+		return Entry{}, false
+	}
+	for _, m := range c.members {
+		if entry, ok := m.bank.Lookup(word); ok && entry.HasMetadata() {
+			return entry, true
+		}
+	}
+	return Entry{Word: word}, true
+}
+
+// LoadWords reloads the member bank read from path, or every member when path is empty.
+// Members keep their previous words when their reload fails.
+func (c *collection) LoadWords(ctx context.Context, path string) error {
+	reloaded := false
+	for _, m := range c.members {
+		if path != "" && m.Path != path {
+			continue
+		}
+		if err := m.bank.LoadWords(ctx, m.Path); err != nil {
+			return fmt.Errorf("word bank %s: %w", m.Name, err)
+		}
+		reloaded = true
+	}
+
+	if !reloaded {
+		return fmt.Errorf("no word bank is loaded from %s", path)
+	}
+	return nil
+}
+
+// Each calls fn once for every distinct word the expression selects
+func (c *collection) Each(fn func(word string)) {
+	seen := make(map[string]bool)
+	for _, m := range c.members {
+		m.bank.Each(func(word string) {
+			if !seen[word] && c.expr.contains(c.byName, word) {
+				seen[word] = true
+				fn(word)
+			}
+		})
+	}
+}
+
+// Size counts the distinct words the expression selects
+func (c *collection) Size() int {
+	size := 0
+	c.Each(func(string) { size++ })
+	return size
+}
+
+func (c *collection) Names() []string {
+	names := make([]string, len(c.members))
+	for i, m := range c.members {
+		names[i] = m.Name
+	}
+	return names
+}
+
+func (c *collection) Files() []string {
+	files := make([]string, len(c.members))
+	for i, m := range c.members {
+		files[i] = m.Path
+	}
+	return files
+}
+
+// Sources returns the names of the banks containing word, in declaration order
+func (c *collection) Sources(word string) []string {
+	var sources []string
+	for _, m := range c.members {
+		if m.bank.Contains(word) {
+			sources = append(sources, m.Name)
+		}
+	}
+	return sources
+}
@@ -0,0 +1,147 @@
+package wordbank
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Entry is a word bank word with its optional metadata
+type Entry struct {
+	Word      string   `json:"word"`
+	POS       string   `json:"pos,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Weight    float64  `json:"weight,omitempty"` // 0 means unweighted, counted as 1
+	Canonical string   `json:"canonical,omitempty"`
+}
+
+// HasMetadata reports whether the entry carries anything beyond the word itself
+func (e Entry) HasMetadata() bool {
+	return e.POS != "" || len(e.Tags) > 0 || e.Weight != 0 || e.Canonical != ""
+}
+
+// EffectiveWeight is the weight to multiply counts by
+func (e Entry) EffectiveWeight() float64 {
+	if e.Weight == 0 {
+		return 1
+	}
+	return e.Weight
+}
+
+// HasTag reports whether the entry carries any of tags, ignoring case
+func (e Entry) HasTag(tags ...string) bool {
+	for _, tag := range tags {
+		if slices.ContainsFunc(e.Tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// readEntries reads a word bank file in the format chosen by its extension:
+//
+//	.tsv   word<TAB>pos<TAB>tags (comma-separated)<TAB>weight<TAB>canonical, trailing columns optional
+//	.json  an array of Entry objects
+//	other  one word per line
+//
+// Empty lines and lines starting with # are skipped in the line-based formats.
+func readEntries(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open word bank file: %w", err)
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		var entries []Entry
+		if err := json.NewDecoder(file).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("error reading word bank file: %w", err)
+		}
+		for i := range entries {
+			entry, err := entries[i].normalize()
+			if err != nil {
+				return nil, fmt.Errorf("word bank entry %d: %w", i+1, err)
+			}
+			entries[i] = entry
+		}
+		return entries, nil
+	case ".tsv":
+		return readLines(file, parseTSVEntry)
+	default:
+		return readLines(file, func(line string) (Entry, error) {
+			return Entry{Word: line}, nil
+		})
+	}
+}
+
+func readLines(file *os.File, parse func(line string) (Entry, error)) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		// Skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry, err := parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("word bank line %d: %w", lineNo, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading word bank file: %w", err)
+	}
+	return entries, nil
+}
+
+func parseTSVEntry(line string) (Entry, error) {
+	columns := strings.Split(line, "\t")
+	for i := range columns {
+		columns[i] = strings.TrimSpace(columns[i])
+	}
+
+	entry := Entry{Word: columns[0]}
+	if len(columns) > 1 {
+		entry.POS = columns[1]
+	}
+	if len(columns) > 2 && columns[2] != "" {
+		for _, tag := range strings.Split(columns[2], ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				entry.Tags = append(entry.Tags, tag)
+			}
+		}
+	}
+	if len(columns) > 3 && columns[3] != "" {
+		weight, err := strconv.ParseFloat(columns[3], 64)
+		if err != nil {
+			return Entry{}, fmt.Errorf("weight %q of %q is not a non-negative number", columns[3], entry.Word)
+		}
+		entry.Weight = weight
+	}
+	if len(columns) > 4 {
+		entry.Canonical = columns[4]
+	}
+	return entry.normalize()
+}
+
+// normalize lowercases the part of speech and tags and rejects negative weights, the same for every file format
+func (e Entry) normalize() (Entry, error) {
+	if e.Weight < 0 {
+		return Entry{}, fmt.Errorf("weight %v of %q is not a non-negative number", e.Weight, e.Word)
+	}
+	e.POS = strings.ToLower(e.POS)
+	for i, tag := range e.Tags {
+		e.Tags[i] = strings.ToLower(tag)
+	}
+	return e, nil
+}
@@ -0,0 +1,183 @@
+package wordbank
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// setExpr is a parsed set expression over named banks
+type setExpr interface {
+	contains(banks map[string]WordBank, word string) bool
+	names() []string
+}
+
+type bankRef string
+
+type setOp struct {
+	op          byte // '|' union, '&' intersection, '-' difference
+	left, right setExpr
+}
+
+func (b bankRef) contains(banks map[string]WordBank, word string) bool {
+	return banks[string(b)].Contains(word)
+}
+
+func (b bankRef) names() []string {
+	return []string{string(b)}
+}
+
+func (s setOp) contains(banks map[string]WordBank, word string) bool {
+	switch s.op {
+	case '|':
+		return s.left.contains(banks, word) || s.right.contains(banks, word)
+	case '&':
+		return s.left.contains(banks, word) && s.right.contains(banks, word)
+	default:
+		return s.left.contains(banks, word) && !s.right.contains(banks, word)
+	}
+}
+
+func (s setOp) names() []string {
+	return append(s.left.names(), s.right.names()...)
+}
+
+// ValidateExpression checks that expr parses and only refers to the given bank names
+func ValidateExpression(expr string, names []string) error {
+	_, err := parseExpression(expr, names)
+	return err
+}
+
+// parseExpression parses a set expression such as "(general | tech) - brands".
+// & binds tighter than | and -, which are left-associative.
+func parseExpression(expr string, names []string) (setExpr, error) {
+	p := &exprParser{tokens: tokenize(expr)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty word bank expression")
+	}
+
+	parsed, err := p.parseUnion()
+	if err != nil {
+		return nil, fmt.Errorf("invalid word bank expression %q: %w", expr, err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("invalid word bank expression %q: unexpected %q", expr, p.tokens[p.pos])
+	}
+
+	known := make(map[string]bool, len(names))
+	for _, name := range names {
+		known[name] = true
+	}
+	for _, name := range parsed.names() {
+		if !known[name] {
+			return nil, fmt.Errorf("word bank expression %q refers to unknown bank %q", expr, name)
+		}
+	}
+
+	return parsed, nil
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) parseUnion() (setExpr, error) {
+	left, err := p.parseIntersection()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == "|" || op == "-"; op = p.peek() {
+		p.pos++
+		right, err := p.parseIntersection()
+		if err != nil {
+			return nil, err
+		}
+		left = setOp{op: op[0], left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseIntersection() (setExpr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&" {
+		p.pos++
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		left = setOp{op: '&', left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseOperand() (setExpr, error) {
+	token := p.peek()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case token == "(":
+		p.pos++
+		inner, err := p.parseUnion()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return inner, nil
+	case isBankName(token):
+		p.pos++
+		return bankRef(token), nil
+	default:
+		return nil, fmt.Errorf("unexpected %q", token)
+	}
+}
+
+// tokenize splits an expression into bank names, operators and parentheses
+func tokenize(expr string) []string {
+	var tokens []string
+	var name strings.Builder
+
+	flush := func() {
+		if name.Len() > 0 {
+			tokens = append(tokens, name.String())
+			name.Reset()
+		}
+	}
+
+	for _, r := range expr {
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case strings.ContainsRune("|&-()", r):
+			flush()
+			tokens = append(tokens, string(r))
+		default:
+			name.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+func isBankName(s string) bool {
+	for _, r := range s {
+		if !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,43 @@
+package wordbank
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// WatchFile polls path every interval and reloads wb when the file's size or modification time changes.
+// A failed reload keeps the previous words. onReload, if set, is called after every reload attempt.
+func WatchFile(ctx context.Context, wb WordBank, path string, interval time.Duration, onReload func(err error)) {
+	lastMod, lastSize := fileVersion(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			mod, size := fileVersion(path)
+			if mod.Equal(lastMod) && size == lastSize {
+				continue
+			}
+			lastMod, lastSize = mod, size
+
+			err := wb.LoadWords(ctx, path)
+			if onReload != nil {
+				onReload(err)
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func fileVersion(path string) (time.Time, int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, -1
+	}
+	return info.ModTime(), info.Size()
+}
@@ -1,78 +1,126 @@
 package wordbank
 
 import (
-	"bufio"
 	"context"
 	"fmt"
-	"os"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"log/slog"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 type WordBank interface {
 	Contains(word string) bool
+	Lookup(word string) (Entry, bool)
+	Each(fn func(word string))
 	LoadWords(ctx context.Context, path string) error
+	Size() int
 }
 
+// wordBank swaps its word set atomically on reload, so Contains never blocks or sees a partial set
 type wordBank struct {
-	words    map[string]bool
-	bankPath string
+	backend Backend
+	words   atomic.Pointer[wordSetRef]
+	logger  *slog.Logger
+}
+
+// wordSetRef publishes the set and the metadata loaded with it through one atomic.Pointer
+type wordSetRef struct {
+	set      wordSet
+	metadata map[string]Entry
 }
 
 func NewWordBank(path string) WordBank {
-	wb := &wordBank{
-		words: make(map[string]bool),
-	}
+	return NewWordBankWithBackend(path, BackendMap, nil)
+}
+
+// NewWordBankWithBackend loads path into the given backend; see Backend for the memory/speed trade-offs.
+// A nil logger logs to slog.Default().
+func NewWordBankWithBackend(path string, backend Backend, logger *slog.Logger) WordBank {
+	wb := newEmptyWordBank(backend, logger)
 
 	// Load words during initialization
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	if err := wb.LoadWords(ctx, path); err != nil {
-		fmt.Printf("Warning: Failed to load word bank: %v\n", err)
+		wb.logger.Warn("failed to load word bank", "path", path, "error", err)
 	}
 
 	return wb
 }
 
+func newEmptyWordBank(backend Backend, logger *slog.Logger) *wordBank {
+	wb := &wordBank{backend: backend, logger: logging.OrDefault(logger)}
+	wb.words.Store(&wordSetRef{set: newWordSet(backend, nil)})
+	return wb
+}
+
 func (wb *wordBank) Contains(word string) bool {
-	return wb.words[strings.ToLower(word)]
+	return wb.words.Load().set.contains(strings.ToLower(word))
 }
 
-func (wb *wordBank) LoadWords(ctx context.Context, path string) error {
-	// Open the word bank file
-	file, err := os.Open(path)
-	if err != nil {
-		return fmt.Errorf("failed to open word bank file: %w", err)
+// Lookup returns the entry for word and whether the bank contains it; plain words have no metadata
+func (wb *wordBank) Lookup(word string) (Entry, bool) {
+	word = strings.ToLower(word)
+	words := wb.words.Load()
+	if !words.set.contains(word) {
+		return Entry{}, false
+	}
+	if entry, ok := words.metadata[word]; ok {
+		return entry, true
 	}
-	defer file.Close()
+	return Entry{Word: word}, true
+}
 
-	// Read words from file
-	var words []string
-	scanner := bufio.NewScanner(file)
+// Each calls fn for every word in the bank
+func (wb *wordBank) Each(fn func(word string)) {
+	wb.words.Load().set.each(fn)
+}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		// Skip empty lines and comments
-		if line != "" && !strings.HasPrefix(line, "#") {
-			words = append(words, line)
-		}
-	}
+func (wb *wordBank) Size() int {
+	return wb.words.Load().set.size()
+}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading word bank file: %w", err)
+func (wb *wordBank) LoadWords(ctx context.Context, path string) error {
+	entries, err := readEntries(path)
+	if err != nil {
+		return err
 	}
 
-	// Build word map for O(1) lookup (rest stays the same)
-	wb.words = make(map[string]bool, len(words))
-	for _, word := range words {
-		normalizedWord := strings.ToLower(word)
-		if len(normalizedWord) >= 3 && isAlphabetic(normalizedWord) {
-			wb.words[normalizedWord] = true
+	// Keep valid words, sorted and de-duplicated so every backend can be built from them;
+	// metadata is kept only for entries that have some
+	valid := make([]string, 0, len(entries))
+	var metadata map[string]Entry
+	for _, entry := range entries {
+		normalizedWord := strings.ToLower(entry.Word)
+		if len(normalizedWord) < 3 || !isAlphabetic(normalizedWord) {
+			continue
+		}
+		valid = append(valid, normalizedWord)
+
+		if entry.HasMetadata() {
+			if metadata == nil {
+				metadata = make(map[string]Entry)
+			}
+			entry.Word = normalizedWord
+			entry.Canonical = strings.ToLower(entry.Canonical)
+			metadata[normalizedWord] = entry
 		}
 	}
+	slices.Sort(valid)
+	valid = slices.Compact(valid)
+
+	// Build the set, then publish it in one step
+	set := newWordSet(wb.backend, valid)
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("word bank load canceled: %w", err)
+	}
+	wb.words.Store(&wordSetRef{set: set, metadata: metadata})
 
-	fmt.Printf("Loaded %d valid words from word bank file\n", len(wb.words))
+	wb.logger.Info("loaded word bank", "path", path, "words", set.size(), "backend", wb.backend)
 
 	return nil
 }
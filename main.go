@@ -1,60 +1,100 @@
 package main
 
 import (
-	"context"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"github.com/ireuven89/firefly-itzik/config"
-	"github.com/ireuven89/firefly-itzik/internal/essay"
-	"github.com/ireuven89/firefly-itzik/internal/models"
-	"github.com/ireuven89/firefly-itzik/internal/processor"
-	rateLimiter2 "github.com/ireuven89/firefly-itzik/internal/rateLimiter"
-	"github.com/ireuven89/firefly-itzik/internal/wordbank"
-	"log"
-	"time"
+	"os"
+	"strings"
 )
 
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"run", "fetch essays and analyze them in one pass (default)", runRun},
+	{"fetch", "fetch essays and save them as NDJSON for later analysis", runFetch},
+	{"analyze", "analyze essays previously saved by fetch", runAnalyze},
+	{"merge", "merge result files from several runs", runMerge},
+	{"compare", "report how word frequencies changed between two result files", runCompare},
+	{"query", "query runs recorded in the local store", runQuery},
+	{"discover", "discover article URLs from sitemaps or index pages", runDiscover},
+	{"validate-config", "check the effective configuration and exit", runValidateConfig},
+	{"show-config", "print the effective configuration and where each value came from", runShowConfig},
+	{"coordinator", "shard the URL list and lease it to workers", runCoordinator},
+	{"worker", "process shards leased from a coordinator", runWorker},
+	{"serve", "run the HTTP job API", runServe},
+}
+
 func main() {
-	cfg := config.LoadConfig()
-	ctx, cancel := context.WithTimeout(context.Background(), cfg.ProcessTimeout)
-	defer cancel()
-
-	// Initialize components
-	rateLimiter := rateLimiter2.NewRateLimiter(cfg.RateLimit, time.Second)
-	essayFetcher := essay.NewEssayFetcher(rateLimiter, cfg.EssaysFile, cfg.MaxHTTPWorkers, cfg.HTTPRetryDelay)
-	wordBank := wordbank.NewWordBank(cfg.WordBankFile)
-	wordProcessor := processor.NewWordProcessor(wordBank)
-	essayStream := make(chan models.Essay, cfg.EssayStreamBuffer)
-	errorChan := make(chan error, cfg.ErrorChannelBuffer)
-
-	// Start streaming essays
-	go func() {
-		defer close(essayStream)
-		defer close(errorChan)
-
-		if err := essayFetcher.StreamEssays(ctx, essayStream, errorChan); err != nil {
-			log.Printf("Error streaming essays: %v", err)
-		}
-	}()
+	args := os.Args[1:]
+
+	// Without a subcommand the binary keeps its original behavior
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		usage()
+		return
+	}
 
-	// Process essays as they stream
-	topWords, totalEssays, totalErrors := wordProcessor.ProcessEssayStream(ctx, essayStream, errorChan, cfg.TopWordsCount)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
 
-	if totalErrors > 0 {
-		log.Printf("Warning: %d errors occurred", totalErrors)
+		err := cmd.run(args)
+		switch {
+		case err == nil:
+			return
+		case errors.Is(err, flag.ErrHelp):
+			return
+		case errors.Is(err, errUsage):
+			os.Exit(2)
+		default:
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
-	// Output results
-	output := models.Output{
-		TopWords:    topWords,
-		TotalEssays: totalEssays,
-		Timestamp:   time.Now().UTC(),
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+// errUsage is returned by commands after they have already printed a usage or flag error
+var errUsage = errors.New("usage error")
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", cmd.name, cmd.summary)
 	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+}
 
-	jsonOutput, err := json.MarshalIndent(output, "", "  ")
-	if err != nil {
-		log.Fatalf("Failed to marshal output: %v", err)
+// newFlagSet creates a command FlagSet whose parse errors are reported once by the flag package
+func newFlagSet(name, args string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s\n", strings.TrimSpace(fmt.Sprintf("%s %s [flags] %s", os.Args[0], name, args)))
+		flags.PrintDefaults()
 	}
+	return flags
+}
 
-	fmt.Println(string(jsonOutput))
+// parseFlags parses args, mapping flag errors to errUsage since the flag package has already printed them
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	return nil
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/config"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/results"
+	"time"
+)
+
+// runMerge combines result files from several runs and prints the exact top-N of the combined counts
+func runMerge(args []string) error {
+	flags := newFlagSet("merge", "result-file...")
+	topN := flags.Int("top", config.DefaultTopWordsCount, "number of top words to output")
+	outFile := flags.String("o", "", "write the merged full-count result file to this path")
+	outputFile := flags.String("output", config.DefaultOutputFile, "write the output to this path, - for stdout")
+	outputFormat := flags.String("output-format", config.DefaultOutputFormat, "output format: json, csv, ndjson, markdown or html")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errUsage
+	}
+	if *topN < config.MinTopWordsCount || *topN > config.MaxTopWordsCount {
+		return fmt.Errorf("-top must be between %d and %d, got %d", config.MinTopWordsCount, config.MaxTopWordsCount, *topN)
+	}
+
+	parts := make([]*results.Result, 0, flags.NArg())
+	for _, path := range flags.Args() {
+		r, err := results.Load(path)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, r)
+	}
+
+	merged := results.Merge(parts...)
+	if *outFile != "" {
+		if err := results.Save(*outFile, merged); err != nil {
+			return fmt.Errorf("failed to save merged result: %w", err)
+		}
+	}
+
+	return writeOutput(*outputFile, *outputFormat, models.Output{
+		TopWords:         merged.TopWords(*topN),
+		TotalEssays:      merged.TotalEssays,
+		TotalErrors:      merged.TotalErrors,
+		ErrorsByCategory: merged.ErrorsByCategory,
+		Duplicates:       merged.Duplicates,
+		NearDuplicates:   merged.NearDuplicates,
+		Timestamp:        time.Now().UTC(),
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/ireuven89/firefly-itzik/config"
+	"github.com/ireuven89/firefly-itzik/internal/metrics"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// startMetrics serves the application metrics at /metrics on cfg.MetricsAddr. Without an address it returns
+// nil metrics, which record nothing. The returned function stops the server.
+func startMetrics(cfg *config.Config, logger *slog.Logger) (*metrics.Metrics, func(), error) {
+	if cfg.MetricsAddr == "" {
+		return nil, func() {}, nil
+	}
+
+	listener, err := net.Listen("tcp", cfg.MetricsAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	registry := metrics.NewRegistry()
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", registry)
+	metricsServer := &http.Server{Handler: mux}
+	go func() {
+		if err := metricsServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("metrics server failed", "error", err)
+		}
+	}()
+	logger.Info("metrics listening", "addr", listener.Addr().String())
+
+	return metrics.New(registry), func() {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		metricsServer.Shutdown(shutdownCtx)
+	}, nil
+}
+
+// registerChannels reports the occupancy of the essay stream and error channel between fetching and processing
+func registerChannels(m *metrics.Metrics, essayStream chan models.Essay, errorChan chan error) {
+	metrics.RegisterChannel(m, "essay_stream", "Essays between fetching and processing", essayStream)
+	metrics.RegisterChannel(m, "error_channel", "Fetch errors between fetching and processing", errorChan)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/config"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/runstore"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// queryKinds are what the query command can list
+var queryKinds = []string{"runs", "top", "essays", "errors"}
+
+// runQuery answers questions about recorded runs from the local store without refetching anything
+func runQuery(args []string) error {
+	flags := newFlagSet("query", strings.Join(queryKinds, "|"))
+	from := flags.String("from", "", "only essays and errors recorded at or after this date (YYYY-MM-DD or RFC 3339)")
+	to := flags.String("to", "", "only essays and errors recorded before this time, or up to the end of this YYYY-MM-DD date")
+	runID := flags.String("run", "", "only this run")
+	word := flags.String("word", "", "essays: only those in which this word was counted")
+	configFlags := config.RegisterFlags(flags)
+
+	// The kind may come before or after the flags, e.g. "query top -from 2024-01-01"
+	kind := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		kind, args = args[0], args[1:]
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if kind == "" && flags.NArg() > 0 {
+		kind = flags.Arg(0)
+		if err := parseFlags(flags, flags.Args()[1:]); err != nil {
+			return err
+		}
+	}
+	if kind == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	cfg, err := config.Load(configFlags)
+	if err != nil {
+		return err
+	}
+	if cfg.StoreDir == "" {
+		return fmt.Errorf("query needs a store, set -store-dir")
+	}
+
+	filter := runstore.Filter{RunID: *runID}
+	if filter.From, err = parseQueryTime(*from, false); err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+	if filter.To, err = parseQueryTime(*to, true); err != nil {
+		return fmt.Errorf("invalid -to: %w", err)
+	}
+
+	st, err := runstore.Open(cfg.StoreDir)
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case "runs":
+		runs, err := st.Runs()
+		if err != nil {
+			return err
+		}
+		return writeReport(cfg.OutputFile, nonNil(runs))
+	case "top":
+		topWords, totalEssays, err := st.TopWords(filter, cfg.TopWordsCount)
+		if err != nil {
+			return err
+		}
+		return writeOutput(cfg.OutputFile, cfg.OutputFormat, models.Output{
+			TopWords:    topWords,
+			TotalEssays: totalEssays,
+			Timestamp:   time.Now().UTC(),
+		})
+	case "essays":
+		essays, err := st.Essays(filter, *word)
+		if err != nil {
+			return err
+		}
+		return writeReport(cfg.OutputFile, nonNil(essays))
+	case "errors":
+		errs, err := st.Errors(filter)
+		if err != nil {
+			return err
+		}
+		return writeReport(cfg.OutputFile, nonNil(errs))
+	default:
+		return fmt.Errorf("unknown query %q (use %s)", kind, strings.Join(queryKinds, ", "))
+	}
+}
+
+// parseQueryTime accepts a date or an RFC 3339 time; a bare date used as an upper bound covers that whole day
+func parseQueryTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither YYYY-MM-DD nor RFC 3339", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// nonNil makes empty results encode as [] rather than null
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/config"
+	"github.com/ireuven89/firefly-itzik/internal/essay"
+	"github.com/ireuven89/firefly-itzik/internal/fuzzy"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/metrics"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/output"
+	"github.com/ireuven89/firefly-itzik/internal/processor"
+	rateLimiter2 "github.com/ireuven89/firefly-itzik/internal/rateLimiter"
+	"github.com/ireuven89/firefly-itzik/internal/results"
+	"github.com/ireuven89/firefly-itzik/internal/runstore"
+	"github.com/ireuven89/firefly-itzik/internal/tuning"
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// essaySource feeds essays and errors into the given channels; the caller closes them once it returns
+type essaySource func(ctx context.Context, essayStream chan<- models.Essay, errorChan chan<- error) error
+
+func runRun(args []string) error {
+	flags := newFlagSet("run", "")
+	configFlags := config.RegisterFlags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(configFlags)
+	if err != nil {
+		return err
+	}
+	logger := newLogger(cfg)
+	m, stopMetrics, err := startMetrics(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+
+	essayFetcher, rateLimiter, err := newEssayFetcher(cfg, logger, m)
+	if err != nil {
+		return err
+	}
+	wordBank, err := newWordBank(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	// Long runs can be retuned through SIGHUP, the admin endpoint or word bank file changes
+	tuner := tuning.NewTuner(rateLimiter, essayFetcher, wordBank, cfg.WordBankPath(), config.MinRateLimit, config.MaxRateLimit, config.MinWorkers, config.MaxWorkers)
+	stopRuntimeControls, err := startRuntimeControls(cfg, configFlags, tuner, wordBank, logger)
+	if err != nil {
+		return err
+	}
+	defer stopRuntimeControls()
+
+	return analyzeAndPrint(cfg, logger, m, wordBank, essayFetcher.StreamEssays, essayFetcher.Duplicates)
+}
+
+func runAnalyze(args []string) error {
+	flags := newFlagSet("analyze", "")
+	input := flags.String("i", "essays.ndjson", "NDJSON essays file written by fetch, - for stdin")
+	configFlags := config.RegisterFlags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(configFlags)
+	if err != nil {
+		return err
+	}
+	logger := newLogger(cfg)
+	m, stopMetrics, err := startMetrics(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+
+	wordBank, err := newWordBank(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	in, err := openInput(*input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return analyzeAndPrint(cfg, logger, m, wordBank, func(ctx context.Context, essayStream chan<- models.Essay, errorChan chan<- error) error {
+		return readEssays(ctx, in, essayStream)
+	}, nil)
+}
+
+func runFetch(args []string) error {
+	flags := newFlagSet("fetch", "")
+	output := flags.String("o", "essays.ndjson", "write fetched essays as NDJSON to this path, - for stdout")
+	configFlags := config.RegisterFlags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(configFlags)
+	if err != nil {
+		return err
+	}
+	logger := newLogger(cfg)
+	m, stopMetrics, err := startMetrics(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+
+	out, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ProcessTimeout)
+	defer cancel()
+
+	essayFetcher, _, err := newEssayFetcher(cfg, logger, m)
+	if err != nil {
+		return err
+	}
+	essayStream := make(chan models.Essay, cfg.EssayStreamBuffer)
+	errorChan := make(chan error, cfg.ErrorChannelBuffer)
+	registerChannels(m, essayStream, errorChan)
+	streamErr := make(chan error, 1)
+
+	go func() {
+		defer close(essayStream)
+		defer close(errorChan)
+		streamErr <- essayFetcher.StreamEssays(ctx, essayStream, errorChan)
+	}()
+
+	writer := bufio.NewWriter(out)
+	encoder := json.NewEncoder(writer)
+	var totalEssays, totalErrors int
+	var failures []models.Failure
+
+	for essayStream != nil || errorChan != nil {
+		select {
+		case e, ok := <-essayStream:
+			if !ok {
+				essayStream = nil
+				continue
+			}
+			if err := encoder.Encode(e); err != nil {
+				return fmt.Errorf("failed writing essay: %w", err)
+			}
+			totalEssays++
+		case err, ok := <-errorChan:
+			if !ok {
+				errorChan = nil
+				continue
+			}
+			failure := processor.DescribeFailure(err)
+			logger.Warn("fetch failed", "category", failure.Category, "error", err)
+			failures = append(failures, failure)
+			totalErrors++
+		}
+	}
+
+	if err := <-streamErr; err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed writing essays: %w", err)
+	}
+	if cfg.FailedURLsFile != "" {
+		if err := writeFailedURLs(cfg.FailedURLsFile, failures); err != nil {
+			return fmt.Errorf("failed to write failed URLs: %w", err)
+		}
+	}
+	if cfg.SkippedReportFile != "" {
+		if err := writeReport(cfg.SkippedReportFile, skipReport(failures)); err != nil {
+			return fmt.Errorf("failed to write skipped report: %w", err)
+		}
+	}
+
+	logDuplicates(logger, essayFetcher.Duplicates())
+	logger.Info("fetched essays", "essays", totalEssays, "errors", totalErrors, "output", *output)
+	return nil
+}
+
+// newLogger builds the configured stderr logger and makes it the default for code without an injected one
+func newLogger(cfg *config.Config) *slog.Logger {
+	logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		// config.Load has validated both settings
+		return slog.Default()
+	}
+	slog.SetDefault(logger)
+	return logger
+}
+
+// newEssayFetcher builds the configured fetcher and returns the rate limiter it shares, for runtime tuning
+func newEssayFetcher(cfg *config.Config, logger *slog.Logger, m *metrics.Metrics) (essay.EssayFetcher, rateLimiter2.RateLimiter, error) {
+	options, err := cfg.FetchOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+	rateLimiter := rateLimiter2.NewRateLimiter(cfg.RateLimit, time.Second)
+	return essay.NewEssayFetcherWithOptions(rateLimiter, cfg.EssaysFile, cfg.MaxHTTPWorkers, cfg.HTTPRetryDelay, logger, m, options), rateLimiter, nil
+}
+
+// newWordBank loads the named word banks composed by their expression when configured, otherwise the single word bank file
+func newWordBank(cfg *config.Config, logger *slog.Logger) (wordbank.WordBank, error) {
+	backend, err := wordbank.ParseBackend(cfg.WordBankBackend)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.WordBanks == "" {
+		return wordbank.NewWordBankWithBackend(cfg.WordBankFile, backend, logger), nil
+	}
+
+	files, err := wordbank.ParseBankFiles(cfg.WordBanks)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	return wordbank.NewCollection(ctx, files, cfg.WordBankExpr, backend, logger)
+}
+
+// processorOptions applies the configured word bank metadata filters, weighting, OOV tracking, near-duplicate
+// detection and fuzzy matching; the fuzzy index is built here, so call it once per word bank
+func processorOptions(cfg *config.Config, logger *slog.Logger, m *metrics.Metrics, wordBank wordbank.WordBank) processor.Options {
+	options := processor.Options{
+		Logger:         logger,
+		Metrics:        m,
+		POS:            config.SplitList(cfg.POSFilter),
+		Tags:           config.SplitList(cfg.TagFilter),
+		Weighted:       cfg.WeightedCounts,
+		TrackRejected:  cfg.OOVReportFile != "",
+		NearDuplicates: cfg.NearDuplicateOptions(),
+	}
+	if cfg.FuzzyDistance > 0 {
+		options.Fuzzy = fuzzy.NewWordBankMatcher(wordBank, cfg.FuzzyDistance)
+	}
+	return options
+}
+
+// analyzeAndPrint counts the words of every essay from source and writes the output in the configured format;
+// duplicates, when set, reports what source collapsed once it is done
+func analyzeAndPrint(cfg *config.Config, logger *slog.Logger, m *metrics.Metrics, wordBank wordbank.WordBank, source essaySource, duplicates func() *models.DuplicateReport) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ProcessTimeout)
+	defer cancel()
+
+	// Initialize components
+	options := processorOptions(cfg, logger, m, wordBank)
+	var recorder runstore.Recorder
+	if cfg.StoreDir != "" {
+		st, err := runstore.Open(cfg.StoreDir)
+		if err != nil {
+			return err
+		}
+		if recorder, err = st.NewRun(); err != nil {
+			return err
+		}
+		options.OnEssay, options.OnError = recorder.RecordEssay, recorder.RecordError
+	}
+	// A run that fails before its totals are known is closed without an end record, so it stays incomplete
+	recorded := false
+	defer func() {
+		if recorder != nil && !recorded {
+			recorder.Abort()
+		}
+	}()
+	wordProcessor := processor.NewWordProcessorWithOptions(wordBank, options)
+	essayStream := make(chan models.Essay, cfg.EssayStreamBuffer)
+	errorChan := make(chan error, cfg.ErrorChannelBuffer)
+	registerChannels(m, essayStream, errorChan)
+
+	// Start streaming essays
+	sourceErr := make(chan error, 1)
+	go func() {
+		defer close(essayStream)
+		defer close(errorChan)
+		sourceErr <- source(ctx, essayStream, errorChan)
+	}()
+
+	// Periodically report live snapshots while processing
+	snapshotCtx, stopSnapshots := context.WithCancel(ctx)
+	var snapshotWg sync.WaitGroup
+	if cfg.SnapshotInterval > 0 {
+		snapshotOut, err := openSnapshotOutput(cfg.SnapshotFile)
+		if err != nil {
+			stopSnapshots()
+			return fmt.Errorf("failed to open snapshot output: %w", err)
+		}
+		defer snapshotOut.Close()
+
+		snapshotWg.Add(1)
+		go func() {
+			defer snapshotWg.Done()
+			if err := processor.WriteSnapshots(snapshotCtx, wordProcessor, snapshotOut, cfg.SnapshotInterval); err != nil {
+				logger.Error("writing snapshots failed", "error", err)
+			}
+		}()
+	}
+
+	// Process essays as they stream
+	topWords, totalEssays, totalErrors := wordProcessor.ProcessEssayStream(ctx, essayStream, errorChan, cfg.TopWordsCount)
+	stopSnapshots()
+	snapshotWg.Wait()
+
+	// The timeout ends a run with the counts so far; anything else that stopped the source fails it
+	if err := <-sourceErr; err != nil && ctx.Err() == nil {
+		return fmt.Errorf("essay source failed: %w", err)
+	}
+
+	failures := wordProcessor.FailureReport()
+	if totalErrors > 0 {
+		logger.Warn("errors occurred", "errors", totalErrors, "by_category", failures.ByCategory)
+	}
+	result := wordProcessor.Result()
+	result.NearDuplicates = wordProcessor.NearDuplicateReport()
+	if duplicates != nil {
+		result.Duplicates = duplicates()
+		logDuplicates(logger, result.Duplicates)
+	}
+
+	if recorder != nil {
+		recorded = true
+		if err := recorder.Close(totalEssays, totalErrors); err != nil {
+			return err
+		}
+		logger.Info("recorded run", "run", recorder.ID(), "store", cfg.StoreDir)
+	}
+
+	if cfg.ResultFile != "" {
+		if err := results.Save(cfg.ResultFile, result); err != nil {
+			return fmt.Errorf("failed to save result file: %w", err)
+		}
+	}
+
+	if cfg.FailedURLsFile != "" {
+		if err := writeFailedURLs(cfg.FailedURLsFile, failures.Failures); err != nil {
+			return fmt.Errorf("failed to write failed URLs: %w", err)
+		}
+	}
+	if cfg.SkippedReportFile != "" {
+		if err := writeReport(cfg.SkippedReportFile, skipReport(failures.Failures)); err != nil {
+			return fmt.Errorf("failed to write skipped report: %w", err)
+		}
+	}
+
+	if cfg.OOVReportFile != "" {
+		if err := writeReport(cfg.OOVReportFile, wordProcessor.OOVReport(cfg.OOVReportTop)); err != nil {
+			return fmt.Errorf("failed to write OOV report: %w", err)
+		}
+	}
+	if cfg.FuzzyReportFile != "" {
+		if err := writeReport(cfg.FuzzyReportFile, wordProcessor.CorrectionReport()); err != nil {
+			return fmt.Errorf("failed to write fuzzy report: %w", err)
+		}
+	}
+
+	output := models.Output{
+		TopWords:         topWords,
+		TotalEssays:      totalEssays,
+		TotalErrors:      totalErrors,
+		ErrorsByCategory: failures.ByCategory,
+		Duplicates:       result.Duplicates,
+		NearDuplicates:   result.NearDuplicates,
+		Timestamp:        time.Now().UTC(),
+	}
+	if output.NearDuplicates != nil && output.NearDuplicates.Total > 0 {
+		logger.Info("found near-duplicate essays", "near_duplicates", output.NearDuplicates.Total, "clusters", len(output.NearDuplicates.Clusters), "mode", output.NearDuplicates.Mode)
+	}
+	if banks, ok := wordBank.(wordbank.Collection); ok && cfg.WordBankBreakdown {
+		output.ByBank = processor.TopWordsByBank(result.WordCounts, banks, cfg.TopWordsCount, cfg.WeightedCounts)
+	}
+
+	// Output results
+	return writeOutput(cfg.OutputFile, cfg.OutputFormat, output)
+}
+
+// logDuplicates logs how many essays deduplication collapsed, if any
+func logDuplicates(logger *slog.Logger, report *models.DuplicateReport) {
+	if report != nil && report.Total() > 0 {
+		logger.Info("collapsed duplicate essays", "duplicates", report.Total(), "urls", report.URLs, "canonical", report.Canonical, "content", report.Content)
+	}
+}
+
+// writeReport writes report as indented JSON to path, - for stdout
+func writeReport(path string, report any) error {
+	out, err := openOutput(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// writeFailedURLs writes the distinct URLs of failures to path, - for stdout, in the essays file format; each URL
+// follows a comment with its error, so the file can be read back as essays_file to retry them
+func writeFailedURLs(path string, failures []models.Failure) error {
+	out, err := openOutput(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	writer := bufio.NewWriter(out)
+	seen := make(map[string]bool)
+	for _, f := range failures {
+		if f.URL == "" || seen[f.URL] {
+			continue
+		}
+		seen[f.URL] = true
+		fmt.Fprintf(writer, "# %s\n%s\n", f.Message, f.URL)
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// skipReport picks the failures robots.txt caused out of failures
+func skipReport(failures []models.Failure) models.SkipReport {
+	report := models.SkipReport{
+		ByHost:    make(map[string]int),
+		Skipped:   []models.Failure{},
+		Timestamp: time.Now().UTC(),
+	}
+	for _, f := range failures {
+		if f.Category != essay.Category(essay.ErrDisallowed) {
+			continue
+		}
+		host := f.URL
+		if u, err := url.Parse(f.URL); err == nil {
+			host = u.Host
+		}
+		report.ByHost[host]++
+		report.Skipped = append(report.Skipped, f)
+	}
+	report.TotalSkipped = len(report.Skipped)
+	return report
+}
+
+// writeOutput renders output in format to path, - for stdout
+func writeOutput(path, format string, result models.Output) error {
+	parsed, err := output.ParseFormat(format)
+	if err != nil {
+		return err
+	}
+
+	out, err := openOutput(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	writer := bufio.NewWriter(out)
+	if err := output.NewWriter(parsed).Write(writer, result); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return out.Close()
+}
+
+// readEssays decodes NDJSON essays from r until EOF
+func readEssays(ctx context.Context, r io.Reader, essayStream chan<- models.Essay) error {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var e models.Essay
+		if err := decoder.Decode(&e); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed decoding essay: %w", err)
+		}
+
+		select {
+		case essayStream <- e:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// openSnapshotOutput returns stdout for "-", which Validate only allows when the output goes to a file, otherwise appends to the given file
+func openSnapshotOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+}
+
+// openOutput returns stdout for "-", otherwise truncates and writes the given file
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	return file, nil
+}
+
+// openInput returns stdin for "-", otherwise opens the given file
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+	return file, nil
+}
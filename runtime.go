@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/ireuven89/firefly-itzik/config"
+	"github.com/ireuven89/firefly-itzik/internal/tuning"
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// startRuntimeControls enables the runtime reloading configured in cfg:
+//   - SIGHUP reloads the configuration layers, applies rate limit and worker count, and reloads the word bank
+//   - cfg.AdminAddr serves the admin tuning endpoints
+//   - cfg.WordBankReloadInterval polls the word bank file for changes
+//
+// The returned function stops all of them.
+func startRuntimeControls(cfg *config.Config, configFlags *config.Flags, tuner tuning.Tuner, wordBank wordbank.WordBank, logger *slog.Logger) (func(), error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stops := []func(){cancel}
+
+	watchWordBank(ctx, cfg, wordBank, logger)
+
+	if cfg.AdminAddr != "" {
+		listener, err := net.Listen("tcp", cfg.AdminAddr)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		adminServer := &http.Server{Handler: tuning.NewAdminHandler(tuner)}
+		go func() {
+			if err := adminServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("admin server failed", "error", err)
+			}
+		}()
+		logger.Info("admin endpoints listening", "addr", listener.Addr().String())
+
+		stops = append(stops, func() {
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer shutdownCancel()
+			adminServer.Shutdown(shutdownCtx)
+		})
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	stops = append(stops, func() { signal.Stop(hangup) })
+
+	go func() {
+		for {
+			select {
+			case <-hangup:
+				reloadOnHangup(ctx, configFlags, tuner, logger)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}, nil
+}
+
+// watchWordBank reloads the word bank whenever one of its files changes, if a reload interval is configured
+func watchWordBank(ctx context.Context, cfg *config.Config, wordBank wordbank.WordBank, logger *slog.Logger) {
+	if cfg.WordBankReloadInterval <= 0 {
+		return
+	}
+
+	files := []string{cfg.WordBankFile}
+	if banks, ok := wordBank.(wordbank.Collection); ok {
+		files = banks.Files()
+	}
+
+	for _, file := range files {
+		go wordbank.WatchFile(ctx, wordBank, file, cfg.WordBankReloadInterval, func(err error) {
+			if err != nil {
+				logger.Warn("word bank reload failed, keeping previous words", "path", file, "error", err)
+			}
+		})
+	}
+}
+
+// reloadOnHangup re-reads the config file, env and flags; an invalid configuration leaves the current settings in place
+func reloadOnHangup(ctx context.Context, configFlags *config.Flags, tuner tuning.Tuner, logger *slog.Logger) {
+	logger = logger.With("signal", "SIGHUP")
+	cfg, err := config.Load(configFlags)
+	if err != nil {
+		logger.Warn("invalid configuration, keeping current settings", "error", err)
+		return
+	}
+
+	if err := tuner.Apply(tuning.Settings{RateLimit: cfg.RateLimit, MaxHTTPWorkers: cfg.MaxHTTPWorkers}); err != nil {
+		logger.Error("failed applying settings", "error", err)
+		return
+	}
+
+	tuner.SetWordBankPath(cfg.WordBankPath())
+	if err := tuner.ReloadWordBank(ctx); err != nil {
+		logger.Warn("word bank reload failed, keeping previous words", "error", err)
+	}
+
+	logger.Info("applied settings", "rate_limit", cfg.RateLimit, "max_http_workers", cfg.MaxHTTPWorkers)
+}
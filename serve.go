@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/config"
+	"github.com/ireuven89/firefly-itzik/internal/server"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runServe runs the job API until interrupted; running jobs are persisted as interrupted on shutdown
+func runServe(args []string) error {
+	flags := newFlagSet("serve", "")
+	listen := flags.String("listen", ":8080", "address to serve the job API on")
+	dataDir := flags.String("data-dir", "jobs", "directory where jobs and their results are persisted")
+	configFlags := config.RegisterFlags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(configFlags)
+	if err != nil {
+		return err
+	}
+	logger := newLogger(cfg)
+	m, stopMetrics, err := startMetrics(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+	wordBank, err := newWordBank(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	jobManager, err := server.NewJobManager(cfg, wordBank, *dataDir, logger, m)
+	if err != nil {
+		return fmt.Errorf("failed to start job manager: %w", err)
+	}
+
+	httpServer := &http.Server{Addr: *listen, Handler: server.NewHandler(jobManager)}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+	logger.Info("serving job API", "addr", *listen, "data_dir", *dataDir)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	watchWordBank(ctx, cfg, wordBank, logger)
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for ctx.Err() == nil {
+		select {
+		case <-hangup:
+			reloadServeConfig(ctx, configFlags, jobManager, logger)
+		case <-ctx.Done():
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	httpServer.Shutdown(shutdownCtx)
+	jobManager.Shutdown()
+	return nil
+}
+
+// reloadServeConfig applies a re-read configuration to jobs submitted from now on and reloads the word bank
+func reloadServeConfig(ctx context.Context, configFlags *config.Flags, jobManager server.JobManager, logger *slog.Logger) {
+	logger = logger.With("signal", "SIGHUP")
+	cfg, err := config.Load(configFlags)
+	if err != nil {
+		logger.Warn("invalid configuration, keeping current settings", "error", err)
+		return
+	}
+
+	jobManager.SetDefaults(cfg)
+	if err := jobManager.ReloadWordBank(ctx); err != nil {
+		logger.Warn("word bank reload failed, keeping previous words", "error", err)
+		return
+	}
+	logger.Info("reloaded configuration and word bank")
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/output"
+	"github.com/ireuven89/firefly-itzik/internal/results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func compareTestResults() (*results.Result, *results.Result) {
+	before := results.NewResult()
+	before.WordCounts = map[string]int{"apple": 200, "banana": 100, "cherry": 50, "delta": 10}
+	before.TotalEssays = 4
+
+	after := results.NewResult()
+	after.WordCounts = map[string]int{"apple": 100, "banana": 100, "cherry": 150, "echo": 30, "rare": 1}
+	after.TotalEssays = 5
+
+	return before, after
+}
+
+func TestCompare_Lists(t *testing.T) {
+	before, after := compareTestResults()
+	c := results.Compare(before, after, results.CompareOptions{TopN: 10, MinCount: 5, Alpha: 0.05})
+
+	assert.Equal(t, models.RunTotals{TotalEssays: 4, TotalWords: 360, UniqueWords: 4}, c.Old)
+	assert.Equal(t, models.RunTotals{TotalEssays: 5, TotalWords: 381, UniqueWords: 5}, c.New)
+
+	require.Len(t, c.RisingRank, 1)
+	cherry := c.RisingRank[0]
+	assert.Equal(t, "cherry", cherry.Word)
+	assert.Equal(t, 3, cherry.OldRank)
+	assert.Equal(t, 1, cherry.NewRank)
+	assert.Equal(t, 2, cherry.RankChange)
+	assert.Equal(t, "cherry", c.RisingFrequency[0].Word)
+
+	require.Len(t, c.FallingRank, 1)
+	assert.Equal(t, "apple", c.FallingRank[0].Word)
+	assert.Equal(t, "apple", c.FallingFrequency[0].Word)
+	assert.Less(t, c.FallingFrequency[0].LogRatio, 0.0)
+
+	// banana's share barely moved, so it is not significant; rare is below the minimum count
+	for _, list := range [][]models.WordChange{c.RisingFrequency, c.FallingFrequency, c.NewEntrants} {
+		for _, change := range list {
+			assert.NotContains(t, []string{"banana", "rare"}, change.Word)
+		}
+	}
+
+	require.Len(t, c.NewEntrants, 1)
+	assert.Equal(t, "echo", c.NewEntrants[0].Word)
+	assert.Equal(t, 0, c.NewEntrants[0].OldRank)
+	require.Len(t, c.Dropped, 1)
+	assert.Equal(t, "delta", c.Dropped[0].Word)
+}
+
+func TestCompare_Significance(t *testing.T) {
+	before := results.NewResult()
+	before.WordCounts = map[string]int{"cherry": 50, "other": 310}
+	after := results.NewResult()
+	after.WordCounts = map[string]int{"cherry": 150, "other": 230}
+
+	c := results.Compare(before, after, results.CompareOptions{TopN: 10, Alpha: 1})
+	require.NotEmpty(t, c.RisingFrequency)
+	cherry := c.RisingFrequency[0]
+	assert.Equal(t, "cherry", cherry.Word)
+
+	// Worked by hand from the 2×2 table [[50, 310], [150, 230]]
+	assert.InDelta(t, 47.06, cherry.LogLikelihood, 0.01)
+	assert.InDelta(t, 61.36, cherry.ChiSquare, 0.01)
+	assert.InDelta(t, 6.9e-12, cherry.PValue, 0.1e-12)
+	assert.InDelta(t, 138888.9, cherry.OldFrequency, 0.1)
+}
+
+func TestCompare_AlphaOneKeepsEverything(t *testing.T) {
+	before, after := compareTestResults()
+	c := results.Compare(before, after, results.CompareOptions{TopN: 10, Alpha: 1})
+
+	assert.Len(t, c.NewEntrants, 2, "rare is kept without a minimum count")
+	assert.Len(t, c.FallingRank, 2, "banana slips from rank 2 to 3, which is kept without a significance cut")
+}
+
+func TestOutput_ComparisonFormats(t *testing.T) {
+	before, after := compareTestResults()
+	c := results.Compare(before, after, results.CompareOptions{TopN: 10, MinCount: 5, Alpha: 0.05})
+
+	for _, format := range output.Formats() {
+		var buf bytes.Buffer
+		require.NoError(t, output.NewWriter(format).WriteComparison(&buf, c), format)
+		assert.Contains(t, buf.String(), "cherry", format)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, output.NewWriter(output.FormatCSV).WriteComparison(&buf, c))
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rising_rank", "1", "cherry"}, records[1][:3])
+	assert.Equal(t, []string{"dropped", "1", "delta"}, records[len(records)-1][:3])
+}
@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"github.com/ireuven89/firefly-itzik/internal/essay"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/rateLimiter"
+	"github.com/ireuven89/firefly-itzik/internal/results"
+	"github.com/ireuven89/firefly-itzik/internal/urlnorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newDedupeFetcher fetches with a single worker so essays are emitted in URL order
+func newDedupeFetcher(options essay.Options) essay.EssayFetcher {
+	return essay.NewEssayFetcherWithOptions(rateLimiter.NewRateLimiter(1000, time.Second), "", 1, time.Millisecond, logging.Discard(), nil, options)
+}
+
+func TestURLNorm_Normalize(t *testing.T) {
+	normalizer := urlnorm.NewNormalizer(urlnorm.DefaultStripParams)
+	for raw, want := range map[string]string{
+		"HTTPS://Example.COM:443/2019/08/Article":           "https://example.com/2019/08/Article",
+		"http://example.com:80":                             "http://example.com/",
+		"http://example.com:8080/a":                         "http://example.com:8080/a",
+		"https://example.com/a#comments":                    "https://example.com/a",
+		"https://example.com/a?utm_source=x&utm_medium=y":   "https://example.com/a",
+		"https://example.com/a?page=2&fbclid=abc&id=7":      "https://example.com/a?id=7&page=2",
+		"https://example.com/a?":                            "https://example.com/a",
+		"  https://example.com/a?GCLID=1&Ref=home&b=2&a=1 ": "https://example.com/a?a=1&b=2",
+	} {
+		got, err := normalizer.Normalize(raw)
+		require.NoError(t, err, raw)
+		assert.Equal(t, want, got, raw)
+	}
+
+	_, err := normalizer.Normalize("/relative/path")
+	assert.Error(t, err)
+
+	// Parameters are only stripped when listed
+	got, err := urlnorm.NewNormalizer(nil).Normalize("https://example.com/a?utm_source=x")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/a?utm_source=x", got)
+
+	assert.Equal(t, urlnorm.Key("http://example.com/a/"), urlnorm.Key("https://example.com/a"))
+	assert.NotEqual(t, urlnorm.Key("https://example.com/a?id=1"), urlnorm.Key("https://example.com/a?id=2"))
+
+	unique, dropped := normalizer.Unique([]string{
+		"https://example.com/a",
+		"http://example.com/a/",
+		"https://EXAMPLE.com/a?utm_campaign=z",
+		"https://example.com/b",
+		"not a url",
+	})
+	assert.Equal(t, []string{"https://example.com/a", "https://example.com/b", "not a url"}, unique)
+	assert.Equal(t, 2, dropped)
+}
+
+func TestDedupe_FetcherCollapsesDuplicates(t *testing.T) {
+	page := func(canonical, text string) string {
+		link := ""
+		if canonical != "" {
+			link = `<link href="` + canonical + `" rel="canonical">`
+		}
+		return `<html><head><title>Dedupe</title>` + link + `</head><div class="article-body"><p>` + text + `</p></div></body></html>`
+	}
+
+	var mu sync.Mutex
+	requested := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.RequestURI()]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/original":
+			io.WriteString(w, page("/original", "apple banana"))
+		case "/amp/original":
+			io.WriteString(w, page("/original", "apple banana cherry"))
+		case "/mirror":
+			io.WriteString(w, page("", "apple banana"))
+		default:
+			io.WriteString(w, page("", "something else entirely"))
+		}
+	}))
+	defer server.Close()
+
+	options := essay.DefaultOptions()
+	options.Dedupe = true
+	options.StripParams = urlnorm.DefaultStripParams
+	fetcher := newDedupeFetcher(options)
+	urls := []string{
+		server.URL + "/original",
+		server.URL + "/original/",
+		server.URL + "/original?utm_source=newsletter#top",
+		server.URL + "/other",
+		server.URL + "/amp/original",
+		server.URL + "/mirror",
+	}
+	essays, errs := streamWith(t, fetcher, urls...)
+	require.Empty(t, errs)
+
+	var fetched []string
+	for _, e := range essays {
+		fetched = append(fetched, strings.TrimPrefix(e.URL, server.URL))
+	}
+	// One worker fetches in order, so /original is emitted before what duplicates it
+	assert.Equal(t, []string{"/original", "/other"}, fetched)
+	assert.Equal(t, &models.DuplicateReport{URLs: 2, Canonical: 1, Content: 1}, fetcher.Duplicates())
+
+	mu.Lock()
+	assert.Equal(t, 1, requested["/original"], "URL variants are fetched once")
+	assert.Len(t, requested, 4)
+	mu.Unlock()
+
+	assert.Equal(t, server.URL+"/original", essays[0].CanonicalURL)
+	assert.Empty(t, essays[1].CanonicalURL)
+
+	// A fetcher that does not deduplicate reports nothing and fetches everything
+	plain := newDedupeFetcher(essay.DefaultOptions())
+	essays, errs = streamWith(t, plain, urls...)
+	require.Empty(t, errs)
+	assert.Len(t, essays, len(urls))
+	assert.Nil(t, plain.Duplicates())
+}
+
+func TestDedupe_ReportsAreMergedAndConfigured(t *testing.T) {
+	a, b := results.NewResult(), results.NewResult()
+	a.Duplicates = &models.DuplicateReport{URLs: 1, Content: 2}
+	b.Duplicates = &models.DuplicateReport{Canonical: 3}
+	merged := results.Merge(a, b, results.NewResult())
+	assert.Equal(t, &models.DuplicateReport{URLs: 1, Canonical: 3, Content: 2}, merged.Duplicates)
+	assert.Equal(t, 6, merged.Duplicates.Total())
+	assert.Nil(t, results.Merge(results.NewResult()).Duplicates)
+
+	cfg, err := loadConfig(t)
+	require.NoError(t, err)
+	options, err := cfg.FetchOptions()
+	require.NoError(t, err)
+	assert.True(t, options.Dedupe)
+	assert.Equal(t, urlnorm.DefaultStripParams, options.StripParams)
+
+	cfg, err = loadConfig(t, "-dedupe=false", "-strip-params", "sid, utm_*")
+	require.NoError(t, err)
+	options, err = cfg.FetchOptions()
+	require.NoError(t, err)
+	assert.False(t, options.Dedupe)
+	assert.Equal(t, []string{"sid", "utm_*"}, options.StripParams)
+}
@@ -0,0 +1,260 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/internal/distributed"
+	"github.com/ireuven89/firefly-itzik/internal/essay"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/processor"
+	"github.com/ireuven89/firefly-itzik/internal/rateLimiter"
+	"github.com/ireuven89/firefly-itzik/internal/results"
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDistributed_CoordinatorWithWorkers(t *testing.T) {
+	articles := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><div class="article-body"><p>apple banana apple</p></div><footer></footer></body></html>`)
+	}))
+	defer articles.Close()
+
+	urls := make([]string, 25)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%s/article/%d", articles.URL, i)
+	}
+
+	bankFile := filepath.Join(t.TempDir(), "words.txt")
+	assert.NoError(t, os.WriteFile(bankFile, []byte("apple\nbanana"), 0644))
+	wordBank := wordbank.NewWordBank(bankFile)
+
+	coordinator := distributed.NewCoordinator(urls, 4, time.Minute)
+	server := httptest.NewServer(coordinator)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	workerErrs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		fetcher := essay.NewEssayFetcher(rateLimiter.NewRateLimiter(1000, time.Second), "", 4, time.Millisecond, logging.Discard(), nil)
+		newProcessor := func() processor.WordProcessor { return processor.NewWordProcessor(wordBank) }
+		worker := distributed.NewWorker(server.URL, fmt.Sprintf("worker-%d", i), fetcher, newProcessor, 10*time.Millisecond, 10, 10, logging.Discard())
+		go func() { workerErrs <- worker.Run(ctx) }()
+	}
+
+	merged, err := coordinator.Wait(ctx)
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, <-workerErrs)
+	}
+
+	assert.Equal(t, 25, merged.TotalEssays)
+	assert.Equal(t, 50, merged.WordCounts["apple"])
+	assert.Equal(t, 25, merged.DocFrequencies["banana"])
+
+	status := coordinator.Status()
+	assert.True(t, status.Done)
+	assert.Equal(t, 7, status.CompletedShards)
+}
+
+func TestDistributed_MergesDuplicateReports(t *testing.T) {
+	edit := func(words []string) []string {
+		edited := slices.Clone(words)
+		edited[50], edited[150] = "updated", "correction"
+		return edited
+	}
+	first, second := article(1, 200), article(3, 200)
+	// Each shard of three has a near-duplicate; the first also has an exact copy
+	texts := [][]string{first, edit(first), first, second, edit(second), article(2, 200)}
+	articles := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i, _ := strconv.Atoi(path.Base(r.URL.Path))
+		fmt.Fprintf(w, `<div class="article-body"><p>%s</p></div>`, strings.Join(texts[i], " "))
+	}))
+	defer articles.Close()
+
+	urls := make([]string, len(texts))
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%s/article/%d", articles.URL, i)
+	}
+
+	bankFile := filepath.Join(t.TempDir(), "words.txt")
+	assert.NoError(t, os.WriteFile(bankFile, []byte("apple\nbanana"), 0644))
+	wordBank := wordbank.NewWordBank(bankFile)
+
+	coordinator := distributed.NewCoordinator(urls, 3, time.Minute)
+	server := httptest.NewServer(coordinator)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fetcher := essay.NewEssayFetcherWithOptions(rateLimiter.NewRateLimiter(1000, time.Second), "", 4, time.Millisecond, logging.Discard(), nil, essay.Options{Dedupe: true})
+	newProcessor := func() processor.WordProcessor {
+		return processor.NewWordProcessorWithOptions(wordBank, processor.Options{
+			NearDuplicates: processor.NearDuplicates{Mode: processor.NearDuplicatesReport, Threshold: 0.9},
+		})
+	}
+	worker := distributed.NewWorker(server.URL, "worker", fetcher, newProcessor, 10*time.Millisecond, 10, 10, logging.Discard())
+	workerErr := make(chan error, 1)
+	go func() { workerErr <- worker.Run(ctx) }()
+
+	merged, err := coordinator.Wait(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, <-workerErr)
+
+	assert.Equal(t, 5, merged.TotalEssays)
+	if assert.NotNil(t, merged.Duplicates) {
+		assert.Equal(t, 1, merged.Duplicates.Content)
+	}
+	if assert.NotNil(t, merged.NearDuplicates) {
+		assert.Equal(t, processor.NearDuplicatesReport, merged.NearDuplicates.Mode)
+		assert.Equal(t, 2, merged.NearDuplicates.Total)
+		assert.Len(t, merged.NearDuplicates.Clusters, 2, "one from each shard")
+	}
+}
+
+func TestDistributed_ExpiredLeaseIsReassigned(t *testing.T) {
+	coordinator := distributed.NewCoordinator([]string{"http://example.com/a"}, 1, 50*time.Millisecond)
+	server := httptest.NewServer(coordinator)
+	defer server.Close()
+
+	first := requestLease(t, server.URL, "slow")
+	assert.NotNil(t, first)
+
+	// Shard is held, so a second worker gets nothing
+	resp := postJSON(t, server.URL+distributed.LeasePath, distributed.LeaseRequest{WorkerID: "fast"})
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	time.Sleep(60 * time.Millisecond)
+
+	second := requestLease(t, server.URL, "fast")
+	assert.NotNil(t, second)
+	assert.Equal(t, first.ShardID, second.ShardID)
+	assert.NotEqual(t, first.ID, second.ID)
+
+	// The slow worker's late completion must not be counted
+	partial := results.NewResult()
+	partial.TotalEssays = 1
+	resp = postJSON(t, server.URL+distributed.CompletePath, distributed.CompleteRequest{LeaseID: first.ID, Result: partial})
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = postJSON(t, server.URL+distributed.CompletePath, distributed.CompleteRequest{LeaseID: second.ID, Result: partial})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = postJSON(t, server.URL+distributed.LeasePath, distributed.LeaseRequest{WorkerID: "fast"})
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+
+	merged, err := coordinator.Wait(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, merged.TotalEssays)
+	assert.Equal(t, 1, coordinator.Status().ReassignedCount)
+}
+
+func TestDistributed_LateCompletionAndRenewal(t *testing.T) {
+	coordinator := distributed.NewCoordinator([]string{"http://example.com/a", "http://example.com/b"}, 1, 50*time.Millisecond)
+	server := httptest.NewServer(coordinator)
+	defer server.Close()
+
+	first := requestLease(t, server.URL, "slow")
+	second := requestLease(t, server.URL, "steady")
+	assert.Equal(t, int64(50), first.TTLMillis)
+	time.Sleep(60 * time.Millisecond)
+
+	// Nobody leased the expired shard meanwhile, so its late completion still counts
+	partial := results.NewResult()
+	partial.TotalEssays = 1
+	resp := postJSON(t, server.URL+distributed.CompletePath, distributed.CompleteRequest{LeaseID: first.ID, Result: partial})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = postJSON(t, server.URL+distributed.RenewPath, distributed.RenewRequest{LeaseID: first.ID})
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "completed leases cannot be renewed")
+
+	// Renewing keeps the shard from being reassigned
+	resp = postJSON(t, server.URL+distributed.RenewPath, distributed.RenewRequest{LeaseID: second.ID})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = postJSON(t, server.URL+distributed.LeasePath, distributed.LeaseRequest{WorkerID: "fast"})
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	time.Sleep(60 * time.Millisecond)
+	third := requestLease(t, server.URL, "fast")
+	assert.Equal(t, second.ShardID, third.ShardID)
+	resp = postJSON(t, server.URL+distributed.RenewPath, distributed.RenewRequest{LeaseID: second.ID})
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "reassigned leases cannot be renewed")
+	resp = postJSON(t, server.URL+distributed.CompletePath, distributed.CompleteRequest{LeaseID: third.ID, Result: partial})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	merged, err := coordinator.Wait(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, merged.TotalEssays)
+}
+
+func TestDistributed_WorkerRenewsLongShards(t *testing.T) {
+	articles := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		fmt.Fprint(w, `<html><body><div class="article-body"><p>apple banana apple</p></div><footer></footer></body></html>`)
+	}))
+	defer articles.Close()
+
+	bankFile := filepath.Join(t.TempDir(), "words.txt")
+	assert.NoError(t, os.WriteFile(bankFile, []byte("apple\nbanana"), 0644))
+	wordBank := wordbank.NewWordBank(bankFile)
+
+	// Fetching the shard takes several TTLs, so only heartbeats keep the lease
+	coordinator := distributed.NewCoordinator([]string{articles.URL + "/article"}, 1, 90*time.Millisecond)
+	server := httptest.NewServer(coordinator)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	workerErrs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		fetcher := essay.NewEssayFetcher(rateLimiter.NewRateLimiter(1000, time.Second), "", 1, time.Millisecond, logging.Discard(), nil)
+		newProcessor := func() processor.WordProcessor { return processor.NewWordProcessor(wordBank) }
+		worker := distributed.NewWorker(server.URL, fmt.Sprintf("worker-%d", i), fetcher, newProcessor, 10*time.Millisecond, 10, 10, logging.Discard())
+		go func() { workerErrs <- worker.Run(ctx) }()
+	}
+
+	merged, err := coordinator.Wait(ctx)
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, <-workerErrs)
+	}
+	assert.Equal(t, 1, merged.TotalEssays)
+	assert.Equal(t, 2, merged.WordCounts["apple"])
+	assert.Equal(t, 0, coordinator.Status().ReassignedCount)
+}
+
+func requestLease(t *testing.T, baseURL, workerID string) *distributed.Lease {
+	resp := postJSON(t, baseURL+distributed.LeasePath, distributed.LeaseRequest{WorkerID: workerID})
+	defer resp.Body.Close()
+	if !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return nil
+	}
+
+	var lease distributed.Lease
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&lease))
+	return &lease
+}
+
+func postJSON(t *testing.T, url string, body any) *http.Response {
+	payload, err := json.Marshal(body)
+	assert.NoError(t, err)
+
+	resp, err := http.Post(url, "application/json", bytes.NewReader(payload))
+	assert.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/ireuven89/firefly-itzik/internal/essay"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/processor"
+	"github.com/ireuven89/firefly-itzik/internal/rateLimiter"
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fetchErrors streams urls through a fetcher limited to rate requests per interval and returns the errors by URL
+func fetchErrors(t *testing.T, ctx context.Context, limiter rateLimiter.RateLimiter, urls ...string) map[string]error {
+	fetcher := essay.NewEssayFetcher(limiter, "", 4, time.Millisecond, logging.Discard(), nil)
+	essayStream := make(chan models.Essay, len(urls))
+	errorChan := make(chan error, len(urls))
+	require.NoError(t, fetcher.StreamURLs(ctx, urls, essayStream, errorChan))
+	close(errorChan)
+
+	errs := make(map[string]error)
+	for err := range errorChan {
+		var fetchErr *essay.FetchError
+		require.ErrorAs(t, err, &fetchErr)
+		errs[fetchErr.URL] = err
+	}
+	return errs
+}
+
+func TestFetchError_Kinds(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/broken":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/empty":
+			io.WriteString(w, "<html><body></body></html>")
+		default:
+			io.WriteString(w, `<html><div class="article-body"><p>apple</p></div></body></html>`)
+		}
+	}))
+	defer server.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	errs := fetchErrors(t, context.Background(), rateLimiter.NewRateLimiter(1000, time.Second),
+		server.URL+"/ok", server.URL+"/missing", server.URL+"/broken", server.URL+"/empty", closed.URL+"/gone", "http://[::1")
+	require.Len(t, errs, 5)
+
+	missing := errs[server.URL+"/missing"]
+	assert.ErrorIs(t, missing, essay.ErrNotFound)
+	var fetchErr *essay.FetchError
+	require.ErrorAs(t, missing, &fetchErr)
+	assert.Equal(t, "not_found", fetchErr.Category())
+	assert.Equal(t, http.StatusNotFound, fetchErr.Status)
+	assert.Len(t, fetchErr.History, 1, "404s are not retried")
+
+	broken := errs[server.URL+"/broken"]
+	assert.ErrorIs(t, broken, essay.ErrHTTPStatus)
+	require.ErrorAs(t, broken, &fetchErr)
+	assert.Equal(t, http.StatusBadGateway, fetchErr.Status)
+	assert.Len(t, fetchErr.History, 3)
+	assert.Contains(t, broken.Error(), "status 502")
+
+	assert.ErrorIs(t, errs[server.URL+"/empty"], essay.ErrExtraction)
+	assert.ErrorIs(t, errs[closed.URL+"/gone"], essay.ErrConnection)
+
+	require.ErrorAs(t, errs["http://[::1"], &fetchErr)
+	assert.Equal(t, "invalid_url", fetchErr.Category())
+	assert.Empty(t, fetchErr.History, "nothing was requested")
+}
+
+func TestFetchError_RateLimitCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<html><div class="article-body"><p>apple</p></div></body></html>`)
+	}))
+	defer server.Close()
+
+	// One token per hour: the second fetch waits until the context expires
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	errs := fetchErrors(t, ctx, rateLimiter.NewRateLimiter(1, time.Hour), server.URL+"/a", server.URL+"/b")
+
+	require.Len(t, errs, 1)
+	for _, err := range errs {
+		assert.ErrorIs(t, err, essay.ErrRateLimitCanceled)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+}
+
+func TestProcessor_FailureReport(t *testing.T) {
+	bankFile := filepath.Join(t.TempDir(), "words.txt")
+	require.NoError(t, os.WriteFile(bankFile, []byte("apple\n"), 0644))
+	wp := processor.NewWordProcessorWithOptions(wordbank.NewWordBank(bankFile), processor.Options{Logger: logging.Discard()})
+
+	essayStream := make(chan models.Essay)
+	errorChan := make(chan error, 3)
+	errorChan <- &essay.FetchError{Kind: essay.ErrNotFound, URL: "http://a", Status: 404, History: []models.Attempt{{Status: 404}}}
+	errorChan <- &essay.FetchError{Kind: essay.ErrTimeout, URL: "http://b", History: make([]models.Attempt, 3), Err: context.DeadlineExceeded}
+	errorChan <- errors.New("lease expired")
+	close(essayStream)
+	close(errorChan)
+
+	_, _, totalErrors := wp.ProcessEssayStream(context.Background(), essayStream, errorChan, 10)
+	assert.Equal(t, 3, totalErrors)
+
+	report := wp.FailureReport()
+	assert.Equal(t, 3, report.TotalFailures)
+	assert.Equal(t, map[string]int{"not_found": 1, "timeout": 1, processor.CategoryOther: 1}, report.ByCategory)
+	require.Len(t, report.Failures, 3)
+	assert.Equal(t, models.Failure{URL: "http://a", Category: "not_found", Status: 404, Attempts: 1, History: []models.Attempt{{Status: 404}}, Message: "fetch http://a: not found (status 404)"}, report.Failures[0])
+	assert.Equal(t, "fetch http://b: timed out after 3 attempts: context deadline exceeded", report.Failures[1].Message)
+	assert.Equal(t, models.Failure{Category: processor.CategoryOther, Message: "lease expired"}, report.Failures[2])
+	assert.Equal(t, report.ByCategory, wp.Result().ErrorsByCategory)
+}
@@ -0,0 +1,228 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"github.com/ireuven89/firefly-itzik/internal/essay"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/rateLimiter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const policyTestPage = `<html><title>Policy</title><div class="article-body"><p>apple banana</p></div></body></html>`
+
+// fetchWithPolicy streams urls through a fetcher using policy and returns the essays and errors by URL
+func fetchWithPolicy(t *testing.T, policy essay.ResponsePolicy, urls ...string) (map[string]models.Essay, map[string]*essay.FetchError) {
+	fetcher := essay.NewEssayFetcherWithOptions(rateLimiter.NewRateLimiter(1000, time.Second), "", 4, time.Millisecond, logging.Discard(), nil, essay.Options{Response: policy})
+	essayStream := make(chan models.Essay, len(urls))
+	errorChan := make(chan error, len(urls))
+	require.NoError(t, fetcher.StreamURLs(context.Background(), urls, essayStream, errorChan))
+	close(essayStream)
+	close(errorChan)
+
+	essays := make(map[string]models.Essay)
+	for e := range essayStream {
+		essays[e.URL] = e
+	}
+	errs := make(map[string]*essay.FetchError)
+	for err := range errorChan {
+		var fetchErr *essay.FetchError
+		require.ErrorAs(t, err, &fetchErr)
+		errs[fetchErr.URL] = fetchErr
+	}
+	return essays, errs
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestResponsePolicy_ContentTypeAndSize(t *testing.T) {
+	large := policyTestPage + strings.Repeat("<p>filler</p>", 200)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			io.WriteString(w, "%PDF-1.4 apple banana")
+		case "/xhtml":
+			w.Header().Set("Content-Type", "application/xhtml+xml; charset=utf-8")
+			io.WriteString(w, policyTestPage)
+		case "/sniffed-png":
+			w.Header()["Content-Type"] = nil
+			w.Write([]byte("\x89PNG\r\n\x1a\n apple banana"))
+		case "/large":
+			io.WriteString(w, large)
+		case "/large-chunked":
+			io.WriteString(w, large[:100])
+			w.(http.Flusher).Flush()
+			io.WriteString(w, large[100:])
+		default:
+			io.WriteString(w, policyTestPage)
+		}
+	}))
+	defer server.Close()
+
+	policy := essay.DefaultResponsePolicy()
+	policy.MaxBodyBytes = 1024
+	essays, errs := fetchWithPolicy(t, policy,
+		server.URL+"/ok", server.URL+"/xhtml", server.URL+"/pdf", server.URL+"/sniffed-png", server.URL+"/large", server.URL+"/large-chunked")
+
+	assert.Contains(t, essays, server.URL+"/ok")
+	assert.Contains(t, essays, server.URL+"/xhtml")
+	require.Len(t, errs, 4)
+
+	for _, path := range []string{"/pdf", "/sniffed-png"} {
+		assert.ErrorIs(t, errs[server.URL+path], essay.ErrContentType, path)
+		assert.Equal(t, "content_type", errs[server.URL+path].Category())
+	}
+	assert.Contains(t, errs[server.URL+"/pdf"].Error(), "application/pdf")
+
+	for _, path := range []string{"/large", "/large-chunked"} {
+		assert.ErrorIs(t, errs[server.URL+path], essay.ErrBodyTooLarge, path)
+		assert.Equal(t, http.StatusOK, errs[server.URL+path].Status)
+		assert.Len(t, errs[server.URL+path].History, 1, "policy violations are not retried")
+	}
+
+	// An empty allowlist and no size limit accept everything
+	essays, errs = fetchWithPolicy(t, essay.ResponsePolicy{MaxRedirects: 1}, server.URL+"/large", server.URL+"/pdf")
+	assert.Empty(t, errs[server.URL+"/large"])
+	assert.Contains(t, essays, server.URL+"/large")
+	assert.ErrorIs(t, errs[server.URL+"/pdf"], essay.ErrExtraction, "a PDF has no article to extract")
+}
+
+func TestResponsePolicy_Redirects(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, policyTestPage)
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/hop1", http.StatusMovedPermanently)
+		case "/hop1":
+			http.Redirect(w, r, "/hop2", http.StatusFound)
+		case "/hop2":
+			http.Redirect(w, r, "/article", http.StatusFound)
+		case "/elsewhere":
+			http.Redirect(w, r, other.URL+"/article", http.StatusFound)
+		default:
+			io.WriteString(w, policyTestPage)
+		}
+	}))
+	defer server.Close()
+	// Both servers listen on 127.0.0.1; "localhost" makes the redirect to other cross hosts
+	elsewhere := strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/elsewhere"
+
+	essays, errs := fetchWithPolicy(t, essay.DefaultResponsePolicy(), server.URL+"/moved", server.URL+"/article", elsewhere)
+	assert.Empty(t, errs)
+	assert.Equal(t, server.URL+"/article", essays[server.URL+"/moved"].FinalURL)
+	assert.Empty(t, essays[server.URL+"/article"].FinalURL, "no redirect, no final URL")
+	assert.Equal(t, other.URL+"/article", essays[elsewhere].FinalURL)
+
+	policy := essay.DefaultResponsePolicy()
+	policy.MaxRedirects = 2
+	policy.CrossHostRedirects = false
+	essays, errs = fetchWithPolicy(t, policy, server.URL+"/moved", server.URL+"/hop1", elsewhere)
+	assert.Equal(t, server.URL+"/article", essays[server.URL+"/hop1"].FinalURL, "two hops are allowed")
+	require.Len(t, errs, 2)
+
+	tooMany := errs[server.URL+"/moved"]
+	assert.ErrorIs(t, tooMany, essay.ErrRedirect)
+	assert.Equal(t, "redirect", tooMany.Category())
+	assert.Equal(t, http.StatusFound, tooMany.Status)
+	assert.Contains(t, tooMany.Error(), "stopped after 2 redirects")
+	require.Len(t, tooMany.History, 1)
+	assert.Equal(t, server.URL+"/hop2", tooMany.History[0].FinalURL)
+
+	crossHost := errs[elsewhere]
+	assert.ErrorIs(t, crossHost, essay.ErrRedirect)
+	assert.Contains(t, crossHost.Error(), "to 127.0.0.1")
+}
+
+func TestResponsePolicy_Decompression(t *testing.T) {
+	bomb := gzipped(t, bytes.Repeat([]byte("a"), 1<<20))
+	page := gzipped(t, []byte(policyTestPage))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(page)
+		case "/bomb":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(bomb)
+		case "/corrupt":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(append(page[:len(page)/2:len(page)/2], bytes.Repeat([]byte{0xff}, 64)...))
+		case "/brotli":
+			w.Header().Set("Content-Encoding", "br")
+			w.Write([]byte{0x1b, 0x03, 0x00})
+		}
+	}))
+	defer server.Close()
+
+	policy := essay.DefaultResponsePolicy()
+	policy.MaxBodyBytes = 64 << 10
+	require.Less(t, len(bomb), int(policy.MaxBodyBytes), "the compressed bomb fits the limit")
+
+	essays, errs := fetchWithPolicy(t, policy, server.URL+"/gzip", server.URL+"/bomb", server.URL+"/corrupt", server.URL+"/brotli")
+	assert.Equal(t, "apple banana", essays[server.URL+"/gzip"].Content)
+	require.Len(t, errs, 3)
+	assert.ErrorIs(t, errs[server.URL+"/bomb"], essay.ErrBodyTooLarge)
+	assert.ErrorIs(t, errs[server.URL+"/corrupt"], essay.ErrDecompression)
+	assert.ErrorIs(t, errs[server.URL+"/brotli"], essay.ErrDecompression)
+	assert.Equal(t, "decompression", errs[server.URL+"/brotli"].Category())
+}
+
+func TestResponsePolicy_DecodesWithCustomAcceptEncoding(t *testing.T) {
+	page := gzipped(t, []byte(policyTestPage))
+	var deflated bytes.Buffer
+	zw := zlib.NewWriter(&deflated)
+	_, err := zw.Write([]byte(policyTestPage))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gzip, deflate", r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(page)
+		case "/deflate":
+			w.Header().Set("Content-Encoding", "deflate")
+			w.Write(deflated.Bytes())
+		case "/corrupt":
+			w.Header().Set("Content-Encoding", "deflate")
+			w.Write([]byte("not deflate"))
+		}
+	}))
+	defer server.Close()
+
+	// A configured Accept-Encoding stops the transport from decoding gzip itself
+	options := essay.Options{Response: essay.DefaultResponsePolicy(), Client: essay.ClientOptions{Headers: http.Header{"Accept-Encoding": {"gzip, deflate"}}}}
+	essays, errs := fetchWithOptions(t, options, server.URL+"/gzip", server.URL+"/deflate", server.URL+"/corrupt")
+	require.Len(t, essays, 2)
+	for _, e := range essays {
+		assert.Equal(t, "apple banana", e.Content, e.URL)
+	}
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], essay.ErrDecompression)
+	assert.Contains(t, errs[0].Error(), "/corrupt")
+}
@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"context"
+	"github.com/ireuven89/firefly-itzik/internal/essay"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/rateLimiter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const retryTestPage = `<html><title>Retry</title><div class="article-body"><p>apple banana</p></div></body></html>`
+
+// sequenceServer answers each request to a path with the next status of its sequence, repeating the last one;
+// 200 responses carry body as HTML
+func sequenceServer(t *testing.T, body string, sequences map[string][]int) *httptest.Server {
+	var mu sync.Mutex
+	served := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		statuses := sequences[r.URL.Path]
+		status := statuses[min(served[r.URL.Path], len(statuses)-1)]
+		served[r.URL.Path]++
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			io.WriteString(w, body)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// fetchOne streams a single URL and returns what came out of each channel
+func fetchOne(t *testing.T, url string) ([]models.Essay, []error) {
+	fetcher := essay.NewEssayFetcher(rateLimiter.NewRateLimiter(1000, time.Second), "", 1, time.Millisecond, logging.Discard(), nil)
+	essayStream := make(chan models.Essay, 1)
+	errorChan := make(chan error, 1)
+	require.NoError(t, fetcher.StreamURLs(context.Background(), []string{url}, essayStream, errorChan))
+	close(essayStream)
+	close(errorChan)
+
+	var essays []models.Essay
+	for e := range essayStream {
+		essays = append(essays, e)
+	}
+	var errs []error
+	for err := range errorChan {
+		errs = append(errs, err)
+	}
+	return essays, errs
+}
+
+func attemptStatuses(history []models.Attempt) []int {
+	var statuses []int
+	for _, a := range history {
+		statuses = append(statuses, a.Status)
+	}
+	return statuses
+}
+
+func TestFetchRetry_ExhaustedIsAnError(t *testing.T) {
+	server := sequenceServer(t, retryTestPage, map[string][]int{
+		"/500": {500, 500, 500},
+		"/503": {503},
+		"/429": {429, 503, 429},
+	})
+
+	for path, want := range map[string][]int{
+		"/500": {500, 500, 500},
+		"/503": {503, 503, 503},
+		"/429": {429, 503, 429},
+	} {
+		t.Run(path, func(t *testing.T) {
+			essays, errs := fetchOne(t, server.URL+path)
+			assert.Empty(t, essays, "no empty essay is emitted once retries run out")
+			require.Len(t, errs, 1)
+
+			var fetchErr *essay.FetchError
+			require.ErrorAs(t, errs[0], &fetchErr)
+			assert.ErrorIs(t, fetchErr, essay.ErrHTTPStatus)
+			assert.Equal(t, want[len(want)-1], fetchErr.Status, "final status")
+			assert.Equal(t, want, attemptStatuses(fetchErr.History))
+		})
+	}
+}
+
+func TestFetchRetry_RecoversWithinAttempts(t *testing.T) {
+	server := sequenceServer(t, retryTestPage, map[string][]int{
+		"/503-then-ok": {503, 200},
+		"/429-then-ok": {429, 500, 200},
+	})
+
+	for _, path := range []string{"/503-then-ok", "/429-then-ok"} {
+		t.Run(path, func(t *testing.T) {
+			essays, errs := fetchOne(t, server.URL+path)
+			assert.Empty(t, errs)
+			require.Len(t, essays, 1)
+			assert.Equal(t, "apple banana", essays[0].Content)
+		})
+	}
+}
+
+func TestFetchRetry_ClientErrorsAreNotRetried(t *testing.T) {
+	server := sequenceServer(t, retryTestPage, map[string][]int{
+		"/forbidden": {403, 200},
+		"/missing":   {404, 200},
+	})
+
+	_, errs := fetchOne(t, server.URL+"/forbidden")
+	require.Len(t, errs, 1)
+	var fetchErr *essay.FetchError
+	require.ErrorAs(t, errs[0], &fetchErr)
+	assert.ErrorIs(t, fetchErr, essay.ErrHTTPStatus)
+	assert.Equal(t, []int{403}, attemptStatuses(fetchErr.History))
+
+	_, errs = fetchOne(t, server.URL+"/missing")
+	require.Len(t, errs, 1)
+	require.ErrorAs(t, errs[0], &fetchErr)
+	assert.ErrorIs(t, fetchErr, essay.ErrNotFound)
+	assert.Equal(t, []int{404}, attemptStatuses(fetchErr.History))
+}
+
+func TestFetchRetry_EmptyContentIsAnError(t *testing.T) {
+	for name, body := range map[string]string{
+		"empty body":    "",
+		"blank body":    " \n\t ",
+		"no article":    "<html><head><title>Nothing</title></head><body><nav>Home</nav></body></html>",
+		"empty article": `<html><div class="article-body">  </div></body></html>`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := sequenceServer(t, body, map[string][]int{"/": {200}})
+
+			essays, errs := fetchOne(t, server.URL+"/")
+			assert.Empty(t, essays)
+			require.Len(t, errs, 1)
+
+			var fetchErr *essay.FetchError
+			require.ErrorAs(t, errs[0], &fetchErr)
+			assert.ErrorIs(t, fetchErr, essay.ErrExtraction)
+			assert.Equal(t, http.StatusOK, fetchErr.Status)
+			assert.Equal(t, []int{200}, attemptStatuses(fetchErr.History))
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/internal/fuzzy"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/processor"
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFuzzy_Distance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"kitten", "kitten", 0},
+		{"kitten", "sitten", 1},
+		{"kitten", "kiten", 1},
+		{"kitten", "ikttne", 2},
+		{"kitten", "sitting", 3},
+		{"technology", "tecnhology", 1},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, fuzzy.Distance(tt.a, tt.b, 3), "%s/%s", tt.a, tt.b)
+	}
+	assert.Equal(t, 2, fuzzy.Distance("kitten", "sitting", 1), "stops at limit+1")
+}
+
+func TestFuzzy_Match(t *testing.T) {
+	m := fuzzy.NewMatcher([]string{"technology", "software", "computer", "compute", "hardware"}, 1)
+
+	tests := map[string]string{
+		"tecnhology": "technology", // transposition
+		"softwre":    "software",   // deletion
+		"computerr":  "computer",   // insertion
+		"hardwire":   "hardware",   // substitution
+		"computes":   "compute",    // ties with computer go to the lexicographically smallest word
+	}
+	for token, expected := range tests {
+		word, ok := m.Match(token)
+		assert.True(t, ok, token)
+		assert.Equal(t, expected, word, token)
+	}
+
+	_, ok := m.Match("sfotwaer")
+	assert.False(t, ok, "beyond the edit distance")
+	_, ok = m.Match("cmp")
+	assert.False(t, ok, "too short to match")
+
+	m = fuzzy.NewMatcher([]string{"technology"}, 2)
+	word, ok := m.Match("tecnolgy")
+	assert.True(t, ok)
+	assert.Equal(t, "technology", word)
+}
+
+func TestWordProcessor_FuzzyCorrections(t *testing.T) {
+	bankFile := filepath.Join(t.TempDir(), "words.txt")
+	assert.NoError(t, os.WriteFile(bankFile, []byte("technology\nsoftware\n"), 0644))
+	wb := wordbank.NewWordBank(bankFile)
+
+	essayStream := make(chan models.Essay, 1)
+	errorChan := make(chan error)
+	essayStream <- models.Essay{Content: "technology tecnhology tecnhology softwre qwertyuiop"}
+	close(essayStream)
+	close(errorChan)
+
+	wp := processor.NewWordProcessorWithOptions(wb, processor.Options{Fuzzy: fuzzy.NewWordBankMatcher(wb, 1), TrackRejected: true})
+	topWords, _, _ := wp.ProcessEssayStream(context.Background(), essayStream, errorChan, 10)
+	assert.Equal(t, []models.WordCount{{Word: "technology", Count: 3}, {Word: "software", Count: 1}}, topWords)
+
+	report := wp.CorrectionReport()
+	assert.Equal(t, 3, report.TotalCorrected)
+	assert.Equal(t, []models.Correction{
+		{From: "tecnhology", To: "technology", Count: 2},
+		{From: "softwre", To: "software", Count: 1},
+	}, report.Corrections)
+
+	oov := wp.OOVReport(10)
+	assert.Equal(t, []models.RejectedToken{{Token: "qwertyuiop", Count: 1, Reason: processor.ReasonNotInBank}}, oov.TopTokens)
+}
+
+func BenchmarkFuzzy_Match(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	words := make([]string, benchmarkBankSize)
+	for i := range words {
+		word := make([]byte, 3+rng.Intn(10))
+		for j := range word {
+			word[j] = byte('a' + rng.Intn(26))
+		}
+		words[i] = string(word)
+	}
+
+	for _, distance := range []int{1, 2} {
+		b.Run(fmt.Sprintf("distance%d", distance), func(b *testing.B) {
+			m := fuzzy.NewMatcher(words, distance)
+
+			// Misspell one letter of a random word per lookup, so every lookup misses the cache
+			tokens := make([]string, b.N)
+			for i := range tokens {
+				token := []byte(words[rng.Intn(len(words))])
+				token[rng.Intn(len(token))] = byte('a' + rng.Intn(26))
+				tokens[i] = string(token)
+			}
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				m.Match(tokens[i])
+			}
+		})
+	}
+}
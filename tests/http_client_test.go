@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"context"
+	"encoding/pem"
+	"github.com/ireuven89/firefly-itzik/internal/essay"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/rateLimiter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const clientTestPage = `<html><title>Client</title><div class="article-body"><p>apple banana</p></div></body></html>`
+
+// fetchWithOptions streams urls through a fetcher built from options and returns the essays and errors
+func fetchWithOptions(t *testing.T, options essay.Options, urls ...string) ([]models.Essay, []error) {
+	return streamWith(t, essay.NewEssayFetcherWithOptions(rateLimiter.NewRateLimiter(1000, time.Second), "", 2, time.Millisecond, logging.Discard(), nil, options), urls...)
+}
+
+// streamWith streams urls through fetcher and returns the essays and errors
+func streamWith(t *testing.T, fetcher essay.EssayFetcher, urls ...string) ([]models.Essay, []error) {
+	essayStream := make(chan models.Essay, len(urls))
+	errorChan := make(chan error, len(urls))
+	require.NoError(t, fetcher.StreamURLs(context.Background(), urls, essayStream, errorChan))
+	close(essayStream)
+	close(errorChan)
+
+	var essays []models.Essay
+	for e := range essayStream {
+		essays = append(essays, e)
+	}
+	var errs []error
+	for err := range errorChan {
+		errs = append(errs, err)
+	}
+	return essays, errs
+}
+
+func TestHTTPClient_HeadersCookiesAndUserAgent(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string]*http.Request)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen[r.URL.Path] = r
+		mu.Unlock()
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, clientTestPage)
+	}))
+	defer server.Close()
+
+	headersFile := filepath.Join(t.TempDir(), "headers")
+	require.NoError(t, os.WriteFile(headersFile, []byte("# internal blog\nAuthorization: Bearer s3cret\nX-Team: search\nX-Team: data\nUser-Agent: overridden\n"), 0644))
+	headers, err := essay.ReadHeaders(headersFile)
+	require.NoError(t, err)
+	cookies, err := essay.ParseCookies("session=abc; theme=dark")
+	require.NoError(t, err)
+
+	options := essay.DefaultOptions()
+	options.Client = essay.ClientOptions{Headers: headers, Cookies: cookies}
+	options.UserAgent = "firefly-test/3.0"
+	options.Robots = true
+	essays, errs := fetchWithOptions(t, options, server.URL+"/article")
+	require.Empty(t, errs)
+	require.Len(t, essays, 1)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, path := range []string{"/robots.txt", "/article"} {
+		r := seen[path]
+		require.NotNil(t, r, path)
+		assert.Equal(t, "Bearer s3cret", r.Header.Get("Authorization"), path)
+		assert.Equal(t, []string{"search", "data"}, r.Header.Values("X-Team"), path)
+		assert.Equal(t, "firefly-test/3.0", r.UserAgent(), path)
+		session, err := r.Cookie("session")
+		require.NoError(t, err, path)
+		assert.Equal(t, "abc", session.Value)
+		theme, err := r.Cookie("theme")
+		require.NoError(t, err, path)
+		assert.Equal(t, "dark", theme.Value)
+	}
+}
+
+func TestHTTPClient_CABundleAndHTTP2(t *testing.T) {
+	var protos sync.Map
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protos.Store(r.URL.Path, r.ProtoMajor)
+		io.WriteString(w, clientTestPage)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	_, errs := fetchWithOptions(t, essay.DefaultOptions(), server.URL+"/untrusted")
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], essay.ErrConnection, "the test server's certificate is not trusted by default")
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644))
+	roots, err := essay.LoadCABundle(bundle)
+	require.NoError(t, err)
+
+	options := essay.DefaultOptions()
+	options.Client.RootCAs = roots
+	essays, errs := fetchWithOptions(t, options, server.URL+"/h2")
+	require.Empty(t, errs)
+	require.Len(t, essays, 1)
+
+	options.Client.DisableHTTP2 = true
+	_, errs = fetchWithOptions(t, options, server.URL+"/h1")
+	require.Empty(t, errs)
+
+	h2, _ := protos.Load("/h2")
+	h1, _ := protos.Load("/h1")
+	assert.Equal(t, 2, h2)
+	assert.Equal(t, 1, h1)
+
+	_, err = essay.LoadCABundle(filepath.Join(t.TempDir(), "missing.pem"))
+	assert.Error(t, err)
+	notPEM := filepath.Join(t.TempDir(), "not.pem")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0644))
+	_, err = essay.LoadCABundle(notPEM)
+	assert.ErrorContains(t, err, "no PEM certificates")
+}
+
+func TestHTTPClient_ProxyAndTimeout(t *testing.T) {
+	var proxied []string
+	var mu sync.Mutex
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxied = append(proxied, r.URL.String())
+		mu.Unlock()
+		io.WriteString(w, clientTestPage)
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+	options := essay.DefaultOptions()
+	options.Client.Proxy = proxyURL
+	// The .invalid host does not resolve, so only the proxy can answer
+	essays, errs := fetchWithOptions(t, options, "http://essays.invalid/2019/08/article")
+	require.Empty(t, errs)
+	require.Len(t, essays, 1)
+	assert.Equal(t, []string{"http://essays.invalid/2019/08/article"}, proxied)
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	options = essay.DefaultOptions()
+	options.Client.Timeout = 50 * time.Millisecond
+	_, errs = fetchWithOptions(t, options, slow.URL+"/slow")
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], essay.ErrTimeout)
+}
+
+func TestHTTPClient_ParsingErrors(t *testing.T) {
+	headersFile := filepath.Join(t.TempDir(), "headers")
+	require.NoError(t, os.WriteFile(headersFile, []byte("Good: yes\nno colon here\n"), 0644))
+	_, err := essay.ReadHeaders(headersFile)
+	assert.ErrorContains(t, err, ":2:")
+
+	_, err = essay.ParseCookies("session=abc; broken")
+	assert.ErrorContains(t, err, `invalid cookie "broken"`)
+	cookies, err := essay.ParseCookies("")
+	assert.NoError(t, err)
+	assert.Empty(t, cookies)
+
+	_, err = loadConfig(t, "-proxy", "ftp://proxy:21", "-cookies", "=x", "-http-timeout", "100ms", "-connect-timeout", "1ms")
+	assert.ErrorContains(t, err, "proxy must be an http, https or socks5 URL")
+	assert.ErrorContains(t, err, "invalid cookie")
+	assert.ErrorContains(t, err, "HTTP timeout must be between")
+	assert.ErrorContains(t, err, "connect timeout must be between")
+
+	cfg, err := loadConfig(t, "-headers-file", filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	_, err = cfg.FetchOptions()
+	assert.ErrorContains(t, err, "failed to read headers file")
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/ireuven89/firefly-itzik/internal/essay"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/rateLimiter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLevel(t *testing.T) {
+	level, err := logging.ParseLevel("debug")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, level)
+
+	level, err = logging.ParseLevel("WARN")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelWarn, level)
+
+	_, err = logging.ParseLevel("verbose")
+	assert.Error(t, err)
+	assert.Error(t, logging.ValidateFormat("xml"))
+}
+
+func TestLogging_LevelFilters(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "warn", logging.FormatText)
+	require.NoError(t, err)
+
+	logger.Info("hidden")
+	logger.Warn("shown", "key", "value")
+
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), "level=WARN msg=shown key=value")
+}
+
+func TestLogging_FetcherAttemptFields(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "debug", logging.FormatJSON)
+	require.NoError(t, err)
+
+	fetcher := essay.NewEssayFetcher(rateLimiter.NewRateLimiter(1000, time.Second), "", 1, time.Millisecond, logger, nil)
+	essayStream := make(chan models.Essay, 1)
+	errorChan := make(chan error, 1)
+	require.NoError(t, fetcher.StreamURLs(context.Background(), []string{server.URL}, essayStream, errorChan))
+
+	var attempts []float64
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		if record["msg"] != "fetch attempt failed" {
+			continue
+		}
+		assert.Equal(t, "WARN", record["level"])
+		assert.Equal(t, server.URL, record["url"])
+		assert.Equal(t, float64(http.StatusServiceUnavailable), record["status"])
+		assert.Contains(t, record, "duration")
+		attempts = append(attempts, record["attempt"].(float64))
+	}
+	assert.Equal(t, []float64{1, 2, 3}, attempts)
+}
@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"github.com/ireuven89/firefly-itzik/internal/essay"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/metrics"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/processor"
+	"github.com/ireuven89/firefly-itzik/internal/rateLimiter"
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegistry_TextExposition(t *testing.T) {
+	registry := metrics.NewRegistry()
+	requests := registry.NewCounterVec("test_requests_total", "Requests by code.", "code")
+	latency := registry.NewHistogram("test_latency_seconds", "Latency.", []float64{0.1, 1})
+	registry.NewGaugeFunc("test_queue_length", "Queued items.", func() float64 { return 3 })
+
+	requests.With("200").Add(2)
+	requests.With(`a"b`).Inc()
+	latency.Observe(0.1)
+	latency.Observe(0.5)
+	latency.Observe(7)
+
+	var buf bytes.Buffer
+	require.NoError(t, registry.WriteText(&buf))
+	assert.Equal(t, `# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.1"} 1
+test_latency_seconds_bucket{le="1"} 2
+test_latency_seconds_bucket{le="+Inf"} 3
+test_latency_seconds_sum 7.6
+test_latency_seconds_count 3
+# HELP test_queue_length Queued items.
+# TYPE test_queue_length gauge
+test_queue_length 3
+# HELP test_requests_total Requests by code.
+# TYPE test_requests_total counter
+test_requests_total{code="200"} 2
+test_requests_total{code="a\"b"} 1
+`, buf.String())
+
+	assert.Panics(t, func() { registry.NewCounter("test_queue_length", "Duplicate.") })
+}
+
+func TestMetrics_NilRecordsNothing(t *testing.T) {
+	var m *metrics.Metrics
+	assert.Nil(t, metrics.New(nil))
+	assert.NotPanics(t, func() {
+		m.FetchAttempt(200, time.Millisecond, false)
+		m.EssaysProcessed(1)
+		metrics.RegisterChannel(m, "queue", "Items", make(chan int, 1))
+	})
+}
+
+func TestMetrics_ScrapeAfterFetchAndProcess(t *testing.T) {
+	var flakyCalls atomic.Int32
+	essays := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			if flakyCalls.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fallthrough
+		case "/ok":
+			io.WriteString(w, `<html><title>Ok</title><div class="article-body"><p>apple banana apple</p></div></body></html>`)
+		case "/plain":
+			io.WriteString(w, `<html><p>cherry is a paragraph long enough to keep</p></html>`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer essays.Close()
+
+	registry := metrics.NewRegistry()
+	m := metrics.New(registry)
+
+	bankFile := filepath.Join(t.TempDir(), "words.txt")
+	require.NoError(t, os.WriteFile(bankFile, []byte("apple\nbanana\ncherry\n"), 0644))
+
+	fetcher := essay.NewEssayFetcher(rateLimiter.NewRateLimiter(1000, time.Second), "", 2, time.Millisecond, logging.Discard(), m)
+	wp := processor.NewWordProcessorWithOptions(wordbank.NewWordBank(bankFile), processor.Options{Logger: logging.Discard(), Metrics: m})
+
+	essayStream := make(chan models.Essay, 4)
+	errorChan := make(chan error, 1)
+	metrics.RegisterChannel(m, "essay_stream", "Essays", essayStream)
+	require.NoError(t, fetcher.StreamURLs(context.Background(), []string{essays.URL + "/ok", essays.URL + "/plain", essays.URL + "/flaky", essays.URL + "/missing"}, essayStream, errorChan))
+	close(essayStream)
+	close(errorChan)
+	wp.ProcessEssayStream(context.Background(), essayStream, errorChan, 10)
+
+	scraper := httptest.NewServer(registry)
+	defer scraper.Close()
+	resp, err := http.Get(scraper.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, metrics.ContentType, resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	for _, line := range []string{
+		`firefly_fetch_attempts_total{status="200"} 3`,
+		`firefly_fetch_attempts_total{status="404"} 1`,
+		`firefly_fetch_attempts_total{status="503"} 1`,
+		`firefly_fetch_retries_total 1`,
+		`firefly_fetch_duration_seconds_count 5`,
+		`firefly_extractions_total{strategy="container"} 2`,
+		`firefly_extractions_total{strategy="paragraphs"} 1`,
+		`firefly_rate_limiter_wait_seconds_count 4`,
+		`firefly_essays_processed_total 3`,
+		`firefly_essay_errors_total 1`,
+		`firefly_words_counted_total 7`,
+		`firefly_essay_stream_length 0`,
+		`firefly_essay_stream_capacity 4`,
+	} {
+		assert.Contains(t, string(body), line+"\n")
+	}
+	assert.Regexp(t, `firefly_fetch_bytes_total \d+\n`, string(body))
+}
@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"context"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/processor"
+	"github.com/ireuven89/firefly-itzik/internal/simhash"
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var articleVocabulary = strings.Fields(`apple banana cherry market device software company growth battery screen
+	camera launch review price update design feature network storage cloud service mobile laptop chip
+	energy future report season player league budget policy health science climate travel`)
+
+// article is a deterministic text of n words drawn from articleVocabulary
+func article(seed int64, n int) []string {
+	rng := rand.New(rand.NewSource(seed))
+	words := make([]string, n)
+	for i := range words {
+		words[i] = articleVocabulary[rng.Intn(len(articleVocabulary))]
+	}
+	return words
+}
+
+// nearDuplicateEssays are an article, a lightly edited copy, an unrelated article and an exact copy, in that order
+func nearDuplicateEssays() []models.Essay {
+	original := article(1, 200)
+	edited := slices.Clone(original)
+	edited[50], edited[150] = "updated", "correction"
+	return []models.Essay{
+		{URL: "https://example.com/original", Content: strings.Join(original, " ")},
+		{URL: "https://example.com/syndicated", Content: strings.Join(edited, " ")},
+		{URL: "https://example.com/unrelated", Content: strings.Join(article(2, 200), " ")},
+		{URL: "https://example.com/copy", Content: strings.Join(original, " ")},
+	}
+}
+
+func TestSimHash_SimilarityAndIndex(t *testing.T) {
+	essays := nearDuplicateEssays()
+	fingerprints := make([]simhash.Fingerprint, len(essays))
+	for i, e := range essays {
+		fingerprints[i] = simhash.Of(strings.Fields(e.Content))
+	}
+
+	assert.Equal(t, fingerprints[0], fingerprints[3], "identical texts have identical fingerprints")
+	assert.GreaterOrEqual(t, fingerprints[0].Similarity(fingerprints[1]), 0.9)
+	assert.Less(t, fingerprints[0].Similarity(fingerprints[2]), 0.8)
+	assert.Equal(t, 1.0, fingerprints[0].Similarity(fingerprints[0]))
+
+	index := simhash.NewIndex(0.9)
+	assert.Equal(t, 0, index.Add(fingerprints[0]))
+	assert.Equal(t, 1, index.Add(fingerprints[2]))
+	id, similarity, ok := index.Nearest(fingerprints[1])
+	require.True(t, ok)
+	assert.Equal(t, 0, id)
+	assert.Equal(t, fingerprints[0].Similarity(fingerprints[1]), similarity)
+	_, _, ok = index.Nearest(simhash.Of(article(3, 200)))
+	assert.False(t, ok)
+	assert.Equal(t, 2, index.Len())
+
+	// A fingerprint one bit off is found in every band layout, including the exact-match one
+	for _, threshold := range []float64{1, 0.98, 0.9, 0.5} {
+		index := simhash.NewIndex(threshold)
+		index.Add(fingerprints[0])
+		_, _, ok := index.Nearest(fingerprints[0] ^ 1<<63)
+		assert.Equal(t, threshold < 1, ok, threshold)
+	}
+}
+
+func TestWordProcessor_NearDuplicates(t *testing.T) {
+	bankFile := filepath.Join(t.TempDir(), "words.txt")
+	require.NoError(t, os.WriteFile(bankFile, []byte("apple\n"), 0644))
+	wb := wordbank.NewWordBank(bankFile)
+	essays := nearDuplicateEssays()
+
+	process := func(options processor.NearDuplicates) (int, int, *models.NearDuplicateReport) {
+		essayStream := make(chan models.Essay, len(essays))
+		errorChan := make(chan error)
+		for _, e := range essays {
+			essayStream <- e
+		}
+		close(essayStream)
+		close(errorChan)
+
+		wp := processor.NewWordProcessorWithOptions(wb, processor.Options{NearDuplicates: options})
+		topWords, totalEssays, _ := wp.ProcessEssayStream(context.Background(), essayStream, errorChan, 1)
+		count := 0
+		if len(topWords) > 0 {
+			count = topWords[0].Count
+		}
+		return count, totalEssays, wp.NearDuplicateReport()
+	}
+	apples := make([]int, len(essays))
+	for i, e := range essays {
+		apples[i] = len(slices.DeleteFunc(strings.Fields(e.Content), func(w string) bool { return w != "apple" }))
+	}
+	require.Positive(t, apples[0])
+
+	count, _, report := process(processor.NearDuplicates{})
+	assert.Equal(t, apples[0]+apples[1]+apples[2]+apples[3], count)
+	assert.Nil(t, report, "detection is off by default")
+
+	count, totalEssays, report := process(processor.NearDuplicates{Mode: processor.NearDuplicatesReport, Threshold: 0.9})
+	assert.Equal(t, apples[0]+apples[1]+apples[2]+apples[3], count, "report mode counts everything")
+	assert.Equal(t, len(essays), totalEssays)
+	require.NotNil(t, report)
+	assert.Equal(t, processor.NearDuplicatesReport, report.Mode)
+	assert.Equal(t, 2, report.Total)
+	require.Len(t, report.Clusters, 1)
+	cluster := report.Clusters[0]
+	assert.Equal(t, "https://example.com/original", cluster.URL)
+	require.Len(t, cluster.Duplicates, 2)
+	assert.Equal(t, "https://example.com/syndicated", cluster.Duplicates[0].URL)
+	assert.GreaterOrEqual(t, cluster.Duplicates[0].Similarity, 0.9)
+	assert.Less(t, cluster.Duplicates[0].Similarity, 1.0)
+	assert.Equal(t, models.NearDuplicate{URL: "https://example.com/copy", Similarity: 1}, cluster.Duplicates[1])
+
+	count, totalEssays, report = process(processor.NearDuplicates{Mode: processor.NearDuplicatesDrop, Threshold: 0.9})
+	assert.Equal(t, apples[0]+apples[2], count, "near-duplicates are not counted")
+	assert.Equal(t, len(essays)-2, totalEssays, "nor are they in the total")
+	assert.Equal(t, 2, report.Total)
+
+	count, totalEssays, _ = process(processor.NearDuplicates{Mode: processor.NearDuplicatesDownweight, Threshold: 0.9, Weight: 0.5})
+	assert.Equal(t, apples[0]+apples[2]+int(math.Round(float64(apples[1]+apples[3])*0.5)), count)
+	assert.Equal(t, len(essays), totalEssays)
+
+	// Fractional shares add up across near-duplicates and are rounded once, not per essay
+	count, _, _ = process(processor.NearDuplicates{Mode: processor.NearDuplicatesDownweight, Threshold: 0.9, Weight: 0.1})
+	assert.Equal(t, apples[0]+apples[2]+int(math.Round(float64(apples[1]+apples[3])*0.1)), count)
+
+	// At a threshold of 1 only the exact copy is a near-duplicate
+	_, _, report = process(processor.NearDuplicates{Mode: processor.NearDuplicatesReport, Threshold: 1})
+	assert.Equal(t, 1, report.Total)
+	assert.Equal(t, "https://example.com/copy", report.Clusters[0].Duplicates[0].URL)
+}
+
+func TestConfig_NearDuplicates(t *testing.T) {
+	cfg, err := loadConfig(t)
+	require.NoError(t, err)
+	assert.Equal(t, processor.NearDuplicates{Mode: processor.NearDuplicatesOff, Threshold: 0.9, Weight: 0.5}, cfg.NearDuplicateOptions())
+
+	cfg, err = loadConfig(t, "-near-duplicates", "downweight", "-near-duplicate-threshold", "0.85", "-near-duplicate-weight", "0.25")
+	require.NoError(t, err)
+	assert.Equal(t, processor.NearDuplicates{Mode: processor.NearDuplicatesDownweight, Threshold: 0.85, Weight: 0.25}, cfg.NearDuplicateOptions())
+
+	_, err = loadConfig(t, "-near-duplicates", "merge", "-near-duplicate-threshold", "0.2", "-near-duplicate-weight", "2")
+	assert.ErrorContains(t, err, `near duplicates must be one of off, report, drop, downweight, got "merge"`)
+	assert.ErrorContains(t, err, "near-duplicate threshold must be between 0.5 and 1")
+	assert.ErrorContains(t, err, "near-duplicate weight must be between 0 and 1")
+
+	_, err = loadConfig(t, "-near-duplicate-threshold", "high")
+	assert.ErrorContains(t, err, `"high" is not a number`)
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("near_duplicates: drop\nnear_duplicate_threshold: 0.95\nnear_duplicate_weight: 1\n"), 0644))
+	cfg, err = loadConfig(t, "-config", configFile)
+	require.NoError(t, err)
+	assert.Equal(t, processor.NearDuplicates{Mode: processor.NearDuplicatesDrop, Threshold: 0.95, Weight: 1}, cfg.NearDuplicateOptions())
+
+	require.NoError(t, os.WriteFile(configFile, []byte("top_words_count: 2.5\n"), 0644))
+	_, err = loadConfig(t, "-config", configFile)
+	assert.ErrorContains(t, err, `"2.5" is not an integer`)
+
+	tomlFile := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(tomlFile, []byte("near_duplicates = \"report\"\nnear_duplicate_threshold = 0.8\nnear_duplicate_weight = 1.0\n"), 0644))
+	cfg, err = loadConfig(t, "-config", tomlFile)
+	require.NoError(t, err)
+	assert.Equal(t, processor.NearDuplicates{Mode: processor.NearDuplicatesReport, Threshold: 0.8, Weight: 1}, cfg.NearDuplicateOptions())
+
+	require.NoError(t, os.WriteFile(tomlFile, []byte("top_words_count = 2.5\n"), 0644))
+	_, err = loadConfig(t, "-config", tomlFile)
+	assert.ErrorContains(t, err, `"2.5" is not an integer`)
+	require.NoError(t, os.WriteFile(tomlFile, []byte("near_duplicate_threshold = high\n"), 0644))
+	_, err = loadConfig(t, "-config", tomlFile)
+	assert.ErrorContains(t, err, `value for "near_duplicate_threshold" must be a quoted string, a number or a boolean`)
+}
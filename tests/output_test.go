@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testOutput() models.Output {
+	return models.Output{
+		TopWords: []models.WordCount{
+			{Word: "apple", Count: 10, Banks: []string{"fruit"}},
+			{Word: "rust", Count: 5, Banks: []string{"tech"}},
+		},
+		ByBank: map[string][]models.WordCount{
+			"tech":  {{Word: "rust", Count: 5, Banks: []string{"tech"}}},
+			"fruit": {{Word: "apple", Count: 10, Banks: []string{"fruit"}}},
+		},
+		TotalEssays:      8,
+		TotalErrors:      2,
+		ErrorsByCategory: map[string]int{"not_found": 1, "timeout": 1},
+		Timestamp:        time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC),
+	}
+}
+
+func writeTestOutput(t *testing.T, format output.Format) string {
+	var buf bytes.Buffer
+	require.NoError(t, output.NewWriter(format).Write(&buf, testOutput()))
+	return buf.String()
+}
+
+func TestOutput_ParseFormat(t *testing.T) {
+	format, err := output.ParseFormat("")
+	assert.NoError(t, err)
+	assert.Equal(t, output.FormatJSON, format)
+
+	format, err = output.ParseFormat("Markdown")
+	assert.NoError(t, err)
+	assert.Equal(t, output.FormatMarkdown, format)
+
+	_, err = output.ParseFormat("xml")
+	assert.Error(t, err)
+}
+
+func TestOutput_JSON(t *testing.T) {
+	var decoded models.Output
+	require.NoError(t, json.Unmarshal([]byte(writeTestOutput(t, output.FormatJSON)), &decoded))
+	assert.Equal(t, testOutput(), decoded)
+}
+
+func TestOutput_CSV(t *testing.T) {
+	records, err := csv.NewReader(strings.NewReader(writeTestOutput(t, output.FormatCSV))).ReadAll()
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{
+		{"list", "rank", "word", "count", "score", "banks"},
+		{"top", "1", "apple", "10", "", "fruit"},
+		{"top", "2", "rust", "5", "", "tech"},
+		{"fruit", "1", "apple", "10", "", "fruit"},
+		{"tech", "1", "rust", "5", "", "tech"},
+	}, records)
+}
+
+func TestOutput_NDJSON(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(writeTestOutput(t, output.FormatNDJSON)), "\n")
+	require.Len(t, lines, 4)
+	assert.JSONEq(t, `{"list":"top","rank":1,"word":"apple","count":10,"banks":["fruit"]}`, lines[0])
+	assert.JSONEq(t, `{"list":"tech","rank":1,"word":"rust","count":5,"banks":["tech"]}`, lines[3])
+}
+
+func TestOutput_Markdown(t *testing.T) {
+	md := writeTestOutput(t, output.FormatMarkdown)
+
+	assert.Contains(t, md, "8 essays, 2 errors")
+	assert.Contains(t, md, "| Rank | Word | Count | Banks |")
+	assert.Contains(t, md, "| 1 | apple | 10 | fruit |")
+	assert.Contains(t, md, "## tech")
+	assert.Contains(t, md, "## Errors by category\n\n| Category | Errors |\n|----------|-------:|\n| not\\_found | 1 |\n| timeout | 1 |\n")
+	assert.NotContains(t, md, "Score")
+}
+
+func TestOutput_HTML(t *testing.T) {
+	out := writeTestOutput(t, output.FormatHTML)
+
+	assert.True(t, strings.HasPrefix(out, "<!DOCTYPE html>"))
+	assert.Contains(t, out, "20.0%", "error rate over all attempted essays")
+	assert.Contains(t, out, "width: 100.0%")
+	assert.Contains(t, out, "width: 50.0%")
+	assert.Contains(t, out, "Bank: tech")
+	assert.Contains(t, out, "<tr><td>not_found</td><td class=\"num\">1</td></tr>")
+	assert.NotContains(t, out, "<script", "report is self-contained")
+	assert.NotContains(t, out, "http", "report loads no external assets")
+}
+
+func TestOutput_HTMLEscapesWords(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, output.NewWriter(output.FormatHTML).Write(&buf, models.Output{
+		TopWords: []models.WordCount{{Word: "<b>bold</b>", Count: 1}},
+	}))
+	assert.NotContains(t, buf.String(), "<b>bold</b>")
+}
@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"github.com/ireuven89/firefly-itzik/internal/essay"
+	"github.com/ireuven89/firefly-itzik/internal/httpfixture"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/output"
+	"github.com/ireuven89/firefly-itzik/internal/processor"
+	"github.com/ireuven89/firefly-itzik/internal/rateLimiter"
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of the pipeline tests")
+
+// runPipeline fetches the essays file through the configured fetcher, counts the words and returns the
+// output as the run command builds it, stamped with a fixed time
+func runPipeline(t *testing.T, args ...string) models.Output {
+	cfg, err := loadConfig(t, args...)
+	require.NoError(t, err)
+	fetchOptions, err := cfg.FetchOptions()
+	require.NoError(t, err)
+
+	fetcher := essay.NewEssayFetcherWithOptions(rateLimiter.NewRateLimiter(cfg.RateLimit, time.Second), cfg.EssaysFile, cfg.MaxHTTPWorkers, cfg.HTTPRetryDelay, logging.Discard(), nil, fetchOptions)
+	wp := processor.NewWordProcessorWithOptions(wordbank.NewWordBankWithBackend(cfg.WordBankFile, wordbank.BackendMap, logging.Discard()), processor.Options{
+		NearDuplicates: cfg.NearDuplicateOptions(),
+		Logger:         logging.Discard(),
+	})
+
+	essayStream := make(chan models.Essay, cfg.EssayStreamBuffer)
+	errorChan := make(chan error, cfg.ErrorChannelBuffer)
+	go func() {
+		defer close(essayStream)
+		defer close(errorChan)
+		assert.NoError(t, fetcher.StreamEssays(context.Background(), essayStream, errorChan))
+	}()
+
+	topWords, totalEssays, totalErrors := wp.ProcessEssayStream(context.Background(), essayStream, errorChan, cfg.TopWordsCount)
+	return models.Output{
+		TopWords:         topWords,
+		TotalEssays:      totalEssays,
+		TotalErrors:      totalErrors,
+		ErrorsByCategory: wp.FailureReport().ByCategory,
+		Duplicates:       fetcher.Duplicates(),
+		NearDuplicates:   wp.NearDuplicateReport(),
+		Timestamp:        time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC),
+	}
+}
+
+// assertGolden compares got with testdata/golden/name, rewriting it instead with -update
+func assertGolden(t *testing.T, name string, got []byte) {
+	path := filepath.Join("testdata", "golden", name)
+	if *updateGolden {
+		require.NoError(t, os.WriteFile(path, got, 0644))
+		return
+	}
+	want, err := os.ReadFile(path)
+	require.NoError(t, err, "run go test ./tests -run Pipeline -update to create it")
+	assert.Equal(t, string(want), string(got), "run go test ./tests -run Pipeline -update after intended changes")
+}
+
+func TestPipeline_GoldenReplay(t *testing.T) {
+	// One worker fetches in file order, so deduplication and near-duplicate clusters are deterministic
+	result := runPipeline(t,
+		"-essays-file", "testdata/pipeline-urls",
+		"-wordbank-file", "testdata/pipeline-words.txt",
+		"-fixtures", "replay", "-fixtures-dir", "testdata/fixtures",
+		"-max-http-workers", "1", "-http-retry-delay", "1ms",
+		"-near-duplicates", "report",
+	)
+
+	assert.Equal(t, 4, result.TotalEssays)
+	assert.Equal(t, map[string]int{"not_found": 1, "robots_disallowed": 1, "connection": 1}, result.ErrorsByCategory)
+	assert.Equal(t, &models.DuplicateReport{URLs: 1, Canonical: 1}, result.Duplicates)
+
+	for format, name := range map[output.Format]string{output.FormatJSON: "pipeline.json", output.FormatMarkdown: "pipeline.md"} {
+		var buf bytes.Buffer
+		require.NoError(t, output.NewWriter(format).Write(&buf, result))
+		assertGolden(t, name, buf.Bytes())
+	}
+
+	// Replaying again gives the same output
+	assert.Equal(t, result, runPipeline(t,
+		"-essays-file", "testdata/pipeline-urls",
+		"-wordbank-file", "testdata/pipeline-words.txt",
+		"-fixtures", "replay", "-fixtures-dir", "testdata/fixtures",
+		"-max-http-workers", "1", "-http-retry-delay", "1ms",
+		"-near-duplicates", "report",
+	))
+}
+
+func TestHTTPFixture_RecordThenReplay(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.WriteHeader(http.StatusNotFound)
+		case "/old":
+			http.Redirect(w, r, "/article?id=1", http.StatusMovedPermanently)
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, `<html><title>Recorded</title><div class="article-body"><p>battery camera `+r.URL.Query().Get("id")+`</p></div></body></html>`)
+		}
+	}))
+
+	dir := filepath.Join(t.TempDir(), "fixtures")
+	urlsFile := filepath.Join(t.TempDir(), "urls")
+	require.NoError(t, os.WriteFile(urlsFile, []byte(origin.URL+"/old\n"+origin.URL+"/article?id=2\n"), 0644))
+	args := []string{"-essays-file", urlsFile, "-wordbank-file", "testdata/pipeline-words.txt", "-fixtures-dir", dir, "-http-retry-delay", "1ms"}
+
+	recorded := runPipeline(t, append(args, "-fixtures", "record")...)
+	assert.Equal(t, 2, recorded.TotalEssays)
+	fixtures, err := httpfixture.Load(dir)
+	require.NoError(t, err)
+	assert.Len(t, fixtures, 4, "robots.txt, the redirect, and both articles")
+	for _, f := range fixtures {
+		assert.Empty(t, f.Header.Get("Date"), "volatile headers are not recorded")
+	}
+
+	// The origin is gone, so everything comes from the fixtures
+	origin.Close()
+	assert.Equal(t, recorded, runPipeline(t, append(args, "-fixtures", "replay")...))
+
+	replayer, err := httpfixture.NewReplayer(dir)
+	require.NoError(t, err)
+	_, err = replayer.RoundTrip(httptest.NewRequest(http.MethodGet, origin.URL+"/unrecorded", nil))
+	assert.ErrorIs(t, err, httpfixture.ErrNoFixture)
+
+	// Non-UTF-8 bodies are stored as base64 and replayed byte for byte
+	require.NoError(t, httpfixture.Write(dir, httpfixture.Fixture{Method: http.MethodGet, URL: origin.URL + "/binary", Status: http.StatusOK, Body: "//4A", Base64: true}))
+	replayer, err = httpfixture.NewReplayer(dir)
+	require.NoError(t, err)
+	resp, err := replayer.RoundTrip(httptest.NewRequest(http.MethodGet, origin.URL+"/binary", nil))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, []byte{0xff, 0xfe, 0x00}, body)
+
+	// The server replays one host's fixtures over real HTTP
+	server, err := replayer.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+	resp, err = http.Get(server.URL + "/article?id=2")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ = io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "battery camera 2")
+	resp, err = http.Get(server.URL + "/unrecorded")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+
+	_, err = loadConfig(t, "-fixtures", "replay")
+	assert.ErrorContains(t, err, "fixtures directory cannot be empty")
+	_, err = loadConfig(t, "-fixtures", "live")
+	assert.ErrorContains(t, err, `fixtures mode must be one of off, record, replay, got "live"`)
+	cfg, err := loadConfig(t, "-fixtures", "replay", "-fixtures-dir", filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	_, err = cfg.FetchOptions()
+	assert.ErrorContains(t, err, "failed to load fixtures")
+}
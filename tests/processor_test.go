@@ -1,11 +1,19 @@
 package tests
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/processor"
 	"github.com/ireuven89/firefly-itzik/internal/wordbank"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestWordBank_LoadFromFile(t *testing.T) {
@@ -81,3 +89,99 @@ func TestWordBank_CaseInsensitive(t *testing.T) {
 	assert.True(t, wb.Contains("world"))
 	assert.True(t, wb.Contains("test"))
 }
+
+func TestWordProcessor_Snapshot(t *testing.T) {
+	testFile := "snapshot_wordbank.txt"
+	err := os.WriteFile(testFile, []byte("apple\nbanana\ncherry"), 0644)
+	assert.NoError(t, err)
+	defer os.Remove(testFile)
+
+	wp := processor.NewWordProcessor(wordbank.NewWordBank(testFile))
+
+	// Snapshot before any processing is empty
+	snapshot := wp.Snapshot()
+	assert.Empty(t, snapshot.TopWords)
+	assert.Equal(t, 0, snapshot.TotalEssays)
+
+	essayStream := make(chan models.Essay, 3)
+	errorChan := make(chan error, 1)
+	essayStream <- models.Essay{Content: "apple banana apple"}
+	essayStream <- models.Essay{Content: "cherry apple unknown"}
+	errorChan <- errors.New("fetch failed")
+	close(essayStream)
+	close(errorChan)
+
+	topWords, totalEssays, totalErrors := wp.ProcessEssayStream(context.Background(), essayStream, errorChan, 2)
+
+	snapshot = wp.Snapshot()
+	assert.Equal(t, topWords, snapshot.TopWords)
+	assert.Equal(t, totalEssays, snapshot.TotalEssays)
+	assert.Equal(t, totalErrors, snapshot.TotalErrors)
+	assert.Equal(t, 3, snapshot.UniqueWords)
+	assert.Equal(t, []models.WordCount{{Word: "apple", Count: 3}, {Word: "banana", Count: 1}}, snapshot.TopWords)
+
+	// Full result keeps every word plus document frequencies
+	result := wp.Result()
+	assert.Equal(t, map[string]int{"apple": 3, "banana": 1, "cherry": 1}, result.WordCounts)
+	assert.Equal(t, map[string]int{"apple": 2, "banana": 1, "cherry": 1}, result.DocFrequencies)
+	assert.Equal(t, 1, result.TotalErrors)
+}
+
+func TestWriteSnapshots_NDJSON(t *testing.T) {
+	testFile := "ndjson_wordbank.txt"
+	err := os.WriteFile(testFile, []byte("apple"), 0644)
+	assert.NoError(t, err)
+	defer os.Remove(testFile)
+
+	wp := processor.NewWordProcessor(wordbank.NewWordBank(testFile))
+
+	var buf bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err = processor.WriteSnapshots(ctx, wp, &buf, 10*time.Millisecond)
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.GreaterOrEqual(t, len(lines), 2)
+	for _, line := range lines {
+		var snapshot models.Snapshot
+		assert.NoError(t, json.Unmarshal([]byte(line), &snapshot))
+	}
+
+	assert.Error(t, processor.WriteSnapshots(context.Background(), wp, &buf, 0))
+}
+
+func TestWordProcessor_OOVReport(t *testing.T) {
+	bankFile := filepath.Join(t.TempDir(), "words.tsv")
+	assert.NoError(t, os.WriteFile(bankFile, []byte("apple\tnoun\nrun\tverb\n"), 0644))
+	wb := wordbank.NewWordBank(bankFile)
+
+	essayStream := make(chan models.Essay, 2)
+	errorChan := make(chan error)
+	essayStream <- models.Essay{Content: "An apple and the Zorblax ran to run"}
+	essayStream <- models.Essay{Content: "zorblax is the apple of zorblax"}
+	close(essayStream)
+	close(errorChan)
+
+	wp := processor.NewWordProcessorWithOptions(wb, processor.Options{POS: []string{"noun"}, TrackRejected: true})
+	topWords, _, _ := wp.ProcessEssayStream(context.Background(), essayStream, errorChan, 10)
+	assert.Equal(t, []models.WordCount{{Word: "apple", Count: 2}}, topWords)
+
+	report := wp.OOVReport(3)
+	assert.Equal(t, 12, report.TotalRejected)
+	assert.Equal(t, map[string]int{
+		processor.ReasonTooShort:  4, // an, to, is, of
+		processor.ReasonStopword:  3, // and, the, the
+		processor.ReasonNotInBank: 4, // zorblax x3, ran
+		processor.ReasonFiltered:  1, // run is a verb
+	}, report.ByReason)
+	assert.Equal(t, []models.RejectedToken{
+		{Token: "zorblax", Count: 3, Reason: processor.ReasonNotInBank},
+		{Token: "the", Count: 2, Reason: processor.ReasonStopword},
+		{Token: "an", Count: 1, Reason: processor.ReasonTooShort},
+	}, report.TopTokens)
+
+	// Without tracking the report stays empty
+	assert.Zero(t, processor.NewWordProcessor(wb).OOVReport(3).TotalRejected)
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/results"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResults_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.json.gz")
+
+	r := results.NewResult()
+	r.WordCounts["apple"] = 5
+	r.DocFrequencies["apple"] = 2
+	r.TotalEssays = 2
+	r.TotalErrors = 1
+
+	assert.NoError(t, results.Save(path, r))
+
+	loaded, err := results.Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, results.FormatVersion, loaded.Version)
+	assert.Equal(t, r.WordCounts, loaded.WordCounts)
+	assert.Equal(t, r.DocFrequencies, loaded.DocFrequencies)
+	assert.Equal(t, 2, loaded.TotalEssays)
+	assert.Equal(t, 1, loaded.TotalErrors)
+}
+
+func TestResults_MergeIsExact(t *testing.T) {
+	// "cherry" is never in either part's top 1 but wins once merged
+	a := results.NewResult()
+	a.WordCounts = map[string]int{"apple": 5, "cherry": 4}
+	a.DocFrequencies = map[string]int{"apple": 1, "cherry": 2}
+	a.TotalEssays = 2
+
+	b := results.NewResult()
+	b.WordCounts = map[string]int{"banana": 6, "cherry": 4}
+	b.DocFrequencies = map[string]int{"banana": 3, "cherry": 1}
+	b.TotalEssays = 3
+	b.TotalErrors = 2
+
+	merged := results.Merge(a, b)
+
+	assert.Equal(t, []models.WordCount{{Word: "cherry", Count: 8}, {Word: "banana", Count: 6}}, merged.TopWords(2))
+	assert.Equal(t, 3, merged.DocFrequencies["cherry"])
+	assert.Equal(t, 5, merged.TotalEssays)
+	assert.Equal(t, 2, merged.TotalErrors)
+}
+
+func TestResults_LoadRejectsUnknownVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "future.json.gz")
+
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	gz := gzip.NewWriter(file)
+	assert.NoError(t, json.NewEncoder(gz).Encode(map[string]int{"version": results.FormatVersion + 1}))
+	assert.NoError(t, gz.Close())
+	assert.NoError(t, file.Close())
+
+	_, err = results.Load(path)
+	assert.ErrorContains(t, err, "unsupported version")
+}
+
+func TestResults_LoadUpgradesOlderVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "v1.json.gz")
+
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	gz := gzip.NewWriter(file)
+	assert.NoError(t, json.NewEncoder(gz).Encode(map[string]any{"version": 1, "word_counts": map[string]int{"apple": 2}, "total_errors": 1}))
+	assert.NoError(t, gz.Close())
+	assert.NoError(t, file.Close())
+
+	loaded, err := results.Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, results.FormatVersion, loaded.Version)
+	assert.Equal(t, 2, loaded.WordCounts["apple"])
+	assert.Equal(t, 1, loaded.TotalErrors)
+	assert.Nil(t, loaded.ErrorsByCategory)
+}
+
+func TestResults_LoadRejectsPlainJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plain.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"version":1}`), 0644))
+
+	_, err := results.Load(path)
+	assert.Error(t, err)
+}
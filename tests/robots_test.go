@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"context"
+	"github.com/ireuven89/firefly-itzik/internal/essay"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/rateLimiter"
+	"github.com/ireuven89/firefly-itzik/internal/robots"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const robotsFile = `# comments and unknown lines are ignored
+Sitemap: https://example.com/sitemap.xml
+
+User-agent: *
+Disallow: /
+
+User-agent: Firefly-Itzik
+User-agent: other-bot
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search?
+Allow: /tie
+Disallow: /tie
+Crawl-delay: 1.5
+
+User-agent: firefly-itzik
+Disallow: /drafts/
+`
+
+func allowed(t *testing.T, rules *robots.Rules, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	ok, _ := rules.Allowed(u)
+	return ok
+}
+
+func TestRobots_Parse(t *testing.T) {
+	rules := robots.Parse(strings.NewReader(robotsFile), "firefly-itzik/1.0 (+https://example.com)")
+	assert.Equal(t, 1500*time.Millisecond, rules.CrawlDelay)
+
+	for rawURL, want := range map[string]bool{
+		"https://example.com/":                    true,
+		"https://example.com/2019/08/article":     true,
+		"https://example.com/private":             false,
+		"https://example.com/private/notes":       false,
+		"https://example.com/private/public/page": true,
+		"https://example.com/report.pdf":          false,
+		"https://example.com/report.pdf?x=1":      true,
+		"https://example.com/search?q=tech":       false,
+		"https://example.com/searching":           true,
+		"https://example.com/tie":                 true,
+		"https://example.com/drafts/one":          false,
+		"https://example.com/robots.txt":          true,
+	} {
+		assert.Equal(t, want, allowed(t, rules, rawURL), rawURL)
+	}
+
+	u, _ := url.Parse("https://example.com/private/notes")
+	_, rule := rules.Allowed(u)
+	assert.Equal(t, "Disallow: /private", rule.String())
+
+	// Agents without a group of their own fall back to *
+	others := robots.Parse(strings.NewReader(robotsFile), "unknown-bot")
+	assert.False(t, allowed(t, others, "https://example.com/2019/08/article"))
+	assert.Zero(t, others.CrawlDelay)
+
+	assert.True(t, allowed(t, robots.Parse(strings.NewReader(""), "firefly-itzik"), "https://example.com/anything"))
+	assert.Equal(t, robots.MaxCrawlDelay, robots.Parse(strings.NewReader("User-agent: *\nCrawl-delay: 86400\n"), "bot").CrawlDelay)
+}
+
+func TestRobots_CheckerStatusesAndCaching(t *testing.T) {
+	var requests atomic.Int32
+	var userAgent atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		userAgent.Store(r.UserAgent())
+		io.WriteString(w, "User-agent: *\nDisallow: /private\n")
+	}))
+	defer server.Close()
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	checker := robots.NewChecker(http.DefaultClient, "firefly-test/2.0", logging.Discard())
+	rulesFor := func(base string) *robots.Rules {
+		u, err := url.Parse(base + "/private")
+		require.NoError(t, err)
+		rules, err := checker.Rules(context.Background(), u)
+		require.NoError(t, err)
+		return rules
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.False(t, allowed(t, rulesFor(server.URL), server.URL+"/private"))
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, requests.Load(), "robots.txt is fetched once per host")
+	assert.Equal(t, "firefly-test/2.0", userAgent.Load())
+
+	assert.True(t, allowed(t, rulesFor(missing.URL), missing.URL+"/private"), "a 4xx allows everything")
+	assert.False(t, allowed(t, rulesFor(failing.URL), failing.URL+"/article"), "a 5xx disallows everything")
+	assert.False(t, allowed(t, rulesFor(closed.URL), closed.URL+"/article"), "no response disallows everything")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	u, _ := url.Parse("http://unseen.invalid/article")
+	_, err := checker.Rules(ctx, u)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRobots_FetcherSkipsAndSpacesRequests(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	var starts []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			io.WriteString(w, "User-agent: polite-bot\nDisallow: /private\nCrawl-delay: 0.1\n\nUser-agent: *\nDisallow: /\n")
+			return
+		}
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		starts = append(starts, time.Now())
+		mu.Unlock()
+		assert.Equal(t, "polite-bot/1.0", r.UserAgent())
+		io.WriteString(w, `<html><title>Robots</title><div class="article-body"><p>apple</p></div></body></html>`)
+	}))
+	defer server.Close()
+
+	options := essay.DefaultOptions()
+	options.UserAgent = "polite-bot/1.0"
+	options.Robots = true
+	fetcher := essay.NewEssayFetcherWithOptions(rateLimiter.NewRateLimiter(1000, time.Second), "", 4, time.Millisecond, logging.Discard(), nil, options)
+
+	urls := []string{server.URL + "/a", server.URL + "/private/b", server.URL + "/c", server.URL + "/d"}
+	essayStream := make(chan models.Essay, len(urls))
+	errorChan := make(chan error, len(urls))
+	require.NoError(t, fetcher.StreamURLs(context.Background(), urls, essayStream, errorChan))
+	close(essayStream)
+	close(errorChan)
+
+	assert.Len(t, essayStream, 3)
+	require.Len(t, errorChan, 1)
+	err := <-errorChan
+	assert.ErrorIs(t, err, essay.ErrDisallowed)
+	var fetchErr *essay.FetchError
+	require.ErrorAs(t, err, &fetchErr)
+	assert.Equal(t, server.URL+"/private/b", fetchErr.URL)
+	assert.Equal(t, "robots_disallowed", fetchErr.Category())
+	assert.Contains(t, err.Error(), "Disallow: /private")
+	assert.Empty(t, fetchErr.History, "disallowed URLs are never requested")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.NotContains(t, paths, "/private/b")
+	slices.SortFunc(starts, func(a, b time.Time) int { return a.Compare(b) })
+	for i := 1; i < len(starts); i++ {
+		assert.GreaterOrEqual(t, starts[i].Sub(starts[i-1]), 90*time.Millisecond, "requests are spaced by Crawl-delay")
+	}
+}
+
+func TestHostLimiter_SpacesEachHost(t *testing.T) {
+	limiter := rateLimiter.NewHostLimiter()
+	ctx := context.Background()
+
+	start := time.Now()
+	require.NoError(t, limiter.Wait(ctx, "a.example", 50*time.Millisecond))
+	require.NoError(t, limiter.Wait(ctx, "b.example", 50*time.Millisecond))
+	assert.Less(t, time.Since(start), 40*time.Millisecond, "hosts do not wait for each other")
+
+	require.NoError(t, limiter.Wait(ctx, "a.example", 50*time.Millisecond))
+	assert.GreaterOrEqual(t, time.Since(start), 45*time.Millisecond)
+	require.NoError(t, limiter.Wait(ctx, "a.example", 0), "no delay never waits")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, limiter.Wait(canceled, "a.example", time.Second), context.Canceled)
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/processor"
+	"github.com/ireuven89/firefly-itzik/internal/runstore"
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordTestRun processes essays through a processor wired to a new run of st
+func recordTestRun(t *testing.T, st runstore.Store, essays []models.Essay, errs []error) runstore.Recorder {
+	recorder, err := st.NewRun()
+	require.NoError(t, err)
+
+	bankFile := filepath.Join(t.TempDir(), "words.txt")
+	require.NoError(t, os.WriteFile(bankFile, []byte("apple\nbanana\ncherry\n"), 0644))
+
+	wp := processor.NewWordProcessorWithOptions(wordbank.NewWordBank(bankFile), processor.Options{
+		OnEssay: recorder.RecordEssay,
+		OnError: recorder.RecordError,
+	})
+
+	essayStream := make(chan models.Essay, len(essays))
+	errorChan := make(chan error, len(errs))
+	for _, e := range essays {
+		essayStream <- e
+	}
+	for _, err := range errs {
+		errorChan <- err
+	}
+	close(essayStream)
+	close(errorChan)
+
+	_, totalEssays, totalErrors := wp.ProcessEssayStream(context.Background(), essayStream, errorChan, 10)
+	require.NoError(t, recorder.Close(totalEssays, totalErrors))
+	return recorder
+}
+
+func TestRunStore_RecordAndQuery(t *testing.T) {
+	st, err := runstore.Open(t.TempDir())
+	require.NoError(t, err)
+
+	first := recordTestRun(t, st, []models.Essay{
+		{ID: 1, URL: "http://a", Title: "A", Content: "apple apple banana"},
+		{ID: 2, URL: "http://b", Title: "B", Content: "cherry"},
+	}, []error{errors.New("fetch http://c: status 500")})
+	recordTestRun(t, st, []models.Essay{
+		{ID: 3, URL: "http://d", Title: "D", Content: "banana banana"},
+	}, nil)
+
+	runs, err := st.Runs()
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	assert.Equal(t, first.ID(), runs[0].ID)
+	assert.True(t, runs[0].Complete)
+	assert.Equal(t, 2, runs[0].TotalEssays)
+	assert.Equal(t, 1, runs[0].TotalErrors)
+
+	top, essays, err := st.TopWords(runstore.Filter{}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, essays)
+	assert.Equal(t, []models.WordCount{{Word: "banana", Count: 3}, {Word: "apple", Count: 2}}, top)
+
+	top, essays, err = st.TopWords(runstore.Filter{RunID: first.ID()}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, essays)
+	assert.Equal(t, []models.WordCount{{Word: "apple", Count: 2}}, top)
+
+	withBanana, err := st.Essays(runstore.Filter{}, "Banana")
+	require.NoError(t, err)
+	require.Len(t, withBanana, 2)
+	assert.Equal(t, "http://a", withBanana[0].URL)
+	assert.Equal(t, map[string]int{"banana": 1}, withBanana[0].Counts)
+	assert.Equal(t, "http://d", withBanana[1].URL)
+
+	errs, err := st.Errors(runstore.Filter{})
+	require.NoError(t, err)
+	require.Len(t, errs, 1)
+	assert.Equal(t, first.ID(), errs[0].RunID)
+	assert.Contains(t, errs[0].Message, "status 500")
+
+	_, _, err = st.TopWords(runstore.Filter{RunID: "../store"}, 1)
+	assert.Error(t, err)
+}
+
+func TestRunStore_DateFilter(t *testing.T) {
+	st, err := runstore.Open(t.TempDir())
+	require.NoError(t, err)
+	recordTestRun(t, st, []models.Essay{{ID: 1, Content: "apple"}}, nil)
+
+	_, essays, err := st.TopWords(runstore.Filter{From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, essays)
+
+	_, essays, err = st.TopWords(runstore.Filter{To: time.Now().Add(-time.Hour)}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 0, essays)
+}
+
+func TestRunStore_IncompleteRun(t *testing.T) {
+	dir := t.TempDir()
+	st, err := runstore.Open(dir)
+	require.NoError(t, err)
+	recorder := recordTestRun(t, st, []models.Essay{{ID: 1, Content: "apple"}}, nil)
+
+	// Simulate a run killed mid-write: no end record and a torn last line
+	path := filepath.Join(dir, "runs", recorder.ID()+".ndjson")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+	require.NoError(t, os.WriteFile(path, []byte(lines[0]+"\n"+lines[1]+"\n"+`{"type":"ess`), 0644))
+
+	runs, err := st.Runs()
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.False(t, runs[0].Complete)
+	assert.Nil(t, runs[0].FinishedAt)
+	assert.Equal(t, 1, runs[0].TotalEssays)
+}
+
+func TestRunStore_AbortedRun(t *testing.T) {
+	st, err := runstore.Open(t.TempDir())
+	require.NoError(t, err)
+	recorder, err := st.NewRun()
+	require.NoError(t, err)
+	recorder.RecordError(errors.New("essay source failed"))
+	require.NoError(t, recorder.Abort())
+
+	runs, err := st.Runs()
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.False(t, runs[0].Complete, "a failed run has no end record")
+	assert.Nil(t, runs[0].FinishedAt)
+	assert.Equal(t, 1, runs[0].TotalErrors)
+}
+
+func TestRunStore_RefusesNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "store.json"), []byte(`{"schema_version": 99}`), 0644))
+
+	_, err := runstore.Open(dir)
+	assert.ErrorIs(t, err, runstore.ErrNewerSchema)
+}
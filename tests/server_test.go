@@ -0,0 +1,178 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/config"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/server"
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestJobServer(t *testing.T, dataDir string) (server.JobManager, *httptest.Server) {
+	bankFile := filepath.Join(t.TempDir(), "words.txt")
+	assert.NoError(t, os.WriteFile(bankFile, []byte("apple\nbanana"), 0644))
+
+	cfg := &config.Config{
+		TopWordsCount:      10,
+		ProcessTimeout:     time.Minute,
+		RateLimit:          1000,
+		EssayStreamBuffer:  10,
+		ErrorChannelBuffer: 10,
+		MaxHTTPWorkers:     4,
+		HTTPRetryDelay:     time.Millisecond,
+	}
+
+	jm, err := server.NewJobManager(cfg, wordbank.NewWordBank(bankFile), dataDir, logging.Discard(), nil)
+	assert.NoError(t, err)
+
+	api := httptest.NewServer(server.NewHandler(jm))
+	t.Cleanup(api.Close)
+	return jm, api
+}
+
+func TestServer_JobLifecycleAndPersistence(t *testing.T) {
+	articles := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<div class="article-body"><p>apple banana apple</p></div>`)
+	}))
+	defer articles.Close()
+
+	dataDir := t.TempDir()
+	jm, api := newTestJobServer(t, dataDir)
+
+	resp := postJSON(t, api.URL+"/jobs", server.JobRequest{
+		URLs:    []string{articles.URL + "/1", articles.URL + "/2"},
+		Options: server.JobOptions{TopWords: 1},
+	})
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	var job server.Job
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&job))
+	assert.Equal(t, server.JobRunning, job.Status)
+	assert.Equal(t, 2, job.URLCount)
+
+	// Result is not available until the job finishes
+	assert.Eventually(t, func() bool {
+		got, err := jm.Get(job.ID)
+		return err == nil && got.Status == server.JobCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	resultResp, err := http.Get(api.URL + "/jobs/" + job.ID + "/result")
+	assert.NoError(t, err)
+	defer resultResp.Body.Close()
+	assert.Equal(t, http.StatusOK, resultResp.StatusCode)
+
+	var output models.Output
+	assert.NoError(t, json.NewDecoder(resultResp.Body).Decode(&output))
+	assert.Equal(t, 2, output.TotalEssays)
+	assert.Equal(t, []models.WordCount{{Word: "apple", Count: 4}}, output.TopWords)
+
+	// A restarted server still knows the finished job
+	restarted, _ := newTestJobServer(t, dataDir)
+	reloaded, err := restarted.Get(job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, server.JobCompleted, reloaded.Status)
+	assert.Equal(t, output.TopWords, reloaded.Output.TopWords)
+	assert.FileExists(t, filepath.Join(dataDir, job.ID+".result.json.gz"))
+}
+
+func TestServer_JobFromSources(t *testing.T) {
+	var articles *httptest.Server
+	articles = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sitemap.xml" {
+			fmt.Fprintf(w, `<urlset><url><loc>%[1]s/1</loc></url><url><loc>%[1]s/2</loc></url></urlset>`, articles.URL)
+			return
+		}
+		fmt.Fprint(w, `<div class="article-body"><p>apple banana apple</p></div>`)
+	}))
+	defer articles.Close()
+
+	jm, _ := newTestJobServer(t, t.TempDir())
+
+	job, err := jm.Submit(server.JobRequest{URLs: []string{articles.URL + "/3"}, Sources: []string{articles.URL + "/sitemap.xml"}})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		job, err = jm.Get(job.ID)
+		return err == nil && job.Status.Finished()
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, server.JobCompleted, job.Status)
+	assert.Equal(t, 3, job.URLCount, "the URLs and the discovered ones")
+	assert.Equal(t, 3, job.Output.TotalEssays)
+
+	// A source that cannot be read fails the job
+	job, err = jm.Submit(server.JobRequest{Sources: []string{"http://127.0.0.1:1/sitemap.xml"}})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		job, err = jm.Get(job.ID)
+		return err == nil && job.Status.Finished()
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, server.JobFailed, job.Status)
+	assert.Contains(t, job.Error, "failed to discover URLs")
+}
+
+func TestServer_CancelJob(t *testing.T) {
+	release := make(chan struct{})
+	articles := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer articles.Close()
+	defer close(release)
+
+	jm, api := newTestJobServer(t, t.TempDir())
+
+	job, err := jm.Submit(server.JobRequest{URLs: []string{articles.URL + "/slow"}})
+	assert.NoError(t, err)
+
+	resp, err := http.Get(api.URL + "/jobs/" + job.ID + "/result")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	req, _ := http.NewRequest(http.MethodDelete, api.URL+"/jobs/"+job.ID, nil)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var canceled server.Job
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&canceled))
+	assert.Equal(t, server.JobCanceled, canceled.Status)
+}
+
+func TestServer_RejectsInvalidJobs(t *testing.T) {
+	_, api := newTestJobServer(t, t.TempDir())
+
+	resp := postJSON(t, api.URL+"/jobs", server.JobRequest{})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = postJSON(t, api.URL+"/jobs", server.JobRequest{URLs: []string{"http://example.com"}, Options: server.JobOptions{RateLimit: 5000}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err := http.Get(api.URL + "/jobs/missing")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServer_RejectsJobsDuringShutdown(t *testing.T) {
+	jm, api := newTestJobServer(t, t.TempDir())
+	jm.Shutdown()
+
+	_, err := jm.Submit(server.JobRequest{URLs: []string{"http://example.com"}})
+	assert.ErrorIs(t, err, server.ErrShuttingDown)
+
+	resp := postJSON(t, api.URL+"/jobs", server.JobRequest{URLs: []string{"http://example.com"}})
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Empty(t, jm.List())
+}
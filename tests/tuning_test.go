@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/ireuven89/firefly-itzik/internal/essay"
+	"github.com/ireuven89/firefly-itzik/internal/logging"
+	"github.com/ireuven89/firefly-itzik/internal/rateLimiter"
+	"github.com/ireuven89/firefly-itzik/internal/server"
+	"github.com/ireuven89/firefly-itzik/internal/tuning"
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWordBank_ReloadWhileReading(t *testing.T) {
+	bankFile := filepath.Join(t.TempDir(), "words.txt")
+	assert.NoError(t, os.WriteFile(bankFile, []byte("apple\nbanana"), 0644))
+	wb := wordbank.NewWordBank(bankFile)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				// Either the old or the new set, never a partial one
+				assert.True(t, wb.Contains("apple"))
+			}
+		}()
+	}
+
+	assert.NoError(t, os.WriteFile(bankFile, []byte("apple\ncherry"), 0644))
+	assert.NoError(t, wb.LoadWords(context.Background(), bankFile))
+	cancel()
+	wg.Wait()
+
+	assert.True(t, wb.Contains("cherry"))
+	assert.False(t, wb.Contains("banana"))
+
+	// A failed reload keeps the previous words
+	assert.Error(t, wb.LoadWords(context.Background(), filepath.Join(t.TempDir(), "missing.txt")))
+	assert.True(t, wb.Contains("cherry"))
+}
+
+func TestWordBank_WatchFileReloadsOnChange(t *testing.T) {
+	bankFile := filepath.Join(t.TempDir(), "words.txt")
+	assert.NoError(t, os.WriteFile(bankFile, []byte("apple"), 0644))
+	wb := wordbank.NewWordBank(bankFile)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wordbank.WatchFile(ctx, wb, bankFile, 10*time.Millisecond, nil)
+
+	// Keep changing the file, the watcher may take its baseline after the first write
+	content := "apple\nbanana\ncherry"
+	assert.Eventually(t, func() bool {
+		content += "\n#"
+		assert.NoError(t, os.WriteFile(bankFile, []byte(content), 0644))
+		return wb.Contains("banana") && wb.Size() == 3
+	}, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestRateLimiter_SetRate(t *testing.T) {
+	limiter := rateLimiter.NewRateLimiter(1, time.Second)
+	defer limiter.Stop()
+
+	// Drain the single initial token so the next Wait blocks on the slow rate
+	assert.NoError(t, limiter.Wait(context.Background()))
+
+	waited := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		waited <- limiter.Wait(ctx)
+	}()
+
+	limiter.SetRate(100)
+	assert.Equal(t, 100, limiter.Rate())
+	assert.NoError(t, <-waited, "a waiter should pick up the faster rate")
+}
+
+func TestAdminHandler_Tuning(t *testing.T) {
+	limiter := rateLimiter.NewRateLimiter(10, time.Second)
+	defer limiter.Stop()
+	fetcher := essay.NewEssayFetcher(limiter, "", 4, time.Millisecond, logging.Discard(), nil)
+
+	bankFile := filepath.Join(t.TempDir(), "words.txt")
+	assert.NoError(t, os.WriteFile(bankFile, []byte("apple"), 0644))
+	wb := wordbank.NewWordBank(bankFile)
+
+	api := httptest.NewServer(tuning.NewAdminHandler(tuning.NewTuner(limiter, fetcher, wb, bankFile, 1, 100, 1, 20)))
+	defer api.Close()
+
+	resp := putJSON(t, api.URL+"/admin/tuning", tuning.Settings{RateLimit: 50})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var settings tuning.Settings
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&settings))
+	assert.Equal(t, tuning.Settings{RateLimit: 50, MaxHTTPWorkers: 4}, settings)
+	assert.Equal(t, 50, limiter.Rate())
+
+	resp = putJSON(t, api.URL+"/admin/tuning", tuning.Settings{MaxHTTPWorkers: 500})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, 4, fetcher.MaxWorkers())
+
+	assert.NoError(t, os.WriteFile(bankFile, []byte("apple\nbanana"), 0644))
+	resp = postJSON(t, api.URL+"/admin/wordbank/reload", nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.True(t, wb.Contains("banana"))
+}
+
+func TestServer_TuneRunningJob(t *testing.T) {
+	release := make(chan struct{})
+	articles := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer articles.Close()
+	defer close(release)
+
+	jm, api := newTestJobServer(t, t.TempDir())
+
+	job, err := jm.Submit(server.JobRequest{URLs: []string{articles.URL + "/slow"}})
+	assert.NoError(t, err)
+	defer jm.Cancel(job.ID)
+
+	resp := patchJSON(t, api.URL+"/jobs/"+job.ID, tuning.Settings{RateLimit: 20, MaxHTTPWorkers: 2})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var tuned server.Job
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&tuned))
+	assert.Equal(t, 20, tuned.Options.RateLimit)
+	assert.Equal(t, 2, tuned.Options.MaxHTTPWorkers)
+
+	resp = patchJSON(t, api.URL+"/jobs/missing", tuning.Settings{RateLimit: 20})
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	_, err = jm.Cancel(job.ID)
+	assert.NoError(t, err)
+	resp = patchJSON(t, api.URL+"/jobs/"+job.ID, tuning.Settings{RateLimit: 20})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func putJSON(t *testing.T, url string, body any) *http.Response {
+	return sendJSON(t, http.MethodPut, url, body)
+}
+
+func patchJSON(t *testing.T, url string, body any) *http.Response {
+	return sendJSON(t, http.MethodPatch, url, body)
+}
+
+func sendJSON(t *testing.T, method, url string, body any) *http.Response {
+	data, err := json.Marshal(body)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	assert.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
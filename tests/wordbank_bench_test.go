@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// benchmarkBankSize matches the size of the full English word bank
+const benchmarkBankSize = 415_000
+
+// writeBenchmarkBank writes n random words and returns the file with a mix of hits and misses to look up
+func writeBenchmarkBank(b *testing.B, n int) (string, []string) {
+	rng := rand.New(rand.NewSource(1))
+	randomWord := func() string {
+		word := make([]byte, 3+rng.Intn(10))
+		for i := range word {
+			word[i] = byte('a' + rng.Intn(26))
+		}
+		return string(word)
+	}
+
+	var content strings.Builder
+	lookups := make([]string, 0, 1024)
+	for i := 0; i < n; i++ {
+		word := randomWord()
+		content.WriteString(word)
+		content.WriteByte('\n')
+		if i%(n/512) == 0 {
+			lookups = append(lookups, word)
+		}
+	}
+	for len(lookups) < cap(lookups) {
+		lookups = append(lookups, randomWord())
+	}
+
+	path := filepath.Join(b.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte(content.String()), 0644); err != nil {
+		b.Fatal(err)
+	}
+	return path, lookups
+}
+
+func heapInUse() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+func BenchmarkWordBank_Contains(b *testing.B) {
+	path, lookups := writeBenchmarkBank(b, benchmarkBankSize)
+
+	for _, backend := range wordbank.Backends() {
+		b.Run(string(backend), func(b *testing.B) {
+			wb := wordbank.NewWordBankWithBackend(path, backend, nil)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				wb.Contains(lookups[i%len(lookups)])
+			}
+		})
+	}
+}
+
+func BenchmarkWordBank_Memory(b *testing.B) {
+	path, _ := writeBenchmarkBank(b, benchmarkBankSize)
+
+	for _, backend := range wordbank.Backends() {
+		b.Run(string(backend), func(b *testing.B) {
+			var bytes uint64
+			var words int
+			for i := 0; i < b.N; i++ {
+				before := heapInUse()
+				wb := wordbank.NewWordBankWithBackend(path, backend, nil)
+				after := heapInUse()
+				words = wb.Size()
+				runtime.KeepAlive(wb)
+				bytes = after - before
+			}
+			b.ReportMetric(float64(bytes)/(1<<20), "MB")
+			b.ReportMetric(float64(bytes)/float64(words), "B/word")
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package tests
+
+import (
+	"context"
+	"github.com/ireuven89/firefly-itzik/internal/models"
+	"github.com/ireuven89/firefly-itzik/internal/processor"
+	"github.com/ireuven89/firefly-itzik/internal/wordbank"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestCollection(t *testing.T, expr string) (wordbank.Collection, map[string]string) {
+	dir := t.TempDir()
+	contents := map[string]string{
+		"general": "apple\nbanana\ncloud\nserver",
+		"tech":    "cloud\nserver\nkubernetes",
+		"brands":  "apple\nkubernetes",
+	}
+
+	paths := make(map[string]string)
+	var files []wordbank.BankFile
+	for _, name := range []string{"general", "tech", "brands"} {
+		paths[name] = filepath.Join(dir, name+".txt")
+		assert.NoError(t, os.WriteFile(paths[name], []byte(contents[name]), 0644))
+		files = append(files, wordbank.BankFile{Name: name, Path: paths[name]})
+	}
+
+	c, err := wordbank.NewCollection(context.Background(), files, expr, wordbank.BackendMap, nil)
+	assert.NoError(t, err)
+	return c, paths
+}
+
+func TestCollection_SetOperations(t *testing.T) {
+	tests := []struct {
+		expr    string
+		matches []string
+	}{
+		{"", []string{"apple", "banana", "cloud", "server", "kubernetes"}},
+		{"general & tech", []string{"cloud", "server"}},
+		{"(general | tech) - brands", []string{"banana", "cloud", "server"}},
+		{"general | tech & brands", []string{"apple", "banana", "cloud", "server", "kubernetes"}},
+		{"tech - general - brands", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, _ := newTestCollection(t, tt.expr)
+
+			var matched []string
+			for _, word := range []string{"apple", "banana", "cloud", "server", "kubernetes"} {
+				if c.Contains(word) {
+					matched = append(matched, word)
+				}
+			}
+			assert.Equal(t, tt.matches, matched)
+			assert.Equal(t, len(tt.matches), c.Size())
+		})
+	}
+}
+
+func TestCollection_InvalidDefinitions(t *testing.T) {
+	_, err := wordbank.ParseBankFiles("general=words.txt,general=other.txt")
+	assert.ErrorContains(t, err, "more than once")
+
+	_, err = wordbank.ParseBankFiles("words.txt")
+	assert.ErrorContains(t, err, "name=path")
+
+	names := []string{"general", "tech"}
+	assert.NoError(t, wordbank.ValidateExpression("(general|tech)-general", names))
+	assert.ErrorContains(t, wordbank.ValidateExpression("general | brands", names), `unknown bank "brands"`)
+	assert.ErrorContains(t, wordbank.ValidateExpression("(general | tech", names), "missing closing parenthesis")
+	assert.ErrorContains(t, wordbank.ValidateExpression("general tech", names), `unexpected "tech"`)
+}
+
+func TestCollection_ReloadMember(t *testing.T) {
+	c, paths := newTestCollection(t, "general - brands")
+	assert.False(t, c.Contains("apple"))
+
+	assert.NoError(t, os.WriteFile(paths["brands"], []byte("kubernetes"), 0644))
+	assert.NoError(t, c.LoadWords(context.Background(), paths["brands"]))
+	assert.True(t, c.Contains("apple"))
+
+	assert.Error(t, c.LoadWords(context.Background(), "unrelated.txt"))
+}
+
+func TestWordProcessor_AttributesWordsToBanks(t *testing.T) {
+	c, _ := newTestCollection(t, "")
+	wp := processor.NewWordProcessor(c)
+
+	essayStream := make(chan models.Essay, 1)
+	errorChan := make(chan error)
+	essayStream <- models.Essay{Content: "cloud cloud cloud apple apple kubernetes banana"}
+	close(essayStream)
+	close(errorChan)
+
+	topWords, _, _ := wp.ProcessEssayStream(context.Background(), essayStream, errorChan, 2)
+	assert.Equal(t, []models.WordCount{
+		{Word: "cloud", Count: 3, Banks: []string{"general", "tech"}},
+		{Word: "apple", Count: 2, Banks: []string{"general", "brands"}},
+	}, topWords)
+
+	byBank := processor.TopWordsByBank(wp.Result().WordCounts, c, 1, false)
+	assert.Equal(t, map[string][]models.WordCount{
+		"general": {{Word: "cloud", Count: 3, Banks: []string{"general", "tech"}}},
+		"tech":    {{Word: "cloud", Count: 3, Banks: []string{"general", "tech"}}},
+		"brands":  {{Word: "apple", Count: 2, Banks: []string{"general", "brands"}}},
+	}, byBank)
+}
+
+func TestWordBank_BackendsAgree(t *testing.T) {
+	bankFile := filepath.Join(t.TempDir(), "words.txt")
+	assert.NoError(t, os.WriteFile(bankFile, []byte("Apple\nbanana\ncherry\nbanana\nab\nx-ray\n# comment\nzebra"), 0644))
+
+	for _, backend := range wordbank.Backends() {
+		t.Run(string(backend), func(t *testing.T) {
+			wb := wordbank.NewWordBankWithBackend(bankFile, backend, nil)
+			assert.Equal(t, 4, wb.Size())
+			for _, word := range []string{"apple", "APPLE", "banana", "cherry", "zebra"} {
+				assert.True(t, wb.Contains(word), word)
+			}
+			for _, word := range []string{"ab", "x-ray", "comment", "appl", "zebras", ""} {
+				assert.False(t, wb.Contains(word), word)
+			}
+		})
+	}
+
+	_, err := wordbank.ParseBackend("trie")
+	assert.ErrorContains(t, err, "unknown word bank backend")
+}
+
+func writeRichBank(t *testing.T) string {
+	bankFile := filepath.Join(t.TempDir(), "words.tsv")
+	assert.NoError(t, os.WriteFile(bankFile, []byte(
+		"# word\tpos\ttags\tweight\tcanonical\n"+
+			"apple\tnoun\tcompany,fruit\t2\n"+
+			"banana\tnoun\tfruit\n"+
+			"run\tverb\n"+
+			"running\tverb\t\t\trun\n"+
+			"colour\tnoun\t\t\tcolor\n"+
+			"color\tnoun\n"+
+			"quickly\n"), 0644))
+	return bankFile
+}
+
+func TestWordBank_RichFormats(t *testing.T) {
+	wb := wordbank.NewWordBank(writeRichBank(t))
+	assert.Equal(t, 7, wb.Size())
+
+	entry, ok := wb.Lookup("Apple")
+	assert.True(t, ok)
+	assert.Equal(t, wordbank.Entry{Word: "apple", POS: "noun", Tags: []string{"company", "fruit"}, Weight: 2}, entry)
+
+	entry, ok = wb.Lookup("quickly")
+	assert.True(t, ok)
+	assert.False(t, entry.HasMetadata())
+
+	_, ok = wb.Lookup("cherry")
+	assert.False(t, ok)
+
+	jsonFile := filepath.Join(t.TempDir(), "words.json")
+	assert.NoError(t, os.WriteFile(jsonFile, []byte(`[{"word": "Acme", "pos": "noun", "tags": ["company"], "weight": 3}, {"word": "widget"}]`), 0644))
+	wb = wordbank.NewWordBank(jsonFile)
+	entry, ok = wb.Lookup("acme")
+	assert.True(t, ok)
+	assert.Equal(t, 3.0, entry.EffectiveWeight())
+	assert.True(t, wb.Contains("widget"))
+
+	// Parts of speech and tags are lowercased in every format, and negative weights are rejected in every format
+	assert.NoError(t, os.WriteFile(jsonFile, []byte(`[{"word": "Acme", "pos": "Noun"}, {"word": "widget"}]`), 0644))
+	assert.NoError(t, wb.LoadWords(context.Background(), jsonFile))
+	entry, _ = wb.Lookup("acme")
+	assert.Equal(t, "noun", entry.POS)
+	assert.NoError(t, os.WriteFile(jsonFile, []byte(`[{"word": "Acme", "tags": ["Brand", "TECH"]}, {"word": "widget"}]`), 0644))
+	assert.NoError(t, wb.LoadWords(context.Background(), jsonFile))
+	entry, _ = wb.Lookup("acme")
+	assert.Equal(t, []string{"brand", "tech"}, entry.Tags, "so are tags")
+	assert.NoError(t, os.WriteFile(jsonFile, []byte(`[{"word": "Acme", "weight": -1}]`), 0644))
+	assert.ErrorContains(t, wb.LoadWords(context.Background(), jsonFile), "not a non-negative number")
+	negativeFile := filepath.Join(t.TempDir(), "negative.tsv")
+	assert.NoError(t, os.WriteFile(negativeFile, []byte("acme\tnoun\t\t-1\n"), 0644))
+	assert.ErrorContains(t, wb.LoadWords(context.Background(), negativeFile), "not a non-negative number")
+
+	badFile := filepath.Join(t.TempDir(), "bad.tsv")
+	assert.NoError(t, os.WriteFile(badFile, []byte("apple\tnoun\t\theavy\n"), 0644))
+	assert.ErrorContains(t, wb.LoadWords(context.Background(), badFile), "line 1")
+	assert.True(t, wb.Contains("widget"), "a failed load keeps the previous words")
+}
+
+func TestWordProcessor_FiltersAndWeights(t *testing.T) {
+	wb := wordbank.NewWordBank(writeRichBank(t))
+	text := "apple banana banana banana run running running colour color quickly quickly quickly quickly"
+
+	process := func(options processor.Options) []models.WordCount {
+		essayStream := make(chan models.Essay, 1)
+		errorChan := make(chan error)
+		essayStream <- models.Essay{Content: text}
+		close(essayStream)
+		close(errorChan)
+
+		topWords, _, _ := processor.NewWordProcessorWithOptions(wb, options).ProcessEssayStream(context.Background(), essayStream, errorChan, 3)
+		return topWords
+	}
+
+	// Inflected and variant forms are counted under their canonical form
+	assert.Equal(t, []models.WordCount{{Word: "quickly", Count: 4}, {Word: "banana", Count: 3}, {Word: "run", Count: 3}}, process(processor.Options{}))
+
+	assert.Equal(t, []models.WordCount{{Word: "run", Count: 3}}, process(processor.Options{POS: []string{"verb"}}))
+	assert.Equal(t, []models.WordCount{{Word: "run", Count: 3}}, process(processor.Options{POS: []string{"Verb"}}), "the filter ignores case")
+	assert.Equal(t, []models.WordCount{{Word: "apple", Count: 1}}, process(processor.Options{Tags: []string{"company"}}))
+	assert.Equal(t, []models.WordCount{{Word: "apple", Count: 1}}, process(processor.Options{Tags: []string{"Company"}}), "the tag filter ignores case too")
+
+	assert.Equal(t, []models.WordCount{
+		{Word: "quickly", Count: 4, Score: 4},
+		{Word: "banana", Count: 3, Score: 3},
+		{Word: "run", Count: 3, Score: 3},
+	}, process(processor.Options{Weighted: true}))
+
+	assert.Equal(t, []models.WordCount{
+		{Word: "banana", Count: 3, Score: 3},
+		{Word: "apple", Count: 1, Score: 2},
+	}, process(processor.Options{Tags: []string{"fruit"}, Weighted: true}))
+}
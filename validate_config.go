@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ireuven89/firefly-itzik/config"
+	"os"
+	"text/tabwriter"
+)
+
+// runValidateConfig loads the configuration the same way every other command does and reports whether it is valid
+func runValidateConfig(args []string) error {
+	flags := newFlagSet("validate-config", "")
+	configFlags := config.RegisterFlags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if _, err := config.Load(configFlags); err != nil {
+		return err
+	}
+
+	fmt.Println("Configuration is valid")
+	return nil
+}
+
+// runShowConfig prints the effective configuration with the layer each value came from
+func runShowConfig(args []string) error {
+	flags := newFlagSet("show-config", "")
+	format := flags.String("format", "text", "output format: text or json")
+	configFlags := config.RegisterFlags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	settings, loadErr := config.Explain(configFlags)
+
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(settings); err != nil {
+			return err
+		}
+	case "text":
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "KEY\tVALUE\tSOURCE")
+		for _, setting := range settings {
+			fmt.Fprintf(writer, "%s\t%q\t%s\n", setting.Key, setting.Value, setting.Source)
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown -format %q (use text or json)", *format)
+	}
+
+	return loadErr
+}